@@ -138,7 +138,7 @@ func (this *BlockchainBuilder) EncodeTransfer(stake int, from, to interface{}, i
 	return buf.Bytes(), nil
 }
 
-func (this *BlockchainBuilder) EncodeInvoke(from, contract interface{}, function string, info core.InteractionInfo) ([]byte, error) {
+func (this *BlockchainBuilder) EncodeInvoke(from, contract interface{}, function string, args []interface{}, info core.InteractionInfo) ([]byte, error) {
 	var buf bytes.Buffer
 
 	util.NewMonadOutputWriter(&buf).
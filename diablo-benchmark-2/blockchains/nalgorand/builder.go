@@ -258,12 +258,14 @@ func (this *BlockchainBuilder) EncodeTransfer(amount int, from, to interface{},
 }
 
 
-func (this *BlockchainBuilder) EncodeInvoke(from, to interface{}, function string, info core.InteractionInfo) ([]byte, error) {
+func (this *BlockchainBuilder) EncodeInvoke(from, to interface{}, function string, iargs []interface{}, info core.InteractionInfo) ([]byte, error) {
 	var tx *invokeTransaction
 	var buffer bytes.Buffer
 	var cont *contract
 	var args [][]byte
+	var arg []byte
 	var err error
+	var i int
 
 	cont = to.(*contract)
 
@@ -272,6 +274,16 @@ func (this *BlockchainBuilder) EncodeInvoke(from, to interface{}, function strin
 		return nil, err
 	}
 
+	for i = range iargs {
+		arg, err = encodeArgument(iargs[i])
+		if err != nil {
+			return nil, fmt.Errorf("function '%s' argument %d: %s",
+				function, i, err.Error())
+		}
+
+		args = append(args, arg)
+	}
+
 	tx = newInvokeTransaction(uint64(this.nextTxuid), cont.appid,
 		args, from.(*account).address, from.(*account).key, nil)
 
@@ -8,6 +8,7 @@ import (
 	"diablo-benchmark/core"
 	"diablo-benchmark/util"
 	"encoding/base64"
+	"encoding/binary"
 	"fmt"
 	"io"
 	"io/ioutil"
@@ -301,3 +302,41 @@ func (this *application) arguments(function string) ([][]byte, error) {
 
 	return args, nil
 }
+
+// Encode an argument of an invoke interaction as an application argument.
+// Integers are encoded as 8 bytes big endian (like TEAL `itob` does),
+// accounts as their 32 bytes address and contracts as their application id.
+//
+func encodeArgument(arg interface{}) ([]byte, error) {
+	var addr types.Address
+	var ret []byte
+	var err error
+
+	switch arg.(type) {
+	case int:
+		if arg.(int) < 0 {
+			return nil, fmt.Errorf("negative integer %d", arg.(int))
+		}
+
+		ret = make([]byte, 8)
+		binary.BigEndian.PutUint64(ret, uint64(arg.(int)))
+
+		return ret, nil
+	case string:
+		return []byte(arg.(string)), nil
+	case *account:
+		addr, err = types.DecodeAddress(arg.(*account).address)
+		if err != nil {
+			return nil, err
+		}
+
+		return addr[:], nil
+	case *contract:
+		ret = make([]byte, 8)
+		binary.BigEndian.PutUint64(ret, arg.(*contract).appid)
+
+		return ret, nil
+	default:
+		return nil, fmt.Errorf("unsupported argument %v", arg)
+	}
+}
@@ -0,0 +1,54 @@
+package nalgorand
+
+
+import (
+	"bytes"
+	"testing"
+
+	"github.com/algorand/go-algorand-sdk/types"
+)
+
+
+func TestEncodeArgument(t *testing.T) {
+	var addr types.Address
+	var encoded []byte
+	var err error
+
+	encoded, err = encodeArgument(258)
+	if (err != nil) ||
+		!bytes.Equal(encoded, []byte{ 0, 0, 0, 0, 0, 0, 1, 2 }) {
+		t.Fatalf("int: got %v, %v", encoded, err)
+	}
+
+	encoded, err = encodeArgument("memo")
+	if (err != nil) || (string(encoded) != "memo") {
+		t.Fatalf("string: got %v, %v", encoded, err)
+	}
+
+	addr[0] = 1
+	encoded, err = encodeArgument(&account{ address: addr.String() })
+	if (err != nil) || !bytes.Equal(encoded, addr[:]) {
+		t.Fatalf("account: got %v, %v", encoded, err)
+	}
+
+	encoded, err = encodeArgument(&contract{ appid: 3 })
+	if (err != nil) ||
+		!bytes.Equal(encoded, []byte{ 0, 0, 0, 0, 0, 0, 0, 3 }) {
+		t.Fatalf("contract: got %v, %v", encoded, err)
+	}
+}
+
+func TestEncodeArgumentInvalid(t *testing.T) {
+	var args []interface{} = []interface{}{
+		-1, 2.5, &account{ address: "not an address" },
+	}
+	var err error
+	var i int
+
+	for i = range args {
+		_, err = encodeArgument(args[i])
+		if err == nil {
+			t.Fatalf("%v encoded", args[i])
+		}
+	}
+}
@@ -312,12 +312,14 @@ func (this *BlockchainBuilder) EncodeTransfer(amount int, from, to interface{},
 	return buffer.Bytes(), nil
 }
 
-func (this *BlockchainBuilder) EncodeInvoke(from interface{}, contr interface{}, function string, info core.InteractionInfo) ([]byte, error) {
+func (this *BlockchainBuilder) EncodeInvoke(from interface{}, contr interface{}, function string, iargs []interface{}, info core.InteractionInfo) ([]byte, error) {
+	var arg diemtypes.TransactionArgument
 	var args *applicationArguments
 	var tx *invokeTransaction
 	var buffer bytes.Buffer
 	var cont *contract
 	var err error
+	var i int
 
 	cont = contr.(*contract)
 
@@ -326,6 +328,16 @@ func (this *BlockchainBuilder) EncodeInvoke(from interface{}, contr interface{},
 		return nil, err
 	}
 
+	for i = range iargs {
+		arg, err = encodeArgument(iargs[i])
+		if err != nil {
+			return nil, fmt.Errorf("function '%s' argument %d: %s",
+				function, i, err.Error())
+		}
+
+		args.funcargs = append(args.funcargs, arg)
+	}
+
 	tx = newInvokeTransaction(from.(*account).key, args.funccode,
 		args.funcargs, from.(*account).sequence)
 
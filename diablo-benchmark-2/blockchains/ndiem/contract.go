@@ -306,3 +306,32 @@ func (this *application) arguments(function string, addr diemtypes.AccountAddres
 
 	return &ret, nil
 }
+
+// Encode an argument of an invoke interaction as a Move transaction argument.
+// Integers are `u64`, strings are `vector<u8>` and accounts or contracts are
+// their `address`.
+//
+func encodeArgument(arg interface{}) (diemtypes.TransactionArgument, error) {
+	switch arg.(type) {
+	case int:
+		if arg.(int) < 0 {
+			return nil, fmt.Errorf("negative integer %d", arg.(int))
+		}
+
+		val := diemtypes.TransactionArgument__U64(uint64(arg.(int)))
+		return &val, nil
+	case string:
+		val := diemtypes.TransactionArgument__U8Vector(arg.(string))
+		return &val, nil
+	case *account:
+		return &diemtypes.TransactionArgument__Address{
+			Value: arg.(*account).addr,
+		}, nil
+	case *contract:
+		return &diemtypes.TransactionArgument__Address{
+			Value: arg.(*contract).addr.addr,
+		}, nil
+	default:
+		return nil, fmt.Errorf("unsupported argument %v", arg)
+	}
+}
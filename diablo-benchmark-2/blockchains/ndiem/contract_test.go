@@ -0,0 +1,53 @@
+package ndiem
+
+
+import (
+	"testing"
+
+	"github.com/diem/client-sdk-go/diemtypes"
+)
+
+
+func TestEncodeArgument(t *testing.T) {
+	var arg diemtypes.TransactionArgument
+	var addr diemtypes.AccountAddress
+	var err error
+
+	arg, err = encodeArgument(258)
+	if (err != nil) ||
+		(*arg.(*diemtypes.TransactionArgument__U64) != 258) {
+		t.Fatalf("int: got %v, %v", arg, err)
+	}
+
+	arg, err = encodeArgument("memo")
+	if (err != nil) || (string(*arg.(*diemtypes.
+		TransactionArgument__U8Vector)) != "memo") {
+		t.Fatalf("string: got %v, %v", arg, err)
+	}
+
+	addr[0] = 1
+	arg, err = encodeArgument(&account{ addr: addr })
+	if (err != nil) ||
+		(arg.(*diemtypes.TransactionArgument__Address).Value != addr) {
+		t.Fatalf("account: got %v, %v", arg, err)
+	}
+
+	arg, err = encodeArgument(&contract{ addr: &account{ addr: addr } })
+	if (err != nil) ||
+		(arg.(*diemtypes.TransactionArgument__Address).Value != addr) {
+		t.Fatalf("contract: got %v, %v", arg, err)
+	}
+}
+
+func TestEncodeArgumentInvalid(t *testing.T) {
+	var args []interface{} = []interface{}{ -1, 2.5, true }
+	var err error
+	var i int
+
+	for i = range args {
+		_, err = encodeArgument(args[i])
+		if err == nil {
+			t.Fatalf("%v encoded", args[i])
+		}
+	}
+}
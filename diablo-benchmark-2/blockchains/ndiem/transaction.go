@@ -363,7 +363,7 @@ func (this *invokeTransaction) encode(dest io.Writer) error {
 			return err
 		} else if len(bargs[i]) > 65535 {
 			return fmt.Errorf("invoke arguments %d is too long " +
-				"(%d bytes)", len(bargs[i]))
+				"(%d bytes)", i, len(bargs[i]))
 		}
 	}
 
@@ -224,7 +224,7 @@ func (this *BlockchainBuilder) EncodeTransfer(amount int, from, to interface{},
 	return buffer.Bytes(), nil
 }
 
-func (this *BlockchainBuilder) EncodeInvoke(from, to interface{}, function string, info core.InteractionInfo) ([]byte, error) {
+func (this *BlockchainBuilder) EncodeInvoke(from, to interface{}, function string, args []interface{}, info core.InteractionInfo) ([]byte, error) {
 	var tx *invokeTransaction
 	var buffer bytes.Buffer
 	var tcontract *contract
@@ -235,7 +235,12 @@ func (this *BlockchainBuilder) EncodeInvoke(from, to interface{}, function strin
 	faccount = from.(*account)
 	tcontract = to.(*contract)
 
-	payload, err = tcontract.appli.arguments(function)
+	if len(args) > 0 {
+		payload, err = tcontract.appli.call(function, args)
+	} else {
+		payload, err = tcontract.appli.arguments(function)
+	}
+
 	if err != nil {
 		return nil, err
 	}
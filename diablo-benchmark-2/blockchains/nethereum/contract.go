@@ -9,8 +9,11 @@ import (
 	"encoding/hex"
 	"fmt"
 	"io"
+	"math/big"
+	"reflect"
 	"strings"
 
+	"github.com/ethereum/go-ethereum/accounts/abi"
 	"github.com/ethereum/go-ethereum/common/compiler"
 )
 
@@ -140,3 +143,114 @@ func (this *application) arguments(function string) ([]byte, error) {
 
 	return append(entry, payload...), nil
 }
+
+// Encode a call to the function with the given signature (e.g.
+// "transfer(address,uint256)") with typed arguments instead of asking the
+// arguments parser.
+// Accounts and contracts are passed as their address.
+//
+func (this *application) call(function string, args []interface{}) ([]byte, error) {
+	var arguments abi.Arguments
+	var values []interface{}
+	var entry, payload []byte
+	var tnames []string
+	var value interface{}
+	var start, end, i int
+	var typ abi.Type
+	var found bool
+	var err error
+
+	entry, found = this.entries[function]
+	if !found {
+		return nil, fmt.Errorf("unknown function '%s'", function)
+	}
+
+	start = strings.Index(function, "(")
+	end = strings.LastIndex(function, ")")
+	if (start < 0) || (end < start) {
+		return nil, fmt.Errorf("invalid function signature '%s'",
+			function)
+	}
+
+	tnames = make([]string, 0)
+	if end > (start + 1) {
+		tnames = strings.Split(function[start+1:end], ",")
+	}
+
+	if len(tnames) != len(args) {
+		return nil, fmt.Errorf("function '%s' takes %d arguments " +
+			"(%d given)", function, len(tnames), len(args))
+	}
+
+	arguments = make(abi.Arguments, len(args))
+	values = make([]interface{}, len(args))
+
+	for i = range args {
+		typ, err = abi.NewType(tnames[i], "", nil)
+		if err != nil {
+			return nil, err
+		}
+
+		value, err = abiValue(typ, args[i])
+		if err != nil {
+			return nil, fmt.Errorf("function '%s' argument %d: %s",
+				function, i, err.Error())
+		}
+
+		arguments[i] = abi.Argument{ Type: typ }
+		values[i] = value
+	}
+
+	payload, err = arguments.Pack(values...)
+	if err != nil {
+		return nil, err
+	}
+
+	return append(entry, payload...), nil
+}
+
+// Convert an argument of an invoke interaction to the Go type the ABI
+// encoder expects for `typ`.
+// An int which does not fit in `typ` is rejected rather than wrapped around.
+//
+func abiValue(typ abi.Type, arg interface{}) (interface{}, error) {
+	var rtype reflect.Type = typ.GetType()
+	var value reflect.Value
+
+	switch arg.(type) {
+	case *account:
+		return arg.(*account).address, nil
+	case *contract:
+		return arg.(*contract).appid, nil
+	case int:
+		if (typ.T != abi.IntTy) && (typ.T != abi.UintTy) {
+			return nil, fmt.Errorf("cannot convert int to %s",
+				typ.String())
+		}
+
+		if (typ.T == abi.UintTy) && (arg.(int) < 0) {
+			return nil, fmt.Errorf("negative integer %d for %s",
+				arg.(int), typ.String())
+		}
+
+		if rtype == reflect.TypeOf(&big.Int{}) {
+			return big.NewInt(int64(arg.(int))), nil
+		}
+
+		value = reflect.New(rtype).Elem()
+
+		if ((typ.T == abi.IntTy) &&
+			value.OverflowInt(int64(arg.(int)))) ||
+			((typ.T == abi.UintTy) &&
+			value.OverflowUint(uint64(arg.(int)))) {
+			return nil, fmt.Errorf("integer %d overflows %s",
+				arg.(int), typ.String())
+		}
+
+		return reflect.ValueOf(arg).Convert(rtype).Interface(), nil
+	case string:
+		return arg, nil
+	default:
+		return nil, fmt.Errorf("unsupported argument %v", arg)
+	}
+}
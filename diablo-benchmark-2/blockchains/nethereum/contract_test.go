@@ -0,0 +1,126 @@
+package nethereum
+
+
+import (
+	"bytes"
+	"math/big"
+	"testing"
+
+	"github.com/ethereum/go-ethereum/accounts/abi"
+	"github.com/ethereum/go-ethereum/common"
+)
+
+
+func testAbiType(t *testing.T, name string) abi.Type {
+	var typ abi.Type
+	var err error
+
+	typ, err = abi.NewType(name, "", nil)
+	if err != nil {
+		t.Fatalf("type %s: %s", name, err.Error())
+	}
+
+	return typ
+}
+
+type testAbiArgument struct {
+	typ  string
+	arg  interface{}
+}
+
+func TestAbiValue(t *testing.T) {
+	var value interface{}
+	var err error
+
+	value, err = abiValue(testAbiType(t, "uint8"), 255)
+	if (err != nil) || (value != uint8(255)) {
+		t.Fatalf("uint8: got %v, %v", value, err)
+	}
+
+	value, err = abiValue(testAbiType(t, "int32"), -7)
+	if (err != nil) || (value != int32(-7)) {
+		t.Fatalf("int32: got %v, %v", value, err)
+	}
+
+	value, err = abiValue(testAbiType(t, "int256"), -7)
+	if (err != nil) || (value.(*big.Int).Cmp(big.NewInt(-7)) != 0) {
+		t.Fatalf("int256: got %v, %v", value, err)
+	}
+
+	value, err = abiValue(testAbiType(t, "uint256"), 7)
+	if (err != nil) || (value.(*big.Int).Cmp(big.NewInt(7)) != 0) {
+		t.Fatalf("uint256: got %v, %v", value, err)
+	}
+
+	value, err = abiValue(testAbiType(t, "string"), "memo")
+	if (err != nil) || (value != "memo") {
+		t.Fatalf("string: got %v, %v", value, err)
+	}
+
+	value, err = abiValue(testAbiType(t, "address"), &account{
+		address: common.HexToAddress("0x01"),
+	})
+	if (err != nil) || (value != common.HexToAddress("0x01")) {
+		t.Fatalf("address: got %v, %v", value, err)
+	}
+}
+
+func TestAbiValueInvalid(t *testing.T) {
+	var tests []testAbiArgument = []testAbiArgument{
+		{ "uint8", -1 },
+		{ "uint64", -1 },
+		{ "uint256", -1 },
+		{ "uint8", 256 },
+		{ "int8", 128 },
+		{ "int8", -129 },
+		{ "bool", 1 },
+		{ "uint256", 2.5 },
+	}
+	var err error
+	var i int
+
+	for i = range tests {
+		_, err = abiValue(testAbiType(t, tests[i].typ), tests[i].arg)
+		if err == nil {
+			t.Fatalf("%v converted to %s", tests[i].arg,
+				tests[i].typ)
+		}
+	}
+}
+
+func TestApplicationCall(t *testing.T) {
+	var app *application
+	var payload []byte
+	var err error
+
+	app = &application{
+		entries: map[string][]byte{
+			"transfer(address,uint256)": []byte{ 1, 2, 3, 4 },
+		},
+	}
+
+	payload, err = app.call("transfer(address,uint256)", []interface{}{
+		&account{ address: common.HexToAddress("0x01") }, 7,
+	})
+	if err != nil {
+		t.Fatalf("call: %s", err.Error())
+	}
+
+	if (len(payload) != 4 + 2 * 32) ||
+		!bytes.Equal(payload[:4], []byte{ 1, 2, 3, 4 }) ||
+		(payload[4 + 31] != 1) || (payload[4 + 63] != 7) {
+		t.Fatalf("wrong payload %x", payload)
+	}
+
+	_, err = app.call("transfer(address,uint256)", []interface{}{
+		&account{ address: common.HexToAddress("0x01") }, -7,
+	})
+	if err == nil {
+		t.Fatalf("negative uint256 encoded")
+	}
+
+	_, err = app.call("transfer(address,uint256)", []interface{}{ 7 })
+	if err == nil {
+		t.Fatalf("call with missing argument encoded")
+	}
+}
@@ -0,0 +1,828 @@
+package nzcash
+
+
+import (
+	"bytes"
+	"diablo-benchmark/core"
+	"fmt"
+	"time"
+)
+
+
+type BlockchainBuilder struct {
+	logger           core.Logger
+	node             *node
+	premadeAccounts  []*account
+	usedAccounts     int
+	regtest          *bool
+	spendUtxos       bool
+	sampler          *chainSampler
+	nextTxuid        uint64
+	offline          bool    // never contact the node
+}
+
+type account struct {
+	address   string
+	key       string          // WIF encoded transparent private key
+	balance   uint64          // transparent balance in zatoshis
+	utxos     []*utxo
+	shielded  *shieldedAccount
+}
+
+type shieldedAccount struct {
+	address  string
+	key      string           // Sapling or Unified spending key
+	balance  uint64           // shielded balance in zatoshis
+	notes    int
+}
+
+type utxo struct {
+	txid    string
+	vout    uint32
+	script  string
+	amount  uint64
+}
+
+
+// Create a new builder.
+// If spendUtxos is true, the builder selects the unspent outputs consumed by
+// each transfer so clients can build raw transactions without a wallet.
+//
+func newBuilder(logger core.Logger, node *node, spendUtxos bool) *BlockchainBuilder {
+	return &BlockchainBuilder{
+		logger: logger,
+		node: node,
+		premadeAccounts: make([]*account, 0),
+		usedAccounts: 0,
+		regtest: nil,
+		spendUtxos: spendUtxos,
+		sampler: nil,
+		nextTxuid: 0,
+		offline: false,
+	}
+}
+
+func (this *BlockchainBuilder) addAccount(address, key string, shielded *shieldedAccount) {
+	this.premadeAccounts = append(this.premadeAccounts, &account{
+		address: address,
+		key: key,
+		balance: 0,
+		utxos: make([]*utxo, 0),
+		shielded: shielded,
+	})
+}
+
+// Import the keys of the premade accounts in the wallet of the builder node
+// and discover what they can spend.
+// The wallet rescans the chain only once, when importing the last new key,
+// so a premade account file can be used again on the same node without
+// paying for a rescan.
+//
+func (this *BlockchainBuilder) discoverAccounts() error {
+	var addrs, zaddrs, keys, zkeys []string
+	var accounts map[string]*account
+	var unspents []nodeUnspent
+	var unspent *nodeUnspent
+	var notes []nodeNote
+	var note *nodeNote
+	var acc *account
+	var mine bool
+	var err error
+	var i int
+
+	if len(this.premadeAccounts) == 0 {
+		return nil
+	}
+
+	accounts = make(map[string]*account)
+	addrs = make([]string, 0, len(this.premadeAccounts))
+	zaddrs = make([]string, 0)
+	keys = make([]string, 0)
+	zkeys = make([]string, 0)
+
+	for _, acc = range this.premadeAccounts {
+		accounts[acc.address] = acc
+		addrs = append(addrs, acc.address)
+
+		mine, err = this.node.isMine(acc.address)
+		if err != nil {
+			return err
+		} else if !mine {
+			keys = append(keys, acc.key)
+		}
+
+		if acc.shielded == nil {
+			continue
+		}
+
+		accounts[acc.shielded.address] = acc
+		zaddrs = append(zaddrs, acc.shielded.address)
+
+		mine, err = this.node.zIsMine(acc.shielded.address)
+		if err != nil {
+			return err
+		} else if !mine {
+			zkeys = append(zkeys, acc.shielded.key)
+		}
+	}
+
+	this.logger.Debugf("import %d transparent and %d shielded keys",
+		len(keys), len(zkeys))
+
+	for i = range keys {
+		err = this.node.importPrivKey(keys[i], i == (len(keys) - 1))
+		if err != nil {
+			return err
+		}
+	}
+
+	for i = range zkeys {
+		err = this.node.zImportKey(zkeys[i], i == (len(zkeys) - 1))
+		if err != nil {
+			return err
+		}
+	}
+
+	unspents, err = this.node.listUnspent(addrs)
+	if err != nil {
+		return err
+	}
+
+	for i = range unspents {
+		unspent = &unspents[i]
+
+		if !unspent.Spendable {
+			continue
+		}
+
+		acc = accounts[unspent.Address]
+		if acc == nil {
+			continue
+		}
+
+		acc.balance += unspent.AmountZat
+		acc.utxos = append(acc.utxos, &utxo{
+			txid: unspent.Txid,
+			vout: unspent.Vout,
+			script: unspent.ScriptPubKey,
+			amount: unspent.AmountZat,
+		})
+	}
+
+	if len(zaddrs) > 0 {
+		notes, err = this.node.zListUnspent(zaddrs)
+		if err != nil {
+			return err
+		}
+	}
+
+	for i = range notes {
+		note = &notes[i]
+
+		if !note.Spendable {
+			continue
+		}
+
+		acc = accounts[note.Address]
+		if (acc == nil) || (acc.shielded == nil) {
+			continue
+		}
+
+		acc.shielded.balance += note.AmountZat
+		acc.shielded.notes += 1
+	}
+
+	for _, acc = range this.premadeAccounts {
+		if acc.shielded == nil {
+			this.logger.Tracef("account %s: %d zat in %d utxos",
+				acc.address, acc.balance, len(acc.utxos))
+		} else {
+			this.logger.Tracef("account %s: %d zat in %d utxos, " +
+				"%d zat in %d notes", acc.address,
+				acc.balance, len(acc.utxos),
+				acc.shielded.balance, acc.shielded.notes)
+		}
+	}
+
+	return nil
+}
+
+func (this *BlockchainBuilder) isRegtest() (bool, error) {
+	var info *nodeBlockchainInfo
+	var ret bool
+	var err error
+
+	if this.regtest != nil {
+		return *this.regtest, nil
+	}
+
+	info, err = this.node.getBlockchainInfo()
+	if err != nil {
+		return false, err
+	}
+
+	ret = (info.Chain == "regtest")
+	this.regtest = &ret
+
+	return ret, nil
+}
+
+// Create a new transparent account funded by the wallet of the builder node.
+// This only works on regtest where the builder can mine the funding
+// transaction itself.
+//
+func (this *BlockchainBuilder) mintAccount(stake int) (*account, error) {
+	var unspents []nodeUnspent
+	var address, key string
+	var regtest bool
+	var acc *account
+	var err error
+	var i int
+
+	regtest, err = this.isRegtest()
+	if err != nil {
+		return nil, err
+	} else if !regtest {
+		return nil, fmt.Errorf("can only use %d premade accounts",
+			this.usedAccounts)
+	}
+
+	address, err = this.node.getNewAddress()
+	if err != nil {
+		return nil, err
+	}
+
+	key, err = this.node.dumpPrivKey(address)
+	if err != nil {
+		return nil, err
+	}
+
+	acc = &account{
+		address: address,
+		key: key,
+		balance: 0,
+		utxos: make([]*utxo, 0),
+		shielded: nil,
+	}
+
+	this.logger.Tracef("mint new account %s with stake %d", address,
+		stake)
+
+	if stake <= 0 {
+		return acc, nil
+	}
+
+	_, err = this.node.sendToAddress(address, uint64(stake))
+	if err != nil {
+		return nil, err
+	}
+
+	err = this.node.generate(1)
+	if err != nil {
+		return nil, err
+	}
+
+	unspents, err = this.node.listUnspent([]string{ address })
+	if err != nil {
+		return nil, err
+	}
+
+	for i = range unspents {
+		acc.balance += unspents[i].AmountZat
+		acc.utxos = append(acc.utxos, &utxo{
+			txid: unspents[i].Txid,
+			vout: unspents[i].Vout,
+			script: unspents[i].ScriptPubKey,
+			amount: unspents[i].AmountZat,
+		})
+	}
+
+	return acc, nil
+}
+
+// Pick unspent outputs of the given account to pay the given amount and the
+// fee of a transaction with the given number of outputs (change included).
+// The picked outputs are removed from the account so no two transactions
+// spend the same output. The change is not reused since its txid is only
+// known once the transaction is signed.
+//
+func (this *BlockchainBuilder) selectInputs(acc *account, amount uint64, noutputs int) ([]*utxo, uint64, error) {
+	var ret []*utxo = make([]*utxo, 0)
+	var total, fee uint64
+	var in *utxo
+
+	fee = conventionalFee(0, noutputs)
+	total = 0
+
+	for _, in = range acc.utxos {
+		if total >= (amount + fee) {
+			break
+		}
+
+		ret = append(ret, in)
+		total += in.amount
+		fee = conventionalFee(len(ret), noutputs)
+	}
+
+	if total < (amount + fee) {
+		return nil, 0, fmt.Errorf("account %s cannot pay %d zat " +
+			"(%d zat left in %d utxos)", acc.address, amount + fee,
+			acc.balance, len(acc.utxos))
+	}
+
+	acc.utxos = acc.utxos[len(ret):]
+	acc.balance -= total
+
+	return ret, fee, nil
+}
+
+func (this *BlockchainBuilder) StartSampling(start time.Time) error {
+	if this.sampler == nil {
+		return nil
+	}
+
+	return this.sampler.begin(start)
+}
+
+func (this *BlockchainBuilder) StopSampling() (interface{}, error) {
+	if this.sampler == nil {
+		return nil, nil
+	}
+
+	return this.sampler.end(), nil
+}
+
+
+func (this *BlockchainBuilder) CreateAccount(stake int) (interface{}, error) {
+	var ret *account
+
+	if stake < 0 {
+		return nil, fmt.Errorf("account stake must not be negative " +
+			"(%d zat)", stake)
+	}
+
+	if this.usedAccounts < len(this.premadeAccounts) {
+		ret = this.premadeAccounts[this.usedAccounts]
+		this.usedAccounts += 1
+
+		if !this.offline && (ret.balance < uint64(stake)) {
+			this.logger.Warnf("premade account %s has %d zat " +
+				"(less than stake %d)", ret.address,
+				ret.balance, stake)
+		}
+
+		return ret, nil
+	}
+
+	if this.offline {
+		// Like a minted account, a placeholder has no shielded
+		// address.
+		this.usedAccounts += 1
+		return &account{
+			address: fmt.Sprintf("offline-%d", this.usedAccounts),
+			key: "",
+			balance: uint64(stake),
+			utxos: make([]*utxo, 0),
+			shielded: nil,
+		}, nil
+	}
+
+	return this.mintAccount(stake)
+}
+
+func (this *BlockchainBuilder) CreateContract(name string) (interface{}, error) {
+	return nil, fmt.Errorf("zcash does not support contracts")
+}
+
+func (this *BlockchainBuilder) CreateResource(domain string) (core.SampleFactory, bool) {
+	if domain == "memo" {
+		return newMemoSampleFactory(), true
+	}
+
+	return nil, false
+}
+
+func (this *BlockchainBuilder) EncodeTransfer(amount int, from, to interface{}, info core.InteractionInfo) ([]byte, error) {
+	var tx *transferTransaction
+	var buffer bytes.Buffer
+	var inputs []*utxo
+	var fee uint64
+	var err error
+
+	if amount <= 0 {
+		return nil, fmt.Errorf("transfer amount must be positive " +
+			"(%d zat)", amount)
+	}
+
+	if this.spendUtxos {
+		inputs, fee, err = this.selectInputs(from.(*account),
+			uint64(amount), 2)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	tx = newTransferTransaction(this.nextTxuid, uint64(amount),
+		from.(*account).address, from.(*account).key,
+		to.(*account).address, fee, inputs)
+
+	err = tx.encode(&buffer)
+	if err != nil {
+		return nil, err
+	}
+
+	this.nextTxuid += 1
+
+	return buffer.Bytes(), nil
+}
+
+func (this *BlockchainBuilder) EncodeInvoke(from, to interface{}, function string, args []interface{}, info core.InteractionInfo) ([]byte, error) {
+	return nil, fmt.Errorf("zcash does not support contracts")
+}
+
+func (this *BlockchainBuilder) EncodeInteraction(itype string, expr core.BenchmarkExpression, info core.InteractionInfo) ([]byte, error) {
+	if itype == "fanout" {
+		return this.encodeFanout(expr, info)
+	}
+
+	if itype == "consolidate" {
+		return this.encodeConsolidate(expr, info)
+	}
+
+	if itype == "memo" {
+		return this.encodeMemo(expr, info)
+	}
+
+	return nil, fmt.Errorf("unknown interaction type '%s'", itype)
+}
+
+func parsePool(expr core.BenchmarkExpression) (bool, error) {
+	var field core.BenchmarkExpression
+	var pool string
+	var err error
+
+	field, err = expr.TryField("pool")
+	if err != nil {
+		return false, nil
+	}
+
+	pool, err = field.GetString()
+	if err != nil {
+		return false, err
+	}
+
+	if pool == "transparent" {
+		return false, nil
+	}
+
+	if pool == "shielded" {
+		return true, nil
+	}
+
+	return false, fmt.Errorf("%s: unknown pool '%s'",
+		field.FullPosition(), pool)
+}
+
+func parseCount(expr core.BenchmarkExpression, name string) (int, error) {
+	var count int
+	var err error
+
+	count, err = expr.Field(name).GetInt()
+	if err != nil {
+		return 0, err
+	}
+
+	if (count <= 0) || (count > 65535) {
+		return 0, fmt.Errorf("%s: must be between 1 and 65535",
+			expr.Field(name).FullPosition())
+	}
+
+	return count, nil
+}
+
+// Parse the optional `stake` field of the given expression in zatoshis.
+//
+func parseStake(expr core.BenchmarkExpression) (uint64, error) {
+	var field core.BenchmarkExpression
+	var stake int
+	var err error
+
+	field, err = expr.TryField("stake")
+	if err != nil {
+		return 1, nil
+	}
+
+	stake, err = field.GetInt()
+	if err != nil {
+		return 0, err
+	}
+
+	if stake <= 0 {
+		return 0, fmt.Errorf("%s: must be positive",
+			field.FullPosition())
+	}
+
+	return uint64(stake), nil
+}
+
+// Return the address of the given account in the given pool.
+//
+func poolAddress(expr core.BenchmarkExpression, acc *account, shielded bool) (string, string, error) {
+	if !shielded {
+		return acc.address, acc.key, nil
+	}
+
+	if acc.shielded == nil {
+		return "", "", fmt.Errorf("%s: account %s has no shielded " +
+			"address", expr.FullPosition(), acc.address)
+	}
+
+	return acc.shielded.address, acc.shielded.key, nil
+}
+
+// Encode a `!fanout` interaction:
+//
+//   !fanout
+//   from: <account>
+//   to: <account variable>      # drawn once per output
+//   outputs: <int>
+//   stake: <int>                # zatoshis per output, default 1
+//   pool: transparent|shielded  # default transparent
+//
+// Outputs drawn for the same recipient are merged into a single output.
+//
+func (this *BlockchainBuilder) encodeFanout(expr core.BenchmarkExpression, info core.InteractionInfo) ([]byte, error) {
+	var total, funded, fee, stake uint64
+	var address, from, key string
+	var offsets map[string]int
+	var payments []*payment
+	var sender, to interface{}
+	var tx *fanoutTransaction
+	var buffer bytes.Buffer
+	var outputs, i int
+	var shielded, ok bool
+	var inputs []*utxo
+	var err error
+
+	shielded, err = parsePool(expr)
+	if err != nil {
+		return nil, err
+	}
+
+	if shielded && this.spendUtxos {
+		return nil, fmt.Errorf("%s: shielded fanout requires the " +
+			"'wallet' prepare method", expr.FullPosition())
+	}
+
+	sender, err = expr.Field("from").GetResource("account")
+	if err != nil {
+		return nil, err
+	}
+
+	from, key, err = poolAddress(expr.Field("from"), sender.(*account),
+		shielded)
+	if err != nil {
+		return nil, err
+	}
+
+	outputs, err = parseCount(expr, "outputs")
+	if err != nil {
+		return nil, err
+	}
+
+	stake, err = parseStake(expr)
+	if err != nil {
+		return nil, err
+	}
+
+	offsets = make(map[string]int)
+	payments = make([]*payment, 0, outputs)
+
+	for i = 0; i < outputs; i++ {
+		to, err = expr.Field("to").GetResource("account")
+		if err != nil {
+			return nil, err
+		}
+
+		address, _, err = poolAddress(expr.Field("to"),
+			to.(*account), shielded)
+		if err != nil {
+			return nil, err
+		}
+
+		_, ok = offsets[address]
+		if !ok {
+			offsets[address] = len(payments)
+			payments = append(payments, &payment{
+				address: address,
+				amount: 0,
+			})
+		}
+
+		payments[offsets[address]].amount += stake
+		total += stake
+	}
+
+	info.SetProperty("outputs", len(payments))
+
+	if this.spendUtxos {
+		inputs, fee, err = this.selectInputs(sender.(*account), total,
+			len(payments) + 1)
+		if err != nil {
+			return nil, err
+		}
+
+		for i = range inputs {
+			funded += inputs[i].amount
+		}
+
+		if funded > (total + fee) {
+			info.SetProperty("outputs", len(payments) + 1)
+		}
+
+		info.SetProperty("inputs", len(inputs))
+	}
+
+	tx = newFanoutTransaction(this.nextTxuid, from, key, shielded,
+		payments, fee, inputs)
+
+	err = tx.encode(&buffer)
+	if err != nil {
+		return nil, err
+	}
+
+	this.nextTxuid += 1
+
+	return buffer.Bytes(), nil
+}
+
+// Encode a `!consolidate` interaction:
+//
+//   !consolidate
+//   from: <account>
+//   inputs: <int>
+//   pool: transparent|shielded  # default transparent
+//
+// With the "wallet" prepare method, the wallet merges up to `inputs` unspent
+// outputs or notes with z_mergetoaddress. Otherwise, the builder picks
+// exactly `inputs` unspent outputs and sends them back to the sender.
+//
+func (this *BlockchainBuilder) encodeConsolidate(expr core.BenchmarkExpression, info core.InteractionInfo) ([]byte, error) {
+	var sender, from, key string
+	var buffer bytes.Buffer
+	var total, fee uint64
+	var inputs []*utxo
+	var acc *account
+	var shielded bool
+	var res interface{}
+	var count int
+	var in *utxo
+	var err error
+
+	shielded, err = parsePool(expr)
+	if err != nil {
+		return nil, err
+	}
+
+	if shielded && this.spendUtxos {
+		return nil, fmt.Errorf("%s: shielded consolidate requires " +
+			"the 'wallet' prepare method", expr.FullPosition())
+	}
+
+	res, err = expr.Field("from").GetResource("account")
+	if err != nil {
+		return nil, err
+	}
+
+	acc = res.(*account)
+
+	from, key, err = poolAddress(expr.Field("from"), acc, shielded)
+	if err != nil {
+		return nil, err
+	}
+
+	count, err = parseCount(expr, "inputs")
+	if err != nil {
+		return nil, err
+	}
+
+	info.SetProperty("outputs", 1)
+
+	// The wallet merges up to `count` inputs so their number is only
+	// known when the builder picks them.
+	if !this.spendUtxos {
+		err = newConsolidateTransaction(this.nextTxuid, from, key,
+			shielded, count).encode(&buffer)
+		if err != nil {
+			return nil, err
+		}
+
+		this.nextTxuid += 1
+
+		return buffer.Bytes(), nil
+	}
+
+	sender = acc.address
+
+	if len(acc.utxos) < count {
+		return nil, fmt.Errorf("%s: account %s has only %d utxos left",
+			expr.FullPosition(), sender, len(acc.utxos))
+	}
+
+	inputs = acc.utxos[:count]
+	fee = conventionalFee(count, 1)
+
+	for _, in = range inputs {
+		total += in.amount
+	}
+
+	if total <= fee {
+		return nil, fmt.Errorf("%s: account %s cannot pay %d zat " +
+			"with %d utxos", expr.FullPosition(), sender, fee,
+			count)
+	}
+
+	acc.utxos = acc.utxos[count:]
+	acc.balance -= total
+
+	info.SetProperty("inputs", count)
+
+	err = newFanoutTransaction(this.nextTxuid, from, key, false,
+		[]*payment{ &payment{ address: from, amount: total - fee } },
+		fee, inputs).encode(&buffer)
+	if err != nil {
+		return nil, err
+	}
+
+	this.nextTxuid += 1
+
+	return buffer.Bytes(), nil
+}
+
+// Encode a `!memo` interaction:
+//
+//   !memo
+//   from: <account>
+//   to: <account>
+//   memo: <memo>
+//   stake: <int>                # zatoshis, default 1
+//
+// Both accounts must have a shielded address.
+//
+func (this *BlockchainBuilder) encodeMemo(expr core.BenchmarkExpression, info core.InteractionInfo) ([]byte, error) {
+	var from, key, to, tokey string
+	var sender, recipient interface{}
+	var buffer bytes.Buffer
+	var memo interface{}
+	var stake uint64
+	var err error
+
+	if this.spendUtxos {
+		return nil, fmt.Errorf("%s: memo requires the 'wallet' " +
+			"prepare method", expr.FullPosition())
+	}
+
+	sender, err = expr.Field("from").GetResource("account")
+	if err != nil {
+		return nil, err
+	}
+
+	from, key, err = poolAddress(expr.Field("from"), sender.(*account),
+		true)
+	if err != nil {
+		return nil, err
+	}
+
+	recipient, err = expr.Field("to").GetResource("account")
+	if err != nil {
+		return nil, err
+	}
+
+	to, tokey, err = poolAddress(expr.Field("to"), recipient.(*account),
+		true)
+	if err != nil {
+		return nil, err
+	}
+
+	memo, err = expr.Field("memo").GetResource("memo")
+	if err != nil {
+		return nil, err
+	}
+
+	stake, err = parseStake(expr)
+	if err != nil {
+		return nil, err
+	}
+
+	info.SetProperty("memo", len(memo.([]byte)))
+
+	err = newMemoTransaction(this.nextTxuid, stake, from, key, to,
+		tokey, memo.([]byte)).encode(&buffer)
+	if err != nil {
+		return nil, err
+	}
+
+	this.nextTxuid += 1
+
+	return buffer.Bytes(), nil
+}
@@ -0,0 +1,411 @@
+package nzcash
+
+
+import (
+	"bytes"
+	"diablo-benchmark/core"
+	"fmt"
+	"strings"
+	"testing"
+)
+
+
+// A benchmark expression built in memory.
+// Only the methods the builder uses are implemented, the other ones panic.
+// Each `Get` method returns the next of the given values in turn.
+//
+type testExpression struct {
+	core.BenchmarkExpression
+	position  string
+	fields    map[string]*testExpression
+	values    []interface{}
+	next      int
+}
+
+func newTestExpression(fields map[string]interface{}) *testExpression {
+	var this testExpression
+	var expr *testExpression
+	var value interface{}
+	var values []interface{}
+	var name string
+	var ok bool
+
+	this.position = "test"
+	this.fields = make(map[string]*testExpression)
+
+	for name, value = range fields {
+		values, ok = value.([]interface{})
+		if !ok {
+			values = []interface{}{ value }
+		}
+
+		expr, ok = value.(*testExpression)
+		if !ok {
+			expr = &testExpression{ values: values }
+		}
+
+		expr.position = "test." + name
+		this.fields[name] = expr
+	}
+
+	return &this
+}
+
+func (this *testExpression) Position() string {
+	return this.position
+}
+
+func (this *testExpression) FullPosition() string {
+	return "bench.yaml:" + this.position
+}
+
+func (this *testExpression) Field(name string) core.BenchmarkExpression {
+	var ret *testExpression
+	var ok bool
+
+	ret, ok = this.fields[name]
+	if !ok {
+		return &testExpression{ position: this.position + "." + name }
+	}
+
+	return ret
+}
+
+func (this *testExpression) TryField(name string) (core.BenchmarkExpression, error) {
+	var ret *testExpression
+	var ok bool
+
+	ret, ok = this.fields[name]
+	if !ok {
+		return nil, fmt.Errorf("%s: no field '%s'",
+			this.FullPosition(), name)
+	}
+
+	return ret, nil
+}
+
+func (this *testExpression) get() (interface{}, error) {
+	var ret interface{}
+
+	if len(this.values) == 0 {
+		return nil, fmt.Errorf("%s: no value", this.FullPosition())
+	}
+
+	ret = this.values[this.next % len(this.values)]
+	this.next += 1
+
+	return ret, nil
+}
+
+func (this *testExpression) GetResource(string) (interface{}, error) {
+	return this.get()
+}
+
+func (this *testExpression) GetInt() (int, error) {
+	var value interface{}
+	var err error
+
+	value, err = this.get()
+	if err != nil {
+		return 0, err
+	}
+
+	return value.(int), nil
+}
+
+func (this *testExpression) GetString() (string, error) {
+	var value interface{}
+	var err error
+
+	value, err = this.get()
+	if err != nil {
+		return "", err
+	}
+
+	return value.(string), nil
+}
+
+// The seed is the `seed` field if any, parsed like Diablo does, or 0 since
+// there is no master seed to draw from.
+//
+func (this *testExpression) Seed(string) (int64, error) {
+	var expr *testExpression
+	var value interface{}
+	var str string
+	var err error
+	var ok bool
+
+	expr, ok = this.fields["seed"]
+	if !ok {
+		return 0, nil
+	}
+
+	value, err = expr.get()
+	if err != nil {
+		return 0, err
+	}
+
+	str, ok = value.(string)
+	if ok {
+		return core.ParseSeed(str), nil
+	}
+
+	return int64(value.(int)), nil
+}
+
+
+type testInfo struct {
+	properties  map[string]int
+}
+
+func newTestInfo() *testInfo {
+	return &testInfo{ make(map[string]int) }
+}
+
+func (this *testInfo) Timestamp() float64 {
+	return 0
+}
+
+func (this *testInfo) SetProperty(name string, value int) {
+	this.properties[name] = value
+}
+
+
+func newTestAccount(name string, amounts ...uint64) *account {
+	var ret *account = &account{
+		address: "tm" + name,
+		key: "key" + name,
+		utxos: make([]*utxo, 0),
+		shielded: &shieldedAccount{
+			address: "zs" + name,
+			key: "zkey" + name,
+		},
+	}
+	var amount uint64
+	var i int
+
+	for i, amount = range amounts {
+		ret.balance += amount
+		ret.utxos = append(ret.utxos, &utxo{
+			txid: fmt.Sprintf("%s%d", name, i),
+			amount: amount,
+		})
+	}
+
+	return ret
+}
+
+func decodeTestTransaction(t *testing.T, encoded []byte, err error) transaction {
+	var ret transaction
+
+	if err != nil {
+		t.Fatalf("encode: %s", err.Error())
+	}
+
+	ret, err = decodeTransaction(bytes.NewReader(encoded))
+	if err != nil {
+		t.Fatalf("decode: %s", err.Error())
+	}
+
+	return ret
+}
+
+func TestEncodeFanoutOutputs(t *testing.T) {
+	var builder *BlockchainBuilder = newTestBuilder(false)
+	var a, b *account = newTestAccount("A"), newTestAccount("B")
+	var info *testInfo = newTestInfo()
+	var tx *fanoutTransaction
+	var encoded []byte
+	var err error
+
+	encoded, err = builder.EncodeInteraction("fanout",
+		newTestExpression(map[string]interface{}{
+			"from": newTestAccount("S"),
+			"to": []interface{}{ a, b, a },
+			"outputs": 3,
+			"stake": 1000,
+		}), info)
+
+	tx = decodeTestTransaction(t, encoded, err).(*fanoutTransaction)
+
+	if (len(tx.payments) != 2) || (info.properties["outputs"] != 2) {
+		t.Fatalf("got %d payments, %d outputs", len(tx.payments),
+			info.properties["outputs"])
+	}
+
+	if (tx.payments[0].address != "tmA") ||
+		(tx.payments[0].amount != 2000) ||
+		(tx.payments[1].address != "tmB") ||
+		(tx.payments[1].amount != 1000) {
+		t.Fatalf("got payments %v, %v", tx.payments[0],
+			tx.payments[1])
+	}
+
+	if (len(tx.inputs) != 0) || (tx.from != "tmS") || tx.shielded {
+		t.Fatalf("got %v", tx)
+	}
+}
+
+func TestEncodeFanoutInputs(t *testing.T) {
+	var builder *BlockchainBuilder = newTestBuilder(true)
+	var sender *account = newTestAccount("S", 10000, 10000, 10000)
+	var info *testInfo = newTestInfo()
+	var tx *fanoutTransaction
+	var encoded []byte
+	var err error
+
+	// Paying 2000 zat and a fee of 15000 zat for 3 outputs (change
+	// included) takes 2 of the 10000 zat inputs.
+	encoded, err = builder.EncodeInteraction("fanout",
+		newTestExpression(map[string]interface{}{
+			"from": sender,
+			"to": []interface{}{
+				newTestAccount("A"), newTestAccount("B"),
+			},
+			"outputs": 2,
+			"stake": 1000,
+		}), info)
+
+	tx = decodeTestTransaction(t, encoded, err).(*fanoutTransaction)
+
+	if (len(tx.inputs) != 2) || (info.properties["inputs"] != 2) {
+		t.Fatalf("got %d inputs, %d recorded", len(tx.inputs),
+			info.properties["inputs"])
+	}
+
+	if (len(tx.payments) != 2) || (info.properties["outputs"] != 3) {
+		t.Fatalf("got %d payments, %d outputs", len(tx.payments),
+			info.properties["outputs"])
+	}
+
+	if (tx.fee != 15000) || (len(sender.utxos) != 1) ||
+		(sender.balance != 10000) {
+		t.Fatalf("fee %d, %d utxos and %d zat left", tx.fee,
+			len(sender.utxos), sender.balance)
+	}
+}
+
+func TestEncodeConsolidate(t *testing.T) {
+	var sender *account = newTestAccount("S", 10000, 20000, 30000)
+	var consolidate *consolidateTransaction
+	var builder *BlockchainBuilder
+	var fanout *fanoutTransaction
+	var info *testInfo
+	var encoded []byte
+	var known bool
+	var err error
+
+	builder = newTestBuilder(false)
+	info = newTestInfo()
+
+	encoded, err = builder.EncodeInteraction("consolidate",
+		newTestExpression(map[string]interface{}{
+			"from": sender,
+			"inputs": 50,
+			"pool": "shielded",
+		}), info)
+
+	consolidate = decodeTestTransaction(t, encoded, err).
+		(*consolidateTransaction)
+
+	// The wallet merges up to 50 inputs: their number is unknown.
+	_, known = info.properties["inputs"]
+
+	if (consolidate.limit != 50) || !consolidate.shielded ||
+		(consolidate.from != "zsS") || known ||
+		(info.properties["outputs"] != 1) {
+		t.Fatalf("got %v, %v", consolidate, info.properties)
+	}
+
+	builder = newTestBuilder(true)
+	info = newTestInfo()
+
+	encoded, err = builder.EncodeInteraction("consolidate",
+		newTestExpression(map[string]interface{}{
+			"from": sender,
+			"inputs": 2,
+		}), info)
+
+	fanout = decodeTestTransaction(t, encoded, err).(*fanoutTransaction)
+
+	if (len(fanout.inputs) != 2) || (len(fanout.payments) != 1) ||
+		(info.properties["inputs"] != 2) ||
+		(info.properties["outputs"] != 1) {
+		t.Fatalf("got %d inputs and %d outputs", len(fanout.inputs),
+			len(fanout.payments))
+	}
+
+	if (fanout.payments[0].address != "tmS") ||
+		(fanout.payments[0].amount != 30000 - fanout.fee) ||
+		(len(sender.utxos) != 1) {
+		t.Fatalf("got payment %v", fanout.payments[0])
+	}
+
+	_, err = builder.EncodeInteraction("consolidate",
+		newTestExpression(map[string]interface{}{
+			"from": sender,
+			"inputs": 2,
+		}), newTestInfo())
+	if err == nil {
+		t.Fatalf("consolidated more utxos than left")
+	}
+}
+
+func TestEncodeNegativeStake(t *testing.T) {
+	var builder *BlockchainBuilder = newTestBuilder(false)
+	var fields map[string]interface{}
+	var itype string
+	var err error
+
+	for _, itype = range []string{ "fanout", "memo" } {
+		fields = map[string]interface{}{
+			"from": newTestAccount("S"),
+			"to": newTestAccount("A"),
+			"memo": []byte("hello"),
+			"outputs": 1,
+			"stake": -1,
+		}
+
+		_, err = builder.EncodeInteraction(itype,
+			newTestExpression(fields), newTestInfo())
+		if (err == nil) ||
+			!strings.Contains(err.Error(), "bench.yaml:test.stake") {
+			t.Fatalf("%s: got %v", itype, err)
+		}
+	}
+
+	_, err = builder.EncodeTransfer(-1, newTestAccount("S"),
+		newTestAccount("A"), newTestInfo())
+	if err == nil {
+		t.Fatalf("transfer: negative amount encoded")
+	}
+}
+
+func TestCreateAccountNegativeStake(t *testing.T) {
+	var builder *BlockchainBuilder
+	var err error
+
+	// A premade account, a placeholder and a minted account.
+	builder = newTestBuilder(false)
+	builder.premadeAccounts = []*account{ newTestAccount("A") }
+	builder.offline = true
+
+	_, err = builder.CreateAccount(-5)
+	if err == nil {
+		t.Fatalf("premade account created with a negative stake")
+	}
+
+	builder.usedAccounts = 1
+
+	_, err = builder.CreateAccount(-5)
+	if err == nil {
+		t.Fatalf("placeholder account created with a negative stake")
+	}
+
+	builder.offline = false
+
+	_, err = builder.CreateAccount(-5)
+	if err == nil {
+		t.Fatalf("minted account created with a negative stake")
+	}
+}
@@ -0,0 +1,575 @@
+package nzcash
+
+
+import (
+	"bytes"
+	"diablo-benchmark/core"
+	"sync"
+	"time"
+)
+
+
+type BlockchainClient struct {
+	logger     core.Logger
+	node       *node
+	keys       *keyring
+	preparer   transactionPreparer
+	confirmer  transactionConfirmer
+	receiver   transactionConfirmer
+}
+
+func newClient(logger core.Logger, node *node, keys *keyring, preparer transactionPreparer, confirmer transactionConfirmer, receiver transactionConfirmer) *BlockchainClient {
+	return &BlockchainClient{
+		logger: logger,
+		node: node,
+		keys: keys,
+		preparer: preparer,
+		confirmer: confirmer,
+		receiver: receiver,
+	}
+}
+
+func (this *BlockchainClient) DecodePayload(encoded []byte) (interface{}, error) {
+	var buffer *bytes.Buffer = bytes.NewBuffer(encoded)
+	var address, key string
+	var memo *memoTransaction
+	var tx transaction
+	var err error
+	var ok bool
+
+	tx, err = decodeTransaction(buffer)
+	if err != nil {
+		return nil, err
+	}
+
+	this.logger.Tracef("decode transaction %d", tx.getUid())
+
+	err = this.preparer.prepare(tx)
+	if err != nil {
+		return nil, err
+	}
+
+	// The recipient of a memo must be able to decrypt it to check its
+	// delivery.
+	memo, ok = tx.(*memoTransaction)
+	if ok {
+		address, key = memo.getRecipient()
+
+		err = this.keys.importKey(address, key, true)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	return tx, nil
+}
+
+func (this *BlockchainClient) TriggerInteraction(iact core.Interaction) error {
+	var tx transaction
+	var txid string
+	var err error
+	var ok bool
+
+	tx = iact.Payload().(transaction)
+
+	this.logger.Tracef("submit transaction %d", tx.getUid())
+
+	iact.ReportSubmit()
+
+	txid, err = this.preparer.submit(tx)
+	if err != nil {
+		iact.ReportAbort()
+		return err
+	}
+
+	_, ok = tx.(*memoTransaction)
+	if ok {
+		return this.receiver.confirm(iact, txid)
+	}
+
+	return this.confirmer.confirm(iact, txid)
+}
+
+
+type transactionPreparer interface {
+	// Do what can be done for the given transaction before the benchmark
+	// starts.
+	//
+	prepare(transaction) error
+
+	// Send the given transaction and return its txid.
+	//
+	submit(transaction) (string, error)
+}
+
+
+// The keys imported in the wallet of a zcashd node.
+// Keys are imported once per client, before the benchmark starts.
+//
+type keyring struct {
+	logger    core.Logger
+	node      *node
+	lock      sync.Mutex
+	imported  map[string]bool
+}
+
+func newKeyring(logger core.Logger, node *node) *keyring {
+	return &keyring{
+		logger: logger,
+		node: node,
+		imported: make(map[string]bool),
+	}
+}
+
+// Make sure the wallet of the node owns the key of the given address.
+//
+func (this *keyring) importKey(address, key string, shielded bool) error {
+	var mine bool
+	var err error
+
+	this.lock.Lock()
+	defer this.lock.Unlock()
+
+	if this.imported[address] {
+		return nil
+	}
+
+	if shielded {
+		mine, err = this.node.zIsMine(address)
+	} else {
+		mine, err = this.node.isMine(address)
+	}
+
+	if err != nil {
+		return err
+	}
+
+	if !mine {
+		this.logger.Tracef("import key for %s", address)
+
+		if shielded {
+			err = this.node.zImportKey(key, true)
+		} else {
+			err = this.node.importPrivKey(key, true)
+		}
+
+		if err != nil {
+			return err
+		}
+	}
+
+	this.imported[address] = true
+
+	return nil
+}
+
+
+type walletTransactionPreparer struct {
+	node  *node
+	keys  *keyring
+}
+
+func newWalletTransactionPreparer(node *node, keys *keyring) *walletTransactionPreparer {
+	return &walletTransactionPreparer{
+		node: node,
+		keys: keys,
+	}
+}
+
+// Make sure the wallet of the client node can spend from the sender of the
+// given transaction.
+//
+func (this *walletTransactionPreparer) prepare(tx transaction) error {
+	var address, key string
+	var shielded bool
+
+	address, key, shielded = tx.getSender()
+
+	return this.keys.importKey(address, key, shielded)
+}
+
+func (this *walletTransactionPreparer) submit(tx transaction) (string, error) {
+	return tx.submit(this.node)
+}
+
+
+type signTransactionPreparer struct {
+	node  *node
+}
+
+func newSignTransactionPreparer(node *node) *signTransactionPreparer {
+	return &signTransactionPreparer{
+		node: node,
+	}
+}
+
+func (this *signTransactionPreparer) prepare(transaction) error {
+	return nil
+}
+
+func (this *signTransactionPreparer) submit(tx transaction) (string, error) {
+	var raw string
+	var err error
+
+	raw, err = tx.getRaw(this.node)
+	if err != nil {
+		return "", err
+	}
+
+	return this.node.sendRawTransaction(raw)
+}
+
+
+type presignTransactionPreparer struct {
+	logger  core.Logger
+	node    *node
+}
+
+func newPresignTransactionPreparer(logger core.Logger, node *node) *presignTransactionPreparer {
+	return &presignTransactionPreparer{
+		logger: logger,
+		node: node,
+	}
+}
+
+func (this *presignTransactionPreparer) prepare(tx transaction) error {
+	var err error
+
+	this.logger.Tracef("sign transaction %d", tx.getUid())
+
+	_, err = tx.getRaw(this.node)
+
+	return err
+}
+
+func (this *presignTransactionPreparer) submit(tx transaction) (string, error) {
+	var raw string
+	var err error
+
+	raw, err = tx.getRaw(this.node)
+	if err != nil {
+		return "", err
+	}
+
+	return this.node.sendRawTransaction(raw)
+}
+
+
+type transactionConfirmer interface {
+	confirm(core.Interaction, string) error
+}
+
+
+type polltxTransactionConfirmer struct {
+	logger  core.Logger
+	node    *node
+	delay   time.Duration
+}
+
+func newPolltxTransactionConfirmer(logger core.Logger, node *node, delay time.Duration) *polltxTransactionConfirmer {
+	return &polltxTransactionConfirmer{
+		logger: logger,
+		node: node,
+		delay: delay,
+	}
+}
+
+func (this *polltxTransactionConfirmer) confirm(iact core.Interaction, txid string) error {
+	var tx transaction = iact.Payload().(transaction)
+	var info *nodeTransaction
+	var err error
+
+	for {
+		info, err = this.node.getTransaction(txid)
+		if err != nil {
+			return err
+		}
+
+		if info.Confirmations < 0 {
+			this.logger.Tracef("transaction %d aborted",
+				tx.getUid())
+			iact.ReportAbort()
+			return nil
+		}
+
+		if info.Confirmations > 0 {
+			this.logger.Tracef("transaction %d committed",
+				tx.getUid())
+			iact.ReportCommit()
+			return nil
+		}
+
+		time.Sleep(this.delay)
+	}
+}
+
+
+// Confirm memo transactions once the recipient wallet received the memo
+// intact in a committed block.
+//
+type memoTransactionConfirmer struct {
+	logger  core.Logger
+	node    *node
+	delay   time.Duration
+}
+
+func newMemoTransactionConfirmer(logger core.Logger, node *node, delay time.Duration) *memoTransactionConfirmer {
+	return &memoTransactionConfirmer{
+		logger: logger,
+		node: node,
+		delay: delay,
+	}
+}
+
+func (this *memoTransactionConfirmer) confirm(iact core.Interaction, txid string) error {
+	var tx *memoTransaction = iact.Payload().(*memoTransaction)
+	var received []nodeReceived
+	var info *nodeTransaction
+	var address string
+	var err error
+	var i int
+
+	address, _ = tx.getRecipient()
+
+	for {
+		received, err = this.node.zListReceivedByAddress(address, 1)
+		if err != nil {
+			return err
+		}
+
+		for i = range received {
+			if received[i].Txid != txid {
+				continue
+			}
+
+			if tx.checkMemo(received[i].Memo) {
+				this.logger.Tracef("transaction %d delivered",
+					tx.getUid())
+				iact.ReportCommit()
+				return nil
+			}
+
+			this.logger.Warnf("transaction %d delivered with " +
+				"corrupted memo", tx.getUid())
+			iact.ReportAbort()
+			return nil
+		}
+
+		info, err = this.node.getTransaction(txid)
+		if err != nil {
+			return err
+		}
+
+		if info.Confirmations < 0 {
+			this.logger.Tracef("transaction %d aborted",
+				tx.getUid())
+			iact.ReportAbort()
+			return nil
+		}
+
+		time.Sleep(this.delay)
+	}
+}
+
+
+// How long a committed txid which is not pending is remembered.
+// This covers the transactions committed in a block polled before their
+// submission returns while bounding the memory used for the transactions of
+// other clients. It is much longer than a wallet operation can take (see
+// `operationTimeout`) so a slow submission still finds its commit.
+//
+const pollblkSeenDuration time.Duration = 10 * time.Minute
+
+type pollblkTransactionConfirmer struct {
+	logger    core.Logger
+	node      *node
+	delay     time.Duration
+	err       error
+	lock      sync.Mutex
+	pendings  map[string]*pollblkTransactionConfirmerPending
+	seen      map[string]time.Time  // when committed and not pending
+}
+
+type pollblkTransactionConfirmerPending struct {
+	channel  chan<- error
+	iact     core.Interaction
+}
+
+func newPollblkTransactionConfirmer(logger core.Logger, node *node, delay time.Duration) *pollblkTransactionConfirmer {
+	var this pollblkTransactionConfirmer
+
+	this.logger = logger
+	this.node = node
+	this.delay = delay
+	this.err = nil
+	this.pendings = make(map[string]*pollblkTransactionConfirmerPending)
+	this.seen = make(map[string]time.Time)
+
+	go this.run()
+
+	return &this
+}
+
+func (this *pollblkTransactionConfirmer) confirm(iact core.Interaction, txid string) error {
+	var pending *pollblkTransactionConfirmerPending
+	var channel chan error
+	var done, committed bool
+
+	channel = make(chan error)
+
+	pending = &pollblkTransactionConfirmerPending{
+		channel: channel,
+		iact: iact,
+	}
+
+	this.lock.Lock()
+
+	if this.pendings == nil {
+		done = true
+	} else {
+		_, committed = this.seen[txid]
+
+		if committed {
+			// The transaction was committed in a block polled
+			// before the submission returned.
+			delete(this.seen, txid)
+		} else {
+			this.pendings[txid] = pending
+		}
+	}
+
+	this.lock.Unlock()
+
+	if committed {
+		this.logger.Tracef("transaction %d committed",
+			iact.Payload().(transaction).getUid())
+		iact.ReportCommit()
+		return nil
+	} else if done {
+		close(channel)
+		return this.err
+	} else {
+		return <- channel
+	}
+}
+
+func (this *pollblkTransactionConfirmer) reportTransactions(txids []string) {
+	var pendings []*pollblkTransactionConfirmerPending
+	var pending *pollblkTransactionConfirmerPending
+	var now, seen time.Time
+	var txid string
+	var ok bool
+
+	pendings = make([]*pollblkTransactionConfirmerPending, 0, len(txids))
+	now = time.Now()
+
+	this.lock.Lock()
+
+	for txid, seen = range this.seen {
+		if now.Sub(seen) > pollblkSeenDuration {
+			delete(this.seen, txid)
+		}
+	}
+
+	for _, txid = range txids {
+		pending, ok = this.pendings[txid]
+		if !ok {
+			this.seen[txid] = now
+			continue
+		}
+
+		delete(this.pendings, txid)
+
+		pendings = append(pendings, pending)
+	}
+
+	this.lock.Unlock()
+
+	for _, pending = range pendings {
+		pending.iact.ReportCommit()
+	}
+
+	for _, pending = range pendings {
+		this.logger.Tracef("transaction %d committed",
+			pending.iact.Payload().(transaction).getUid())
+
+		pending.channel <- nil
+
+		close(pending.channel)
+	}
+}
+
+func (this *pollblkTransactionConfirmer) flushPendings(err error) {
+	var pendings []*pollblkTransactionConfirmerPending
+	var pending *pollblkTransactionConfirmerPending
+
+	pendings = make([]*pollblkTransactionConfirmerPending, 0)
+
+	this.lock.Lock()
+
+	for _, pending = range this.pendings {
+		pendings = append(pendings, pending)
+	}
+
+	this.pendings = nil
+	this.err = err
+
+	this.lock.Unlock()
+
+	for _, pending = range pendings {
+		pending.iact.ReportAbort()
+
+		this.logger.Tracef("transaction %d aborted",
+			pending.iact.Payload().(transaction).getUid())
+
+		pending.channel <- err
+
+		close(pending.channel)
+	}
+}
+
+func (this *pollblkTransactionConfirmer) run() {
+	var txids []string = make([]string, 0)
+	var height, last int64
+	var block *nodeBlock
+	var err error
+
+	height, err = this.node.getBlockCount()
+	if err != nil {
+		this.flushPendings(err)
+		return
+	}
+
+	this.logger.Tracef("start polling block at height %d", height + 1)
+
+	for {
+		time.Sleep(this.delay)
+
+		last, err = this.node.getBlockCount()
+		if err != nil {
+			break
+		}
+
+		txids = txids[:0]
+
+		for height < last {
+			this.logger.Tracef("poll block at height %d",
+				height + 1)
+
+			block, err = this.node.getBlock(height + 1)
+			if err != nil {
+				this.logger.Warnf("block polling failed: %s",
+					err.Error())
+				break
+			}
+
+			txids = append(txids, block.Tx...)
+
+			height += 1
+		}
+
+		this.reportTransactions(txids)
+	}
+
+	this.flushPendings(err)
+}
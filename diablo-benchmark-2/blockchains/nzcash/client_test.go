@@ -0,0 +1,102 @@
+package nzcash
+
+
+import (
+	"testing"
+	"time"
+)
+
+
+type testInteraction struct {
+	payload    transaction
+	committed  bool
+	aborted    bool
+}
+
+func (this *testInteraction) Payload() interface{} {
+	return this.payload
+}
+
+func (this *testInteraction) ReportSubmit() {
+}
+
+func (this *testInteraction) ReportCommit() {
+	this.committed = true
+}
+
+func (this *testInteraction) ReportAbort() {
+	this.aborted = true
+}
+
+
+// Return a block polling confirmer which does not poll any node.
+//
+func newTestPollblkConfirmer() *pollblkTransactionConfirmer {
+	return &pollblkTransactionConfirmer{
+		logger: newTestBuilder(false).logger,
+		pendings: make(map[string]*pollblkTransactionConfirmerPending),
+		seen: make(map[string]time.Time),
+	}
+}
+
+func TestPollblkCommittedBeforeConfirm(t *testing.T) {
+	var confirmer *pollblkTransactionConfirmer
+	var iact *testInteraction
+	var err error
+
+	confirmer = newTestPollblkConfirmer()
+	iact = &testInteraction{
+		payload: newConsolidateTransaction(1, "tmA", "keyA", false, 1),
+	}
+
+	confirmer.reportTransactions([]string{ "txid" })
+
+	err = confirmer.confirm(iact, "txid")
+	if (err != nil) || !iact.committed {
+		t.Fatalf("transaction not committed: %v", err)
+	}
+
+	if len(confirmer.seen) != 0 {
+		t.Fatalf("%d txids still seen", len(confirmer.seen))
+	}
+}
+
+func TestPollblkCommittedLongBeforeConfirm(t *testing.T) {
+	var confirmer *pollblkTransactionConfirmer
+	var iact *testInteraction
+	var err error
+	var i int
+
+	confirmer = newTestPollblkConfirmer()
+	iact = &testInteraction{
+		payload: newConsolidateTransaction(1, "tmA", "keyA", false, 1),
+	}
+
+	confirmer.reportTransactions([]string{ "txid" })
+
+	// The submission returns after many block polls.
+	for i = 0; i < 1000; i++ {
+		confirmer.reportTransactions([]string{})
+	}
+
+	err = confirmer.confirm(iact, "txid")
+	if (err != nil) || !iact.committed {
+		t.Fatalf("transaction not committed: %v", err)
+	}
+}
+
+func TestPollblkSeenBounded(t *testing.T) {
+	var confirmer *pollblkTransactionConfirmer
+
+	confirmer = newTestPollblkConfirmer()
+
+	confirmer.reportTransactions([]string{ "coinbase", "other" })
+	confirmer.seen["old"] = time.Now().Add(-pollblkSeenDuration -
+		time.Second)
+
+	confirmer.reportTransactions([]string{ "late" })
+
+	if (len(confirmer.seen) != 3) || !confirmer.seen["old"].IsZero() {
+		t.Fatalf("got seen txids %v", confirmer.seen)
+	}
+}
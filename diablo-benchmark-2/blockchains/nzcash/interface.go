@@ -0,0 +1,454 @@
+//
+// Parameters:
+//
+//   user     - User name to authenticate with on the RPC interface of the
+//              zcashd nodes. Default is an empty string.
+//
+//   password - Password to authenticate with on the RPC interface of the
+//              zcashd nodes. Default is an empty string.
+//
+//   poll     - Delay in seconds between two polls of the zcashd node to check
+//              if a submitted transaction has been committed. Default is 0.5.
+//
+//   sample   - Delay in seconds between two samples of the chain state taken
+//              by the builder during the benchmark: value pools, note
+//              commitment tree sizes, mempool size and every new block. The
+//              samples are attached to the results under "Chain". Use 0 to
+//              disable sampling. Default is 1.
+//
+//   confirm  - Indicate how the client check that a submitted transaction has
+//              been committed. Can be one of "polltx" or "pollblk".
+//
+//              polltx  - Poll the wallet of the zcashd node once for each
+//                        submitted transaction. Only works with the "wallet"
+//                        prepare method since other methods do not import
+//                        keys in the wallet.
+//
+//              pollblk - Poll the zcashd node once for all transactions by
+//                        parsing the new blocks. This is the default value.
+//
+//   prepare  - Indicate how transactions are built and signed. Can be one of
+//              "wallet", "sign-at-trigger" or "presigned".
+//
+//              wallet          - The wallet of the zcashd node selects the
+//                                inputs, builds and signs the transaction
+//                                with z_sendmany when the interaction is
+//                                triggered. Keys are imported in the wallet
+//                                before the benchmark starts. This is the
+//                                most realistic option and the default value.
+//
+//              sign-at-trigger - The builder selects the inputs of every
+//                                transaction. The client builds and signs the
+//                                raw transaction with the explicit key of the
+//                                sender when the interaction is triggered.
+//
+//              presigned       - Like sign-at-trigger but the transactions
+//                                are signed before the benchmark starts so
+//                                only sendrawtransaction is measured.
+//
+//              The sign-at-trigger and presigned methods pay the ZIP-317
+//              conventional fee. Since the builder selects the inputs, each
+//              unspent output of an account funds at most one transfer.
+//
+// Environment:
+//
+//   accounts - Path of a YAML file listing premade accounts. These accounts
+//              are used before the builder mints new ones (which is only
+//              possible on regtest). Each account is a transparent address
+//              with its WIF encoded private key and optionally a shielded
+//              (Sapling or Unified) address with its spending key:
+//
+//                - address: tmXXX...
+//                  key: cXXX...
+//                  shielded:
+//                    address: zregtestsapling1XXX...
+//                    key: secret-extended-key-regtest1XXX...
+//
+//              The builder imports the keys in the wallet of its node and
+//              discovers the balance and unspent outputs of every account
+//              before the benchmark is parsed.
+//
+// Interactions:
+//
+//   fanout      - Pay many recipients in a single transaction. The "outputs"
+//                 field indicates how many times the "to" account variable is
+//                 drawn and "stake" how much each output pays.
+//
+//   consolidate - Merge "inputs" unspent outputs (or notes) of the "from"
+//                 account into one. With the "wallet" prepare method, the
+//                 zcashd node must run with -experimentalfeatures and
+//                 -zmergetoaddress.
+//
+//   Both accept a "pool" field which is either "transparent" (the default) or
+//   "shielded". Shielded interactions require the "wallet" prepare method.
+//   The results record the number of "inputs" (when known before the
+//   benchmark) and "outputs" of each of these interactions.
+//
+//   memo        - Send "stake" zatoshis with a memo from the shielded address
+//                 of the "from" account to the shielded address of the "to"
+//                 account. The "memo" field is a variable of the "memo"
+//                 domain (see memo.go). The client imports the key of the
+//                 recipient and reports the commit once the recipient wallet
+//                 decrypted the intact memo from a committed block. Requires
+//                 the "wallet" prepare method.
+//
+// Amounts (the stake of accounts and transfers) are expressed in zatoshis.
+//
+
+
+package nzcash
+
+
+import (
+	"diablo-benchmark/core"
+	"fmt"
+	"gopkg.in/yaml.v3"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+)
+
+
+type BlockchainInterface struct {
+}
+
+
+func (this *BlockchainInterface) Builder(params map[string]string, env []string, endpoints map[string][]string, logger core.Logger) (core.BlockchainBuilder, error) {
+	var endpoint, key, value, user, password string
+	var builder *BlockchainBuilder
+	var envmap map[string][]string
+	var interval time.Duration
+	var seconds float64
+	var node *node
+	var err error
+	var ok bool
+
+	logger.Debugf("new builder")
+
+	envmap, err = parseEnvmap(env)
+	if err != nil {
+		return nil, err
+	}
+
+	user, password = parseCredentials(params)
+
+	value, ok = params["prepare"]
+	if ok {
+		_, err = parsePrepare(value, logger, nil, nil)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	for key = range endpoints {
+		endpoint = key
+		break
+	}
+
+	logger.Debugf("use endpoint '%s'", endpoint)
+	node, err = newNode(endpoint, user, password)
+	if err != nil {
+		return nil, err
+	}
+
+	builder = newBuilder(logger, node, ok && (value != "wallet"))
+
+	interval = time.Second
+
+	value, ok = params["sample"]
+	if ok {
+		seconds, err = strconv.ParseFloat(value, 64)
+		if (err != nil) || (seconds < 0) {
+			return nil, fmt.Errorf("invalid sample parameter: " +
+				"'%s'", value)
+		}
+
+		interval = time.Duration(seconds * float64(time.Second))
+	}
+
+	if interval > 0 {
+		logger.Debugf("sample chain every %s", interval)
+		builder.sampler = newChainSampler(logger, node, interval)
+	}
+
+	err = addEnvAccounts(builder, envmap, logger)
+	if err != nil {
+		return nil, err
+	}
+
+	err = builder.discoverAccounts()
+	if err != nil {
+		return nil, err
+	}
+
+	return builder, nil
+}
+
+// Create a builder which never contacts the zcashd nodes to plan or check a
+// benchmark.
+// The premade accounts are used as is since their balance cannot be
+// discovered and the builder creates placeholder accounts instead of minting
+// new ones. Whatever the prepare method is, the builder does not select the
+// inputs of transactions.
+//
+func (this *BlockchainInterface) OfflineBuilder(params map[string]string, env []string, endpoints map[string][]string, logger core.Logger) (core.BlockchainBuilder, error) {
+	var builder *BlockchainBuilder
+	var envmap map[string][]string
+	var value string
+	var err error
+	var ok bool
+
+	logger.Debugf("new offline builder")
+
+	envmap, err = parseEnvmap(env)
+	if err != nil {
+		return nil, err
+	}
+
+	value, ok = params["prepare"]
+	if ok {
+		_, err = parsePrepare(value, logger, nil, nil)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	builder = newBuilder(logger, nil, false)
+	builder.offline = true
+
+	err = addEnvAccounts(builder, envmap, logger)
+	if err != nil {
+		return nil, err
+	}
+
+	return builder, nil
+}
+
+
+func parseEnvmap(env []string) (map[string][]string, error) {
+	var ret map[string][]string = make(map[string][]string)
+	var element, key, value string
+	var values []string
+	var eqindex int
+	var found bool
+
+	for _, element = range env {
+		eqindex = strings.Index(element, "=")
+		if eqindex < 0 {
+			return nil, fmt.Errorf("unexpected environment '%s'",
+				element)
+		}
+
+		key = element[:eqindex]
+		value = element[eqindex + 1:]
+
+		values, found = ret[key]
+		if !found {
+			values = make([]string, 0)
+		}
+
+		values = append(values, value)
+
+		ret[key] = values
+	}
+
+	return ret, nil
+}
+
+func addEnvAccounts(builder *BlockchainBuilder, envmap map[string][]string, logger core.Logger) error {
+	var key, value string
+	var values []string
+	var err error
+
+	for key, values = range envmap {
+		if key == "accounts" {
+			for _, value = range values {
+				logger.Debugf("with accounts from '%s'", value)
+
+				err = addPremadeAccounts(builder, value)
+				if err != nil {
+					return err
+				}
+			}
+
+			continue
+		}
+
+		return fmt.Errorf("unknown environment key '%s'", key)
+	}
+
+	return nil
+}
+
+func parseCredentials(params map[string]string) (string, string) {
+	return params["user"], params["password"]
+}
+
+func parsePrepare(value string, logger core.Logger, node *node, keys *keyring) (transactionPreparer, error) {
+	if value == "wallet" {
+		return newWalletTransactionPreparer(node, keys), nil
+	}
+
+	if value == "sign-at-trigger" {
+		return newSignTransactionPreparer(node), nil
+	}
+
+	if value == "presigned" {
+		return newPresignTransactionPreparer(logger, node), nil
+	}
+
+	return nil, fmt.Errorf("unknown prepare method '%s'", value)
+}
+
+func parseConfirm(value string, logger core.Logger, node *node, delay time.Duration) (transactionConfirmer, error) {
+	if value == "polltx" {
+		return newPolltxTransactionConfirmer(logger, node, delay), nil
+	}
+
+	if value == "pollblk" {
+		return newPollblkTransactionConfirmer(logger, node, delay), nil
+	}
+
+	return nil, fmt.Errorf("unknown confirm method '%s'", value)
+}
+
+
+type yamlAccount struct {
+	Address   string               `yaml:"address"`
+	Key       string               `yaml:"key"`
+	Shielded  *yamlShieldedAccount `yaml:"shielded"`
+}
+
+type yamlShieldedAccount struct {
+	Address  string  `yaml:"address"`
+	Key      string  `yaml:"key"`
+}
+
+func addPremadeAccounts(builder *BlockchainBuilder, path string) error {
+	var shielded *shieldedAccount
+	var decoder *yaml.Decoder
+	var ret []*yamlAccount
+	var acc *yamlAccount
+	var file *os.File
+	var err error
+
+	file, err = os.Open(path)
+	if err != nil {
+		return err
+	}
+
+	decoder = yaml.NewDecoder(file)
+	err = decoder.Decode(&ret)
+
+	file.Close()
+
+	if err != nil {
+		return err
+	}
+
+	for _, acc = range ret {
+		if (acc.Address == "") || (acc.Key == "") {
+			return fmt.Errorf("%s: account must have an address " +
+				"and a key", path)
+		}
+
+		shielded = nil
+
+		if acc.Shielded != nil {
+			if (acc.Shielded.Address == "") ||
+				(acc.Shielded.Key == "") {
+				return fmt.Errorf("%s: shielded account of " +
+					"%s must have an address and a key",
+					path, acc.Address)
+			}
+
+			shielded = &shieldedAccount{
+				address: acc.Shielded.Address,
+				key: acc.Shielded.Key,
+			}
+		}
+
+		builder.addAccount(acc.Address, acc.Key, shielded)
+	}
+
+	return nil
+}
+
+
+func (this *BlockchainInterface) Client(params map[string]string, env, view []string, logger core.Logger) (core.BlockchainClient, error) {
+	var key, value, user, password, prepare, confirm string
+	var confirmer, receiver transactionConfirmer
+	var preparer transactionPreparer
+	var delay time.Duration
+	var seconds float64
+	var keys *keyring
+	var node *node
+	var err error
+
+	logger.Tracef("new client")
+
+	user, password = parseCredentials(params)
+	delay = 500 * time.Millisecond
+	prepare = "wallet"
+	confirm = "pollblk"
+
+	for key, value = range params {
+		if (key == "user") || (key == "password") ||
+			(key == "sample") {
+			continue
+		}
+
+		if key == "poll" {
+			seconds, err = strconv.ParseFloat(value, 64)
+			if (err != nil) || (seconds <= 0) {
+				return nil, fmt.Errorf("invalid poll " +
+					"parameter: '%s'", value)
+			}
+
+			delay = time.Duration(seconds * float64(time.Second))
+			continue
+		}
+
+		if key == "prepare" {
+			prepare = value
+			continue
+		}
+
+		if key == "confirm" {
+			confirm = value
+			continue
+		}
+
+		return nil, fmt.Errorf("unknown parameter '%s'", key)
+	}
+
+	if (confirm == "polltx") && (prepare != "wallet") {
+		return nil, fmt.Errorf("confirm method 'polltx' requires " +
+			"prepare method 'wallet'")
+	}
+
+	logger.Tracef("use endpoint '%s'", view[0])
+	node, err = newNode(view[0], user, password)
+	if err != nil {
+		return nil, err
+	}
+
+	logger.Tracef("use prepare method '%s'", prepare)
+	keys = newKeyring(logger, node)
+
+	preparer, err = parsePrepare(prepare, logger, node, keys)
+	if err != nil {
+		return nil, err
+	}
+
+	logger.Tracef("use confirm method '%s'", confirm)
+	confirmer, err = parseConfirm(confirm, logger, node, delay)
+	if err != nil {
+		return nil, err
+	}
+
+	receiver = newMemoTransactionConfirmer(logger, node, delay)
+
+	return newClient(logger, node, keys, preparer, confirmer, receiver), nil
+}
@@ -0,0 +1,139 @@
+package nzcash
+
+
+import (
+	"diablo-benchmark/core"
+	"io/ioutil"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+
+func newTestBuilder(spendUtxos bool) *BlockchainBuilder {
+	return newBuilder(core.NewPrintLogger(ioutil.Discard, "test",
+		core.LOG_SILENT), nil, spendUtxos)
+}
+
+func writeTestAccounts(t *testing.T, content string) string {
+	var path string = filepath.Join(t.TempDir(), "accounts.yaml")
+	var err error
+
+	err = ioutil.WriteFile(path, []byte(content), 0644)
+	if err != nil {
+		t.Fatalf("write %s: %s", path, err.Error())
+	}
+
+	return path
+}
+
+func TestPremadeAccounts(t *testing.T) {
+	var builder *BlockchainBuilder = newTestBuilder(false)
+	var err error
+
+	err = addPremadeAccounts(builder, writeTestAccounts(t, `
+- address: "tmA"
+  key: "keyA"
+- address: "tmB"
+  key: "keyB"
+  shielded:
+    address: "zsB"
+    key: "zkeyB"
+`))
+	if err != nil {
+		t.Fatalf("parse: %s", err.Error())
+	}
+
+	if len(builder.premadeAccounts) != 2 {
+		t.Fatalf("parsed %d accounts", len(builder.premadeAccounts))
+	}
+
+	if (builder.premadeAccounts[0].address != "tmA") ||
+		(builder.premadeAccounts[0].key != "keyA") ||
+		(builder.premadeAccounts[0].shielded != nil) {
+		t.Fatalf("account 0: got %v", builder.premadeAccounts[0])
+	}
+
+	if (builder.premadeAccounts[1].address != "tmB") ||
+		(builder.premadeAccounts[1].shielded == nil) ||
+		(builder.premadeAccounts[1].shielded.address != "zsB") ||
+		(builder.premadeAccounts[1].shielded.key != "zkeyB") {
+		t.Fatalf("account 1: got %v", builder.premadeAccounts[1])
+	}
+}
+
+func TestPremadeAccountsInvalid(t *testing.T) {
+	var contents []string = []string{
+		"- address: \"tmA\"\n",
+		"- key: \"keyA\"\n",
+		"- address: \"tmA\"\n  key: \"keyA\"\n  shielded:\n" +
+			"    address: \"zsA\"\n",
+		"address: \"tmA\"\n",
+	}
+	var path string
+	var err error
+	var i int
+
+	for i = range contents {
+		path = writeTestAccounts(t, contents[i])
+
+		err = addPremadeAccounts(newTestBuilder(false), path)
+		if err == nil {
+			t.Fatalf("content %d accepted", i)
+		}
+
+		if (i < 3) && !strings.Contains(err.Error(), path) {
+			t.Fatalf("content %d: error without path: %s", i,
+				err.Error())
+		}
+	}
+}
+
+func TestOfflineBuilder(t *testing.T) {
+	var iface *BlockchainInterface = &BlockchainInterface{}
+	var logger core.Logger = newTestBuilder(false).logger
+	var builder core.BlockchainBuilder
+	var acc *account
+	var path string
+	var ret interface{}
+	var err error
+	var i int
+
+	path = writeTestAccounts(t, `
+- address: "tmA"
+  key: "keyA"
+`)
+
+	// The endpoint does not exist: the builder must never dial it.
+	builder, err = iface.OfflineBuilder(map[string]string{
+		"prepare": "presigned",
+	}, []string{ "accounts=" + path }, map[string][]string{
+		"node-0:8232": []string{},
+	}, logger)
+	if err != nil {
+		t.Fatalf("offline builder: %s", err.Error())
+	}
+
+	for i = 0; i < 2; i++ {
+		ret, err = builder.CreateAccount(1000)
+		if err != nil {
+			t.Fatalf("account %d: %s", i, err.Error())
+		}
+
+		acc = ret.(*account)
+		if (i == 0) && (acc.address != "tmA") {
+			t.Fatalf("premade account not used: %v", acc)
+		}
+	}
+
+	if (acc.address != "offline-2") || (acc.balance != 1000) ||
+		(acc.shielded != nil) {
+		t.Fatalf("placeholder account: got %v", acc)
+	}
+
+	_, err = iface.OfflineBuilder(map[string]string{ "prepare": "bogus" },
+		[]string{}, map[string][]string{}, logger)
+	if err == nil {
+		t.Fatalf("unknown prepare method accepted")
+	}
+}
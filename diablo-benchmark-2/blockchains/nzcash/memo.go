@@ -0,0 +1,186 @@
+package nzcash
+
+
+import (
+	"bufio"
+	"diablo-benchmark/core"
+	"fmt"
+	"math/rand"
+	"os"
+)
+
+
+// Size in bytes of the memo field of a shielded output.
+//
+const memoSize = 512
+
+
+// Create memo samples to use as the memo of `!memo` interactions:
+//
+//   sample: !memo { text: "hello" }
+//   sample: !memo { size: 512, number: 100, seed: 42 }
+//   sample: !memo { file: "messages.txt" }
+//
+// The first form yields a single memo with the given text. The second form
+// yields `number` (default 1) memos of `size` random bytes generated from the
+// given seed, an int or a string, which is drawn from the master seed by
+// default. These memos start with the 0xff byte which marks arbitrary data
+// (see ZIP 302). The last form yields one memo for each line of the given
+// file.
+//
+type memoSampleFactory struct {
+}
+
+func newMemoSampleFactory() *memoSampleFactory {
+	return &memoSampleFactory{}
+}
+
+func (this *memoSampleFactory) Instance(expr core.BenchmarkExpression) (core.Sample, error) {
+	var field core.BenchmarkExpression
+	var err error
+
+	field, err = expr.TryField("text")
+	if err == nil {
+		return parseTextMemo(field)
+	}
+
+	field, err = expr.TryField("file")
+	if err == nil {
+		return parseFileMemo(field)
+	}
+
+	_, err = expr.TryField("size")
+	if err == nil {
+		return parseRandomMemo(expr)
+	}
+
+	return nil, fmt.Errorf("%s: memo needs one of 'text', 'size' or " +
+		"'file'", expr.FullPosition())
+}
+
+func parseTextMemo(expr core.BenchmarkExpression) (core.Sample, error) {
+	var text string
+	var err error
+
+	text, err = expr.GetString()
+	if err != nil {
+		return nil, err
+	}
+
+	if len(text) > memoSize {
+		return nil, fmt.Errorf("%s: memo too long (%d bytes)",
+			expr.FullPosition(), len(text))
+	}
+
+	return newMemoSample([][]byte{ []byte(text) }), nil
+}
+
+func parseFileMemo(expr core.BenchmarkExpression) (core.Sample, error) {
+	var scanner *bufio.Scanner
+	var memos [][]byte
+	var path string
+	var file *os.File
+	var err error
+
+	path, err = expr.GetString()
+	if err != nil {
+		return nil, err
+	}
+
+	file, err = os.Open(path)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %s", expr.FullPosition(),
+			err.Error())
+	}
+
+	defer file.Close()
+
+	memos = make([][]byte, 0)
+	scanner = bufio.NewScanner(file)
+
+	for scanner.Scan() {
+		if len(scanner.Bytes()) > memoSize {
+			return nil, fmt.Errorf("%s: line %d too long for a " +
+				"memo (%d bytes)", expr.FullPosition(),
+				len(memos) + 1, len(scanner.Bytes()))
+		}
+
+		memos = append(memos, append([]byte{}, scanner.Bytes()...))
+	}
+
+	err = scanner.Err()
+	if err != nil {
+		return nil, fmt.Errorf("%s: %s", expr.FullPosition(),
+			err.Error())
+	}
+
+	return newMemoSample(memos), nil
+}
+
+func parseRandomMemo(expr core.BenchmarkExpression) (core.Sample, error) {
+	var field core.BenchmarkExpression
+	var size, number, i int
+	var memos [][]byte
+	var seed int64
+	var rng *rand.Rand
+	var err error
+
+	size, err = expr.Field("size").GetInt()
+	if err != nil {
+		return nil, err
+	}
+
+	if (size <= 0) || (size > memoSize) {
+		return nil, fmt.Errorf("%s: must be between 1 and %d",
+			expr.Field("size").FullPosition(), memoSize)
+	}
+
+	number = 1
+	field, err = expr.TryField("number")
+	if err == nil {
+		number, err = field.GetInt()
+		if err != nil {
+			return nil, err
+		}
+
+		if number < 1 {
+			return nil, fmt.Errorf("%s: must be positive",
+				field.FullPosition())
+		}
+	}
+
+	seed, err = expr.Seed("memo")
+	if err != nil {
+		return nil, err
+	}
+
+	rng = rand.New(rand.NewSource(seed))
+	memos = make([][]byte, number)
+
+	for i = range memos {
+		memos[i] = make([]byte, size)
+		rng.Read(memos[i])
+		memos[i][0] = 0xff
+	}
+
+	return newMemoSample(memos), nil
+}
+
+
+type memoSample struct {
+	memos  [][]byte
+}
+
+func newMemoSample(memos [][]byte) *memoSample {
+	return &memoSample{
+		memos: memos,
+	}
+}
+
+func (this *memoSample) Size() int {
+	return len(this.memos)
+}
+
+func (this *memoSample) Get(index int) interface{} {
+	return this.memos[index]
+}
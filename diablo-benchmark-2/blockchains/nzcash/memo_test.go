@@ -0,0 +1,79 @@
+package nzcash
+
+
+import (
+	"bytes"
+	"diablo-benchmark/core"
+	"strings"
+	"testing"
+)
+
+
+func TestRandomMemo(t *testing.T) {
+	var sample core.Sample
+	var memo []byte
+	var err error
+	var i int
+
+	sample, err = newMemoSampleFactory().Instance(newTestExpression(
+		map[string]interface{}{ "size": 16, "number": 3, "seed": 1 }))
+	if err != nil {
+		t.Fatalf("parse: %s", err.Error())
+	}
+
+	if sample.Size() != 3 {
+		t.Fatalf("got %d memos", sample.Size())
+	}
+
+	for i = 0; i < sample.Size(); i++ {
+		memo = sample.Get(i).([]byte)
+		if (len(memo) != 16) || (memo[0] != 0xff) {
+			t.Fatalf("memo %d: got %v", i, memo)
+		}
+	}
+}
+
+func TestRandomMemoInvalid(t *testing.T) {
+	var fields []map[string]interface{} = []map[string]interface{}{
+		map[string]interface{}{ "size": 16, "number": -1 },
+		map[string]interface{}{ "size": 16, "number": 0 },
+		map[string]interface{}{ "size": -1 },
+		map[string]interface{}{ "size": memoSize + 1 },
+	}
+	var err error
+	var i int
+
+	for i = range fields {
+		_, err = newMemoSampleFactory().Instance(
+			newTestExpression(fields[i]))
+		if (err == nil) || !strings.Contains(err.Error(), "bench.yaml") {
+			t.Fatalf("fields %d: got %v", i, err)
+		}
+	}
+}
+
+func TestRandomMemoStringSeed(t *testing.T) {
+	var a, b core.Sample
+	var err error
+	var i int
+
+	a, err = newMemoSampleFactory().Instance(newTestExpression(
+		map[string]interface{}{ "size": 32, "number": 4,
+		"seed": "run-1" }))
+	if err != nil {
+		t.Fatalf("parse: %s", err.Error())
+	}
+
+	b, err = newMemoSampleFactory().Instance(newTestExpression(
+		map[string]interface{}{ "size": 32, "number": 4,
+		"seed": "run-1" }))
+	if err != nil {
+		t.Fatalf("parse: %s", err.Error())
+	}
+
+	for i = 0; i < a.Size(); i++ {
+		if !bytes.Equal(a.Get(i).([]byte), b.Get(i).([]byte)) {
+			t.Fatalf("memo %d: same seed gives different memos", i)
+		}
+	}
+}
@@ -0,0 +1,563 @@
+package nzcash
+
+
+import (
+	"encoding/json"
+	"fmt"
+	"math"
+	"strconv"
+	"time"
+
+	rpc "diablo-benchmark/zcashrpcclient"
+)
+
+
+const (
+	zatoshiPerZec       float64       = 100000000
+
+	// How long to wait between two polls of an asynchronous wallet
+	// operation.
+	operationPollDelay  time.Duration = 100 * time.Millisecond
+
+	// How long to wait for an asynchronous wallet operation before
+	// giving up on it.
+	operationTimeout    time.Duration = 2 * time.Minute
+)
+
+
+func zatoshiToZec(amount uint64) float64 {
+	return float64(amount) / zatoshiPerZec
+}
+
+func zecToZatoshi(amount float64) uint64 {
+	return uint64(math.Round(amount * zatoshiPerZec))
+}
+
+
+// A connection to the RPC interface of a zcashd process.
+// Most of the calls Diablo needs are not wrapped by the rpc package (or are
+// wrapped with Bitcoin types that do not understand Zcash addresses and
+// transaction formats) so this goes through raw requests instead.
+//
+type node struct {
+	client  *rpc.Client
+	addr    string
+}
+
+func newNode(address, user, password string) (*node, error) {
+	var client *rpc.Client
+	var err error
+
+	client, err = rpc.New(&rpc.ConnConfig{
+		Host: address,
+		User: user,
+		Pass: password,
+		HTTPPostMode: true,
+		DisableTLS: true,
+	}, nil)
+
+	if err != nil {
+		return nil, err
+	}
+
+	return &node{
+		client: client,
+		addr: address,
+	}, nil
+}
+
+func (this *node) call(result interface{}, method string, params ...interface{}) error {
+	var raws []json.RawMessage
+	var raw json.RawMessage
+	var param interface{}
+	var err error
+	var i int
+
+	raws = make([]json.RawMessage, len(params))
+
+	for i, param = range params {
+		raws[i], err = json.Marshal(param)
+		if err != nil {
+			return err
+		}
+	}
+
+	raw, err = this.client.RawRequest(method, raws)
+	if err != nil {
+		return fmt.Errorf("%s on %s: %s", method, this.addr,
+			err.Error())
+	}
+
+	if result == nil {
+		return nil
+	}
+
+	return json.Unmarshal(raw, result)
+}
+
+
+type nodeUnspent struct {
+	Txid           string   `json:"txid"`
+	Vout           uint32   `json:"vout"`
+	Address        string   `json:"address"`
+	ScriptPubKey   string   `json:"scriptPubKey"`
+	AmountZat      uint64   `json:"amountZat"`
+	Confirmations  int64    `json:"confirmations"`
+	Spendable      bool     `json:"spendable"`
+}
+
+func (this *node) listUnspent(addresses []string) ([]nodeUnspent, error) {
+	var ret []nodeUnspent
+	var err error
+
+	err = this.call(&ret, "listunspent", 1, 9999999, addresses)
+	if err != nil {
+		return nil, err
+	}
+
+	return ret, nil
+}
+
+
+type nodeNote struct {
+	Txid           string   `json:"txid"`
+	Pool           string   `json:"pool"`
+	Address        string   `json:"address"`
+	AmountZat      uint64   `json:"amountZat"`
+	Memo           string   `json:"memo"`
+	Confirmations  int64    `json:"confirmations"`
+	Spendable      bool     `json:"spendable"`
+}
+
+func (this *node) zListUnspent(addresses []string) ([]nodeNote, error) {
+	var ret []nodeNote
+	var err error
+
+	err = this.call(&ret, "z_listunspent", 1, 9999999, false,
+		addresses)
+	if err != nil {
+		return nil, err
+	}
+
+	return ret, nil
+}
+
+
+type nodeValidation struct {
+	IsValid  bool  `json:"isvalid"`
+	IsMine   bool  `json:"ismine"`
+}
+
+func (this *node) isMine(address string) (bool, error) {
+	var ret nodeValidation
+	var err error
+
+	err = this.call(&ret, "validateaddress", address)
+	if err != nil {
+		return false, err
+	}
+
+	if !ret.IsValid {
+		return false, fmt.Errorf("invalid address '%s'", address)
+	}
+
+	return ret.IsMine, nil
+}
+
+func (this *node) zIsMine(address string) (bool, error) {
+	var ret nodeValidation
+	var err error
+
+	err = this.call(&ret, "z_validateaddress", address)
+	if err != nil {
+		return false, err
+	}
+
+	if !ret.IsValid {
+		return false, fmt.Errorf("invalid address '%s'", address)
+	}
+
+	return ret.IsMine, nil
+}
+
+func (this *node) importPrivKey(key string, rescan bool) error {
+	return this.call(nil, "importprivkey", key, "", rescan)
+}
+
+func (this *node) zImportKey(key string, rescan bool) error {
+	if rescan {
+		return this.call(nil, "z_importkey", key, "yes")
+	} else {
+		return this.call(nil, "z_importkey", key, "no")
+	}
+}
+
+func (this *node) getNewAddress() (string, error) {
+	var ret string
+	var err error
+
+	err = this.call(&ret, "getnewaddress")
+	if err != nil {
+		return "", err
+	}
+
+	return ret, nil
+}
+
+func (this *node) dumpPrivKey(address string) (string, error) {
+	var ret string
+	var err error
+
+	err = this.call(&ret, "dumpprivkey", address)
+	if err != nil {
+		return "", err
+	}
+
+	return ret, nil
+}
+
+
+type nodeBlockchainInfo struct {
+	Chain       string           `json:"chain"`
+	Blocks      int64            `json:"blocks"`
+	ValuePools  []nodeValuePool  `json:"valuePools"`
+}
+
+type nodeValuePool struct {
+	Id             string  `json:"id"`
+	Monitored      bool    `json:"monitored"`
+	ChainValueZat  int64   `json:"chainValueZat"`
+}
+
+func (this *node) getBlockchainInfo() (*nodeBlockchainInfo, error) {
+	var ret nodeBlockchainInfo
+	var err error
+
+	err = this.call(&ret, "getblockchaininfo")
+	if err != nil {
+		return nil, err
+	}
+
+	return &ret, nil
+}
+
+func (this *node) generate(n int) error {
+	return this.call(nil, "generate", n)
+}
+
+func (this *node) sendToAddress(address string, amount uint64) (string, error) {
+	var ret string
+	var err error
+
+	err = this.call(&ret, "sendtoaddress", address, zatoshiToZec(amount))
+	if err != nil {
+		return "", err
+	}
+
+	return ret, nil
+}
+
+
+type nodeRecipient struct {
+	Address  string   `json:"address"`
+	Amount   float64  `json:"amount"`
+	Memo     string   `json:"memo,omitempty"`
+}
+
+// Return the privacy policy z_sendmany needs to accept a transfer between
+// the given pools.
+//
+func privacyPolicy(fromShielded, toShielded bool) string {
+	if fromShielded && toShielded {
+		return "AllowRevealedAmounts"
+	} else if fromShielded {
+		return "AllowRevealedRecipients"
+	} else if toShielded {
+		return "AllowRevealedSenders"
+	} else {
+		return "AllowFullyTransparent"
+	}
+}
+
+// Send from the given address with the wallet of the node and return the
+// identifier of the asynchronous operation.
+//
+func (this *node) zSendMany(from string, recipients []nodeRecipient, policy string) (string, error) {
+	var ret string
+	var err error
+
+	err = this.call(&ret, "z_sendmany", from, recipients, 1, nil, policy)
+	if err != nil {
+		return "", err
+	}
+
+	return ret, nil
+}
+
+
+type nodeMerge struct {
+	MergingUTXOs  int     `json:"mergingUTXOs"`
+	MergingNotes  int     `json:"mergingNotes"`
+	Opid          string  `json:"opid"`
+}
+
+// Merge at most `limit` unspent outputs (or notes if `shielded` is true) of
+// the given address into a single output to the same address and return the
+// identifier of the asynchronous operation.
+// The zcashd node must run with -experimentalfeatures and -zmergetoaddress.
+//
+func (this *node) zMergeToAddress(address string, shielded bool, limit int) (string, error) {
+	var tlimit, slimit int
+	var ret nodeMerge
+	var err error
+
+	// A limit of 0 means no limit so use 1 for the unused pool.
+	if shielded {
+		tlimit, slimit = 1, limit
+	} else {
+		tlimit, slimit = limit, 1
+	}
+
+	err = this.call(&ret, "z_mergetoaddress", []string{ address },
+		address, nil, tlimit, slimit, "",
+		privacyPolicy(shielded, shielded))
+	if err != nil {
+		return "", err
+	}
+
+	return ret.Opid, nil
+}
+
+
+type nodeOperation struct {
+	Id      string  `json:"id"`
+	Status  string  `json:"status"`
+	Result  struct {
+		Txid  string  `json:"txid"`
+	} `json:"result"`
+	Error   struct {
+		Code     int     `json:"code"`
+		Message  string  `json:"message"`
+	} `json:"error"`
+}
+
+// Wait for the given asynchronous operation to finish and return the txid
+// of the transaction it created.
+// Give up if the operation does not finish within `operationTimeout`.
+//
+func (this *node) waitOperation(opid string, poll time.Duration) (string, error) {
+	var deadline time.Time = time.Now().Add(operationTimeout)
+	var ops []nodeOperation
+	var err error
+
+	for {
+		err = this.call(&ops, "z_getoperationstatus",
+			[]string{ opid })
+		if err != nil {
+			return "", err
+		}
+
+		if len(ops) != 1 {
+			return "", fmt.Errorf("unknown operation '%s'", opid)
+		}
+
+		if ops[0].Status == "success" {
+			break
+		}
+
+		if (ops[0].Status == "failed") ||
+			(ops[0].Status == "cancelled") {
+			this.call(nil, "z_getoperationresult",
+				[]string{ opid })
+			return "", fmt.Errorf("operation '%s' %s: %s", opid,
+				ops[0].Status, ops[0].Error.Message)
+		}
+
+		if time.Now().After(deadline) {
+			return "", fmt.Errorf("operation '%s' still %s after " +
+				"%s", opid, ops[0].Status, operationTimeout)
+		}
+
+		time.Sleep(poll)
+	}
+
+	err = this.call(&ops, "z_getoperationresult", []string{ opid })
+	if err != nil {
+		return "", err
+	}
+
+	if len(ops) != 1 {
+		return "", fmt.Errorf("unknown operation '%s'", opid)
+	}
+
+	return ops[0].Result.Txid, nil
+}
+
+
+type nodeTransaction struct {
+	Txid           string  `json:"txid"`
+	Confirmations  int64   `json:"confirmations"`
+}
+
+func (this *node) getTransaction(txid string) (*nodeTransaction, error) {
+	var ret nodeTransaction
+	var err error
+
+	err = this.call(&ret, "gettransaction", txid)
+	if err != nil {
+		return nil, err
+	}
+
+	return &ret, nil
+}
+
+
+type nodeInput struct {
+	Txid  string  `json:"txid"`
+	Vout  uint32  `json:"vout"`
+}
+
+// Create an unsigned transaction spending the given inputs and return its
+// hexadecimal encoding.
+// The transaction never expires so it can be signed long before it is
+// submitted.
+//
+func (this *node) createRawTransaction(inputs []nodeInput, outputs map[string]float64) (string, error) {
+	var ret string
+	var err error
+
+	err = this.call(&ret, "createrawtransaction", inputs, outputs, 0, 0)
+	if err != nil {
+		return "", err
+	}
+
+	return ret, nil
+}
+
+
+type nodePrevout struct {
+	Txid          string   `json:"txid"`
+	Vout          uint32   `json:"vout"`
+	ScriptPubKey  string   `json:"scriptPubKey"`
+	Amount        float64  `json:"amount"`
+}
+
+type nodeSigned struct {
+	Hex       string  `json:"hex"`
+	Complete  bool    `json:"complete"`
+}
+
+// Sign the given transaction with the given WIF encoded keys only.
+// The wallet of the node is not used so the keys do not need to be imported.
+//
+func (this *node) signRawTransaction(raw string, prevouts []nodePrevout, keys []string) (string, error) {
+	var ret nodeSigned
+	var err error
+
+	err = this.call(&ret, "signrawtransaction", raw, prevouts, keys)
+	if err != nil {
+		return "", err
+	}
+
+	if !ret.Complete {
+		return "", fmt.Errorf("incomplete signature")
+	}
+
+	return ret.Hex, nil
+}
+
+func (this *node) sendRawTransaction(raw string) (string, error) {
+	var ret string
+	var err error
+
+	err = this.call(&ret, "sendrawtransaction", raw)
+	if err != nil {
+		return "", err
+	}
+
+	return ret, nil
+}
+
+func (this *node) getBlockCount() (int64, error) {
+	var ret int64
+	var err error
+
+	err = this.call(&ret, "getblockcount")
+	if err != nil {
+		return 0, err
+	}
+
+	return ret, nil
+}
+
+
+type nodeBlock struct {
+	Hash    string    `json:"hash"`
+	Height  int64     `json:"height"`
+	Size    int64     `json:"size"`
+	Time    int64     `json:"time"`
+	Tx      []string  `json:"tx"`
+	Trees   struct {
+		Sapling  struct {
+			Size  int64  `json:"size"`
+		} `json:"sapling"`
+		Orchard  struct {
+			Size  int64  `json:"size"`
+		} `json:"orchard"`
+	} `json:"trees"`
+}
+
+func (this *node) getBlock(height int64) (*nodeBlock, error) {
+	var ret nodeBlock
+	var err error
+
+	err = this.call(&ret, "getblock", strconv.FormatInt(height, 10), 1)
+	if err != nil {
+		return nil, err
+	}
+
+	return &ret, nil
+}
+
+
+type nodeReceived struct {
+	Txid           string  `json:"txid"`
+	AmountZat      uint64  `json:"amountZat"`
+	Memo           string  `json:"memo"`
+	Confirmations  int64   `json:"confirmations"`
+}
+
+// List the notes received by the given shielded address with at least the
+// given number of confirmations, along with their decrypted memos.
+// The wallet of the node must own the key of the address.
+//
+func (this *node) zListReceivedByAddress(address string, minconf int) ([]nodeReceived, error) {
+	var ret []nodeReceived
+	var err error
+
+	err = this.call(&ret, "z_listreceivedbyaddress", address, minconf)
+	if err != nil {
+		return nil, err
+	}
+
+	return ret, nil
+}
+
+
+type nodeMempoolInfo struct {
+	Size   int64  `json:"size"`
+	Bytes  int64  `json:"bytes"`
+	Usage  int64  `json:"usage"`
+}
+
+func (this *node) getMempoolInfo() (*nodeMempoolInfo, error) {
+	var ret nodeMempoolInfo
+	var err error
+
+	err = this.call(&ret, "getmempoolinfo")
+	if err != nil {
+		return nil, err
+	}
+
+	return &ret, nil
+}
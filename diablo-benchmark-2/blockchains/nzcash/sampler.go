@@ -0,0 +1,181 @@
+package nzcash
+
+
+import (
+	"diablo-benchmark/core"
+	"time"
+)
+
+
+// The state of the chain sampled during a benchmark.
+// Times are in seconds since the start of the benchmark, like the times of
+// the interaction results. The sampling starts slightly before the benchmark
+// so the first samples can have a negative time.
+//
+type chainSamples struct {
+	Interval  float64
+	Samples   []*chainSample
+	Blocks    []*chainBlock
+}
+
+type chainSample struct {
+	Time          float64
+	Height        int64
+	Pools         map[string]int64  // chain value in zatoshis
+	SaplingTree   int64             // note commitments
+	OrchardTree   int64             // note commitments
+	MempoolSize   int64             // transactions
+	MempoolBytes  int64
+}
+
+type chainBlock struct {
+	Height        int64
+	Time          float64           // when the sampler saw the block
+	Timestamp     int64             // from the block header
+	Size          int64
+	Transactions  int
+}
+
+
+// Poll a zcashd node at regular interval and record the chain value pools,
+// the size of the note commitment trees, the size of the mempool and every
+// new block.
+// The tree sizes are read from the last block since z_gettreestate only
+// returns the serialized frontiers.
+//
+type chainSampler struct {
+	logger    core.Logger
+	node      *node
+	interval  time.Duration
+	start     time.Time
+	height    int64
+	stop      chan struct{}
+	done      chan struct{}
+	result    *chainSamples
+}
+
+func newChainSampler(logger core.Logger, node *node, interval time.Duration) *chainSampler {
+	return &chainSampler{
+		logger: logger,
+		node: node,
+		interval: interval,
+		result: &chainSamples{
+			Interval: interval.Seconds(),
+			Samples: make([]*chainSample, 0),
+			Blocks: make([]*chainBlock, 0),
+		},
+	}
+}
+
+func (this *chainSampler) begin(start time.Time) error {
+	var err error
+
+	this.height, err = this.node.getBlockCount()
+	if err != nil {
+		return err
+	}
+
+	this.start = start
+	this.stop = make(chan struct{})
+	this.done = make(chan struct{})
+
+	go this.run()
+
+	return nil
+}
+
+func (this *chainSampler) end() *chainSamples {
+	close(this.stop)
+	<- this.done
+
+	return this.result
+}
+
+func (this *chainSampler) run() {
+	var ticker *time.Ticker = time.NewTicker(this.interval)
+	var err error
+
+	defer close(this.done)
+	defer ticker.Stop()
+
+	for {
+		err = this.sample()
+		if err != nil {
+			this.logger.Warnf("chain sampling failed: %s",
+				err.Error())
+		}
+
+		select {
+		case <- ticker.C:
+		case <- this.stop:
+			return
+		}
+	}
+}
+
+func (this *chainSampler) sample() error {
+	var info *nodeBlockchainInfo
+	var mempool *nodeMempoolInfo
+	var sample *chainSample
+	var pool nodeValuePool
+	var block *nodeBlock
+	var now float64
+	var err error
+
+	now = time.Since(this.start).Seconds()
+
+	info, err = this.node.getBlockchainInfo()
+	if err != nil {
+		return err
+	}
+
+	mempool, err = this.node.getMempoolInfo()
+	if err != nil {
+		return err
+	}
+
+	sample = &chainSample{
+		Time: now,
+		Height: info.Blocks,
+		Pools: make(map[string]int64),
+		MempoolSize: mempool.Size,
+		MempoolBytes: mempool.Bytes,
+	}
+
+	for _, pool = range info.ValuePools {
+		if pool.Monitored {
+			sample.Pools[pool.Id] = pool.ChainValueZat
+		}
+	}
+
+	for this.height < info.Blocks {
+		block, err = this.node.getBlock(this.height + 1)
+		if err != nil {
+			return err
+		}
+
+		this.result.Blocks = append(this.result.Blocks, &chainBlock{
+			Height: block.Height,
+			Time: now,
+			Timestamp: block.Time,
+			Size: block.Size,
+			Transactions: len(block.Tx),
+		})
+
+		this.height += 1
+	}
+
+	if block == nil {
+		block, err = this.node.getBlock(info.Blocks)
+		if err != nil {
+			return err
+		}
+	}
+
+	sample.SaplingTree = block.Trees.Sapling.Size
+	sample.OrchardTree = block.Trees.Orchard.Size
+
+	this.result.Samples = append(this.result.Samples, sample)
+
+	return nil
+}
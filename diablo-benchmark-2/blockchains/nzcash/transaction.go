@@ -0,0 +1,844 @@
+package nzcash
+
+
+import (
+	"diablo-benchmark/util"
+	"encoding/binary"
+	"encoding/hex"
+	"fmt"
+	"io"
+)
+
+
+const (
+	transaction_type_transfer     uint8 = 0
+	transaction_type_fanout       uint8 = 1
+	transaction_type_consolidate  uint8 = 2
+	transaction_type_memo         uint8 = 3
+)
+
+
+type transaction interface {
+	getUid() uint64
+
+	// Return the address and the key of the account paying for this
+	// transaction and whether this address is shielded.
+	//
+	getSender() (string, string, bool)
+
+	// Send this transaction through the wallet of the given node and
+	// return the txid of the resulting Zcash transaction.
+	// The wallet must own the key of the sender.
+	//
+	submit(*node) (string, error)
+
+	// Return the hexadecimal encoding of this transaction, built and
+	// signed with the given node.
+	// The transaction is signed only once, subsequent calls return the
+	// same encoding.
+	//
+	getRaw(*node) (string, error)
+}
+
+
+func decodeTransaction(src io.Reader) (transaction, error) {
+	var txtype uint8
+	var err error
+
+	err = util.NewMonadInputReader(src).ReadUint8(&txtype).Error()
+	if err != nil {
+		return nil, err
+	}
+
+	switch (txtype) {
+	case transaction_type_transfer:
+		return decodeTransferTransaction(src)
+	case transaction_type_fanout:
+		return decodeFanoutTransaction(src)
+	case transaction_type_consolidate:
+		return decodeConsolidateTransaction(src)
+	case transaction_type_memo:
+		return decodeMemoTransaction(src)
+	default:
+		return nil, fmt.Errorf("unknown transaction type %v", txtype)
+	}
+}
+
+
+type baseTransaction struct {
+	uid  uint64
+	raw  string
+}
+
+func (this *baseTransaction) init(uid uint64) {
+	this.uid = uid
+	this.raw = ""
+}
+
+func (this *baseTransaction) getUid() uint64 {
+	return this.uid
+}
+
+
+// The ZIP-317 conventional fee for a transparent transaction with the given
+// number of inputs and outputs.
+//
+func conventionalFee(ninputs, noutputs int) uint64 {
+	var actions int = ninputs
+
+	if noutputs > actions {
+		actions = noutputs
+	}
+
+	if actions < 2 {
+		actions = 2
+	}
+
+	return 5000 * uint64(actions)
+}
+
+
+type payment struct {
+	address  string
+	amount   uint64
+	memo     []byte    // only for shielded addresses, can be nil
+}
+
+// Send the given payments from the given address with the wallet of the
+// given node and return the txid of the resulting transaction.
+//
+func sendWallet(n *node, from string, shielded bool, payments []*payment) (string, error) {
+	var recipients []nodeRecipient
+	var toShielded bool
+	var p *payment
+	var opid string
+	var err error
+
+	recipients = make([]nodeRecipient, 0, len(payments))
+	toShielded = false
+
+	for _, p = range payments {
+		recipients = append(recipients, nodeRecipient{
+			Address: p.address,
+			Amount: zatoshiToZec(p.amount),
+			Memo: hex.EncodeToString(p.memo),
+		})
+
+		// Transparent addresses start with 't' on every network.
+		if p.address[0] != 't' {
+			toShielded = true
+		}
+	}
+
+	opid, err = n.zSendMany(from, recipients,
+		privacyPolicy(shielded, toShielded))
+	if err != nil {
+		return "", err
+	}
+
+	return n.waitOperation(opid, operationPollDelay)
+}
+
+// Build a raw transaction spending the given inputs to the given payments,
+// sign it with the given key and return its hexadecimal encoding.
+// Whatever the inputs hold beyond the payments and the fee is sent back to
+// the `change` address.
+//
+func signRaw(n *node, inputs []*utxo, payments []*payment, fee uint64, change, key string) (string, error) {
+	var outputs map[string]float64
+	var prevouts []nodePrevout
+	var total, spent uint64
+	var nins []nodeInput
+	var raw string
+	var p *payment
+	var in *utxo
+	var err error
+
+	if len(inputs) == 0 {
+		return "", fmt.Errorf("no input to spend")
+	}
+
+	nins = make([]nodeInput, 0, len(inputs))
+	prevouts = make([]nodePrevout, 0, len(inputs))
+	total = 0
+
+	for _, in = range inputs {
+		nins = append(nins, nodeInput{
+			Txid: in.txid,
+			Vout: in.vout,
+		})
+
+		prevouts = append(prevouts, nodePrevout{
+			Txid: in.txid,
+			Vout: in.vout,
+			ScriptPubKey: in.script,
+			Amount: zatoshiToZec(in.amount),
+		})
+
+		total += in.amount
+	}
+
+	outputs = make(map[string]float64)
+	spent = fee
+
+	for _, p = range payments {
+		outputs[p.address] += zatoshiToZec(p.amount)
+		spent += p.amount
+	}
+
+	if total < spent {
+		return "", fmt.Errorf("inputs (%d zat) do not cover " +
+			"payments and fee (%d zat)", total, spent)
+	}
+
+	if total > spent {
+		outputs[change] += zatoshiToZec(total - spent)
+	}
+
+	raw, err = n.createRawTransaction(nins, outputs)
+	if err != nil {
+		return "", err
+	}
+
+	return n.signRawTransaction(raw, prevouts, []string{ key })
+}
+
+
+func encodeBool(value bool) uint8 {
+	if value {
+		return 1
+	}
+
+	return 0
+}
+
+func checkEncodedString(name, value string) error {
+	if len(value) > 65535 {
+		return fmt.Errorf("%s too long (%d bytes)", name, len(value))
+	}
+
+	return nil
+}
+
+
+type transferTransaction struct {
+	baseTransaction
+	amount  uint64
+	from    string
+	key     string
+	to      string
+	fee     uint64
+	inputs  []*utxo
+}
+
+func newTransferTransaction(uid, amount uint64, from, key, to string, fee uint64, inputs []*utxo) *transferTransaction {
+	var this transferTransaction
+
+	this.baseTransaction.init(uid)
+	this.amount = amount
+	this.from = from
+	this.key = key
+	this.to = to
+	this.fee = fee
+	this.inputs = inputs
+
+	return &this
+}
+
+func decodeUtxos(src io.Reader, n int) ([]*utxo, error) {
+	var ret []*utxo = make([]*utxo, n)
+	var lentxid, lenscript int
+	var txid, script string
+	var amount uint64
+	var vout uint32
+	var err error
+	var i int
+
+	for i = range ret {
+		err = util.NewMonadInputReader(src).
+			SetOrder(binary.LittleEndian).
+			ReadUint8(&lentxid).
+			ReadUint16(&lenscript).
+			ReadUint32(&vout).
+			ReadUint64(&amount).
+			ReadString(&txid, lentxid).
+			ReadString(&script, lenscript).
+			Error()
+		if err != nil {
+			return nil, err
+		}
+
+		ret[i] = &utxo{
+			txid: txid,
+			vout: vout,
+			script: script,
+			amount: amount,
+		}
+	}
+
+	return ret, nil
+}
+
+func encodeUtxos(dest io.Writer, utxos []*utxo) error {
+	var in *utxo
+	var err error
+
+	for _, in = range utxos {
+		if len(in.txid) > 255 {
+			return fmt.Errorf("txid too long (%d bytes)",
+				len(in.txid))
+		}
+
+		err = checkEncodedString("script", in.script)
+		if err != nil {
+			return err
+		}
+
+		err = util.NewMonadOutputWriter(dest).
+			SetOrder(binary.LittleEndian).
+			WriteUint8(uint8(len(in.txid))).
+			WriteUint16(uint16(len(in.script))).
+			WriteUint32(in.vout).
+			WriteUint64(in.amount).
+			WriteString(in.txid).
+			WriteString(in.script).
+			Error()
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+func decodeTransferTransaction(src io.Reader) (*transferTransaction, error) {
+	var lenfrom, lenkey, lento, ninputs int
+	var uid, amount, fee uint64
+	var from, key, to string
+	var inputs []*utxo
+	var err error
+
+	err = util.NewMonadInputReader(src).
+		SetOrder(binary.LittleEndian).
+		ReadUint16(&lenfrom).
+		ReadUint16(&lenkey).
+		ReadUint16(&lento).
+		ReadUint16(&ninputs).
+		ReadUint64(&uid).
+		ReadUint64(&amount).
+		ReadUint64(&fee).
+		ReadString(&from, lenfrom).
+		ReadString(&key, lenkey).
+		ReadString(&to, lento).
+		Error()
+	if err != nil {
+		return nil, err
+	}
+
+	inputs, err = decodeUtxos(src, ninputs)
+	if err != nil {
+		return nil, err
+	}
+
+	return newTransferTransaction(uid, amount, from, key, to, fee,
+		inputs), nil
+}
+
+func (this *transferTransaction) encode(dest io.Writer) error {
+	var err error
+
+	err = checkEncodedString("from address", this.from)
+	if err != nil {
+		return err
+	}
+
+	err = checkEncodedString("from key", this.key)
+	if err != nil {
+		return err
+	}
+
+	err = checkEncodedString("to address", this.to)
+	if err != nil {
+		return err
+	}
+
+	if len(this.inputs) > 65535 {
+		return fmt.Errorf("too many inputs (%d)", len(this.inputs))
+	}
+
+	err = util.NewMonadOutputWriter(dest).
+		SetOrder(binary.LittleEndian).
+		WriteUint8(transaction_type_transfer).
+		WriteUint16(uint16(len(this.from))).
+		WriteUint16(uint16(len(this.key))).
+		WriteUint16(uint16(len(this.to))).
+		WriteUint16(uint16(len(this.inputs))).
+		WriteUint64(this.getUid()).
+		WriteUint64(this.amount).
+		WriteUint64(this.fee).
+		WriteString(this.from).
+		WriteString(this.key).
+		WriteString(this.to).
+		Error()
+	if err != nil {
+		return err
+	}
+
+	return encodeUtxos(dest, this.inputs)
+}
+
+func (this *transferTransaction) getSender() (string, string, bool) {
+	return this.from, this.key, false
+}
+
+func (this *transferTransaction) submit(n *node) (string, error) {
+	return sendWallet(n, this.from, false, []*payment{
+		&payment{ address: this.to, amount: this.amount },
+	})
+}
+
+func (this *transferTransaction) getRaw(n *node) (string, error) {
+	var err error
+
+	if this.raw != "" {
+		return this.raw, nil
+	}
+
+	this.raw, err = signRaw(n, this.inputs, []*payment{
+		&payment{ address: this.to, amount: this.amount },
+	}, this.fee, this.from, this.key)
+	if err != nil {
+		return "", fmt.Errorf("transaction %d: %s", this.getUid(),
+			err.Error())
+	}
+
+	return this.raw, nil
+}
+
+
+// A transaction paying many recipients at once.
+// With inputs, this is also how a transparent consolidation is built: all
+// the inputs pay a single recipient which is the sender itself.
+//
+type fanoutTransaction struct {
+	baseTransaction
+	from      string
+	key       string
+	shielded  bool
+	payments  []*payment
+	fee       uint64
+	inputs    []*utxo
+}
+
+func newFanoutTransaction(uid uint64, from, key string, shielded bool, payments []*payment, fee uint64, inputs []*utxo) *fanoutTransaction {
+	var this fanoutTransaction
+
+	this.baseTransaction.init(uid)
+	this.from = from
+	this.key = key
+	this.shielded = shielded
+	this.payments = payments
+	this.fee = fee
+	this.inputs = inputs
+
+	return &this
+}
+
+func decodeFanoutTransaction(src io.Reader) (*fanoutTransaction, error) {
+	var lenfrom, lenkey, lenaddr, npayments, ninputs int
+	var from, key, address string
+	var payments []*payment
+	var uid, fee, amount uint64
+	var inputs []*utxo
+	var shielded uint8
+	var err error
+	var i int
+
+	err = util.NewMonadInputReader(src).
+		SetOrder(binary.LittleEndian).
+		ReadUint16(&lenfrom).
+		ReadUint16(&lenkey).
+		ReadUint16(&npayments).
+		ReadUint16(&ninputs).
+		ReadUint8(&shielded).
+		ReadUint64(&uid).
+		ReadUint64(&fee).
+		ReadString(&from, lenfrom).
+		ReadString(&key, lenkey).
+		Error()
+	if err != nil {
+		return nil, err
+	}
+
+	payments = make([]*payment, npayments)
+
+	for i = range payments {
+		err = util.NewMonadInputReader(src).
+			SetOrder(binary.LittleEndian).
+			ReadUint16(&lenaddr).
+			ReadUint64(&amount).
+			ReadString(&address, lenaddr).
+			Error()
+		if err != nil {
+			return nil, err
+		}
+
+		payments[i] = &payment{ address: address, amount: amount }
+	}
+
+	inputs, err = decodeUtxos(src, ninputs)
+	if err != nil {
+		return nil, err
+	}
+
+	return newFanoutTransaction(uid, from, key, shielded == 1, payments,
+		fee, inputs), nil
+}
+
+func (this *fanoutTransaction) encode(dest io.Writer) error {
+	var p *payment
+	var err error
+
+	err = checkEncodedString("from address", this.from)
+	if err != nil {
+		return err
+	}
+
+	err = checkEncodedString("from key", this.key)
+	if err != nil {
+		return err
+	}
+
+	if len(this.payments) > 65535 {
+		return fmt.Errorf("too many outputs (%d)", len(this.payments))
+	}
+
+	if len(this.inputs) > 65535 {
+		return fmt.Errorf("too many inputs (%d)", len(this.inputs))
+	}
+
+	err = util.NewMonadOutputWriter(dest).
+		SetOrder(binary.LittleEndian).
+		WriteUint8(transaction_type_fanout).
+		WriteUint16(uint16(len(this.from))).
+		WriteUint16(uint16(len(this.key))).
+		WriteUint16(uint16(len(this.payments))).
+		WriteUint16(uint16(len(this.inputs))).
+		WriteUint8(encodeBool(this.shielded)).
+		WriteUint64(this.getUid()).
+		WriteUint64(this.fee).
+		WriteString(this.from).
+		WriteString(this.key).
+		Error()
+	if err != nil {
+		return err
+	}
+
+	for _, p = range this.payments {
+		err = checkEncodedString("to address", p.address)
+		if err != nil {
+			return err
+		}
+
+		err = util.NewMonadOutputWriter(dest).
+			SetOrder(binary.LittleEndian).
+			WriteUint16(uint16(len(p.address))).
+			WriteUint64(p.amount).
+			WriteString(p.address).
+			Error()
+		if err != nil {
+			return err
+		}
+	}
+
+	return encodeUtxos(dest, this.inputs)
+}
+
+func (this *fanoutTransaction) getSender() (string, string, bool) {
+	return this.from, this.key, this.shielded
+}
+
+func (this *fanoutTransaction) submit(n *node) (string, error) {
+	return sendWallet(n, this.from, this.shielded, this.payments)
+}
+
+func (this *fanoutTransaction) getRaw(n *node) (string, error) {
+	var err error
+
+	if this.raw != "" {
+		return this.raw, nil
+	}
+
+	if this.shielded {
+		return "", fmt.Errorf("transaction %d: cannot build raw " +
+			"shielded transactions", this.getUid())
+	}
+
+	this.raw, err = signRaw(n, this.inputs, this.payments, this.fee,
+		this.from, this.key)
+	if err != nil {
+		return "", fmt.Errorf("transaction %d: %s", this.getUid(),
+			err.Error())
+	}
+
+	return this.raw, nil
+}
+
+
+// A consolidation performed by the wallet of the node, merging up to `limit`
+// unspent outputs or notes of the sender into one.
+//
+type consolidateTransaction struct {
+	baseTransaction
+	from      string
+	key       string
+	shielded  bool
+	limit     int
+}
+
+func newConsolidateTransaction(uid uint64, from, key string, shielded bool, limit int) *consolidateTransaction {
+	var this consolidateTransaction
+
+	this.baseTransaction.init(uid)
+	this.from = from
+	this.key = key
+	this.shielded = shielded
+	this.limit = limit
+
+	return &this
+}
+
+func decodeConsolidateTransaction(src io.Reader) (*consolidateTransaction, error) {
+	var lenfrom, lenkey, limit int
+	var from, key string
+	var shielded uint8
+	var uid uint64
+	var err error
+
+	err = util.NewMonadInputReader(src).
+		SetOrder(binary.LittleEndian).
+		ReadUint16(&lenfrom).
+		ReadUint16(&lenkey).
+		ReadUint32(&limit).
+		ReadUint8(&shielded).
+		ReadUint64(&uid).
+		ReadString(&from, lenfrom).
+		ReadString(&key, lenkey).
+		Error()
+	if err != nil {
+		return nil, err
+	}
+
+	return newConsolidateTransaction(uid, from, key, shielded == 1,
+		limit), nil
+}
+
+func (this *consolidateTransaction) encode(dest io.Writer) error {
+	var err error
+
+	err = checkEncodedString("from address", this.from)
+	if err != nil {
+		return err
+	}
+
+	err = checkEncodedString("from key", this.key)
+	if err != nil {
+		return err
+	}
+
+	return util.NewMonadOutputWriter(dest).
+		SetOrder(binary.LittleEndian).
+		WriteUint8(transaction_type_consolidate).
+		WriteUint16(uint16(len(this.from))).
+		WriteUint16(uint16(len(this.key))).
+		WriteUint32(uint32(this.limit)).
+		WriteUint8(encodeBool(this.shielded)).
+		WriteUint64(this.getUid()).
+		WriteString(this.from).
+		WriteString(this.key).
+		Error()
+}
+
+func (this *consolidateTransaction) getSender() (string, string, bool) {
+	return this.from, this.key, this.shielded
+}
+
+func (this *consolidateTransaction) submit(n *node) (string, error) {
+	var opid string
+	var err error
+
+	opid, err = n.zMergeToAddress(this.from, this.shielded, this.limit)
+	if err != nil {
+		return "", err
+	}
+
+	return n.waitOperation(opid, operationPollDelay)
+}
+
+func (this *consolidateTransaction) getRaw(n *node) (string, error) {
+	return "", fmt.Errorf("transaction %d: wallet consolidations " +
+		"cannot be built as raw transactions", this.getUid())
+}
+
+
+// A shielded payment carrying a memo.
+// The client holds the key of the recipient so it can check the memo is
+// delivered intact.
+//
+type memoTransaction struct {
+	baseTransaction
+	amount  uint64
+	from    string
+	key     string
+	to      string
+	tokey   string
+	memo    []byte
+}
+
+func newMemoTransaction(uid, amount uint64, from, key, to, tokey string, memo []byte) *memoTransaction {
+	var this memoTransaction
+
+	this.baseTransaction.init(uid)
+	this.amount = amount
+	this.from = from
+	this.key = key
+	this.to = to
+	this.tokey = tokey
+	this.memo = memo
+
+	return &this
+}
+
+func decodeMemoTransaction(src io.Reader) (*memoTransaction, error) {
+	var lenfrom, lenkey, lento, lentokey, lenmemo int
+	var from, key, to, tokey, memo string
+	var uid, amount uint64
+	var err error
+
+	err = util.NewMonadInputReader(src).
+		SetOrder(binary.LittleEndian).
+		ReadUint16(&lenfrom).
+		ReadUint16(&lenkey).
+		ReadUint16(&lento).
+		ReadUint16(&lentokey).
+		ReadUint16(&lenmemo).
+		ReadUint64(&uid).
+		ReadUint64(&amount).
+		ReadString(&from, lenfrom).
+		ReadString(&key, lenkey).
+		ReadString(&to, lento).
+		ReadString(&tokey, lentokey).
+		ReadString(&memo, lenmemo).
+		Error()
+	if err != nil {
+		return nil, err
+	}
+
+	return newMemoTransaction(uid, amount, from, key, to, tokey,
+		[]byte(memo)), nil
+}
+
+func (this *memoTransaction) encode(dest io.Writer) error {
+	var err error
+
+	err = checkEncodedString("from address", this.from)
+	if err != nil {
+		return err
+	}
+
+	err = checkEncodedString("from key", this.key)
+	if err != nil {
+		return err
+	}
+
+	err = checkEncodedString("to address", this.to)
+	if err != nil {
+		return err
+	}
+
+	err = checkEncodedString("to key", this.tokey)
+	if err != nil {
+		return err
+	}
+
+	if len(this.memo) > memoSize {
+		return fmt.Errorf("memo too long (%d bytes)", len(this.memo))
+	}
+
+	return util.NewMonadOutputWriter(dest).
+		SetOrder(binary.LittleEndian).
+		WriteUint8(transaction_type_memo).
+		WriteUint16(uint16(len(this.from))).
+		WriteUint16(uint16(len(this.key))).
+		WriteUint16(uint16(len(this.to))).
+		WriteUint16(uint16(len(this.tokey))).
+		WriteUint16(uint16(len(this.memo))).
+		WriteUint64(this.getUid()).
+		WriteUint64(this.amount).
+		WriteString(this.from).
+		WriteString(this.key).
+		WriteString(this.to).
+		WriteString(this.tokey).
+		WriteString(string(this.memo)).
+		Error()
+}
+
+func (this *memoTransaction) getSender() (string, string, bool) {
+	return this.from, this.key, true
+}
+
+func (this *memoTransaction) getRecipient() (string, string) {
+	return this.to, this.tokey
+}
+
+func (this *memoTransaction) submit(n *node) (string, error) {
+	return sendWallet(n, this.from, true, []*payment{
+		&payment{
+			address: this.to,
+			amount: this.amount,
+			memo: this.memo,
+		},
+	})
+}
+
+func (this *memoTransaction) getRaw(n *node) (string, error) {
+	return "", fmt.Errorf("transaction %d: cannot build raw shielded " +
+		"transactions", this.getUid())
+}
+
+// Indicate if the given memo, as decrypted by the recipient wallet, is the
+// memo of this transaction.
+// Memos are padded with zeros up to 512 bytes and an empty memo is received
+// as the 0xf6 byte (see ZIP 302).
+//
+func (this *memoTransaction) checkMemo(received string) bool {
+	var decoded, expected []byte
+	var err error
+	var i int
+
+	decoded, err = hex.DecodeString(received)
+	if err != nil {
+		return false
+	}
+
+	expected = this.memo
+	if len(expected) == 0 {
+		expected = []byte{ 0xf6 }
+	}
+
+	if len(decoded) < len(expected) {
+		return false
+	}
+
+	for i = range decoded {
+		if i < len(expected) {
+			if decoded[i] != expected[i] {
+				return false
+			}
+		} else if decoded[i] != 0 {
+			return false
+		}
+	}
+
+	return true
+}
@@ -0,0 +1,158 @@
+package nzcash
+
+
+import (
+	"bytes"
+	"encoding/hex"
+	"io"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+
+type testTransaction interface {
+	transaction
+	encode(dest io.Writer) error
+}
+
+
+func testUtxos() []*utxo {
+	return []*utxo{
+		&utxo{ txid: strings.Repeat("ab", 32), vout: 0,
+			script: "76a914", amount: 100000 },
+		&utxo{ txid: strings.Repeat("cd", 32), vout: 7,
+			script: "", amount: 1 },
+	}
+}
+
+func TestTransactionRoundTrip(t *testing.T) {
+	var txs []testTransaction = []testTransaction{
+		newTransferTransaction(1, 5000, "tmFrom", "key", "tmTo", 10000,
+			testUtxos()),
+		newTransferTransaction(2, 5000, "tmFrom", "key", "tmTo", 0,
+			[]*utxo{}),
+		newFanoutTransaction(3, "tmFrom", "key", false, []*payment{
+			&payment{ address: "tmA", amount: 1 },
+			&payment{ address: "tmB", amount: 2 },
+		}, 15000, testUtxos()),
+		newFanoutTransaction(4, "zsFrom", "zkey", true, []*payment{
+			&payment{ address: "zsA", amount: 3 },
+		}, 0, []*utxo{}),
+		newConsolidateTransaction(5, "zsFrom", "zkey", true, 50),
+		newMemoTransaction(6, 1, "zsFrom", "zkey", "zsTo", "zkeyTo",
+			[]byte("hello")),
+	}
+	var decoded transaction
+	var buffer bytes.Buffer
+	var err error
+	var i int
+
+	for i = range txs {
+		buffer.Reset()
+
+		err = txs[i].encode(&buffer)
+		if err != nil {
+			t.Fatalf("transaction %d: encode: %s", i, err.Error())
+		}
+
+		decoded, err = decodeTransaction(&buffer)
+		if err != nil {
+			t.Fatalf("transaction %d: decode: %s", i, err.Error())
+		}
+
+		if !reflect.DeepEqual(decoded, transaction(txs[i])) {
+			t.Fatalf("transaction %d: decoded %v, expected %v", i,
+				decoded, txs[i])
+		}
+
+		if buffer.Len() != 0 {
+			t.Fatalf("transaction %d: %d bytes left", i,
+				buffer.Len())
+		}
+	}
+}
+
+func TestTransactionTruncated(t *testing.T) {
+	var buffer bytes.Buffer
+	var encoded []byte
+	var err error
+	var n int
+
+	err = newFanoutTransaction(1, "tmFrom", "key", false, []*payment{
+		&payment{ address: "tmA", amount: 1 },
+	}, 10000, testUtxos()).encode(&buffer)
+	if err != nil {
+		t.Fatalf("encode: %s", err.Error())
+	}
+
+	encoded = buffer.Bytes()
+
+	for n = 0; n < len(encoded); n++ {
+		_, err = decodeTransaction(bytes.NewReader(encoded[:n]))
+		if err == nil {
+			t.Fatalf("decoded %d of %d bytes", n, len(encoded))
+		}
+	}
+}
+
+func TestTransactionTooLong(t *testing.T) {
+	var buffer bytes.Buffer
+	var err error
+
+	err = newMemoTransaction(1, 1, "zsFrom", "zkey", "zsTo", "zkeyTo",
+		make([]byte, memoSize + 1)).encode(&buffer)
+	if err == nil {
+		t.Fatalf("memo of %d bytes encoded", memoSize + 1)
+	}
+
+	err = newTransferTransaction(1, 1, strings.Repeat("t", 65536), "key",
+		"tmTo", 0, nil).encode(&buffer)
+	if err == nil {
+		t.Fatalf("address of 65536 bytes encoded")
+	}
+}
+
+func TestCheckMemo(t *testing.T) {
+	var tx *memoTransaction
+	var padded []byte
+
+	tx = newMemoTransaction(1, 1, "zsFrom", "zkey", "zsTo", "zkeyTo",
+		[]byte("hello"))
+	padded = make([]byte, memoSize)
+	copy(padded, "hello")
+
+	if !tx.checkMemo(hex.EncodeToString(padded)) {
+		t.Fatalf("padded memo rejected")
+	}
+
+	if !tx.checkMemo(hex.EncodeToString([]byte("hello"))) {
+		t.Fatalf("unpadded memo rejected")
+	}
+
+	if tx.checkMemo(hex.EncodeToString([]byte("hell"))) {
+		t.Fatalf("truncated memo accepted")
+	}
+
+	padded[memoSize - 1] = 1
+	if tx.checkMemo(hex.EncodeToString(padded)) {
+		t.Fatalf("memo with trailing garbage accepted")
+	}
+
+	if tx.checkMemo("not hex") {
+		t.Fatalf("invalid hexadecimal accepted")
+	}
+
+	tx = newMemoTransaction(1, 1, "zsFrom", "zkey", "zsTo", "zkeyTo",
+		[]byte{})
+	padded = make([]byte, memoSize)
+	padded[0] = 0xf6
+
+	if !tx.checkMemo(hex.EncodeToString(padded)) {
+		t.Fatalf("empty memo rejected")
+	}
+
+	if tx.checkMemo(hex.EncodeToString(make([]byte, memoSize))) {
+		t.Fatalf("empty memo without 0xf6 marker accepted")
+	}
+}
@@ -4,8 +4,10 @@ package core
 import (
 	"fmt"
 	"gopkg.in/yaml.v3"
+	"math"
+	"math/rand"
 	"os"
-	"sort"
+	"path/filepath"
 )
 
 
@@ -136,6 +138,13 @@ type BenchmarkExpression interface {
 
 	String() (StringVariable, error)
 	GetString() (string, error)
+
+	// Return the seed of the random sample described by this expression
+	// assumed as a mapping and record it in the results under `name`.
+	// The seed is given by the optional `seed` field, either as an int or
+	// as a string, and is otherwise drawn from the master seed.
+	//
+	Seed(name string) (int64, error)
 }
 
 
@@ -225,10 +234,11 @@ func (this *benchmark) UnmarshalYAML(node *yaml.Node) error {
 
 func (this *benchmark) parse(expr BenchmarkExpression) error {
 	var fields []BenchmarkExpression
+	var workload interactionGenerator
 	var field BenchmarkExpression
+	var sys *system
 	var global scope
 	var err error
-	var i int
 
 	field, err = expr.TryField("let")
 	if err == nil {
@@ -242,18 +252,49 @@ func (this *benchmark) parse(expr BenchmarkExpression) error {
 		expr.specialize(global)
 	}
 
+	sys = this.context.system()
+
+	field, err = expr.TryField("phases")
+	if err == nil {
+		sys.phases, err = parsePhases(field)
+		if err != nil {
+			err = sys.report(err)
+			if err != nil {
+				return err
+			}
+		}
+	}
+
 	fields = expr.Field("workloads").Slice()
 
-	this.workloads = make([]interactionGenerator, len(fields))
+	this.workloads = make([]interactionGenerator, 0, len(fields))
 
-	for i, field = range fields {
-		this.workloads[i], err = parseWorkload(field)
+	for _, field = range fields {
+		workload, err = parseWorkload(field)
 		if err != nil {
-			return err
+			err = sys.report(err)
+			if err != nil {
+				return err
+			}
+
+			skipExpression(field)
+
+			continue
 		}
+
+		this.workloads = append(this.workloads, workload)
 	}
 
-	return this.instantiate()
+	err = this.instantiate()
+	if err != nil {
+		return err
+	}
+
+	if sys.checking {
+		return expr.Finish()
+	}
+
+	return nil
 }
 
 func (this *benchmark) generate() <-chan *benchmarkInteraction {
@@ -274,30 +315,69 @@ func (this *benchmark) generate() <-chan *benchmarkInteraction {
 }
 
 func (this *benchmark) instantiate() error {
+	var info *interactionInformation
 	var iact *benchmarkInteraction
 	var globalIndex int
 	var encoded []byte
+	var time float64
+	var sys *system
 	var err error
 
 	globalIndex = 0
 
+	sys = this.context.system()
+
 	for iact = range this.generate() {
+		if iact.err != nil {
+			err = sys.report(iact.err)
+			if err != nil {
+				return err
+			}
+
+			continue
+		}
+
 		iact.source.specialize(iact.current)
 
-		encoded, err = iact.factory.Instance(iact.source,
-			&interactionInformation{
-				globalIndex: globalIndex,
-				scheduleTime: iact.scheduleTime,
-			})
+		info = &interactionInformation{
+			globalIndex: globalIndex,
+			scheduleTime: iact.scheduleTime,
+		}
+
+		encoded, err = iact.factory.Instance(iact.source, info)
+
+		if (err == nil) && (iact.loop != 0) {
+			time = 0
+
+			if iact.think != nil {
+				iact.think.specialize(iact.current)
+				time, err = iact.think.GetFloat()
+				iact.think.specialize(nil)
+			}
+
+			if (err == nil) && (time < 0) {
+				err = fmt.Errorf("%s: negative think time " +
+					"(%f)", iact.think.FullPosition(), time)
+			}
+		} else {
+			time = iact.scheduleTime
+		}
 
 		iact.source.specialize(nil)
 
 		if err != nil {
-			return err
+			err = sys.report(err)
+			if err != nil {
+				return err
+			}
+
+			skipExpression(iact.source)
+
+			continue
 		}
 
-		err = iact.sendingClient.sendInteraction(
-			iact.source.FullPosition(), iact.scheduleTime, encoded)
+		err = iact.sendingClient.sendInteraction(iact.loop,
+			iact.kind, info.properties, time, encoded)
 		if err != nil {
 			return err
 		}
@@ -315,6 +395,10 @@ type benchmarkInteraction struct {
 	factory        InteractionFactory
 	source         BenchmarkExpression
 	current        scope
+	kind           *interactionKind
+	loop           int                  // closed loop index or 0
+	think          BenchmarkExpression  // think time if in closed loop
+	err            error                // generation failure
 }
 
 type interactionInformation struct {
@@ -322,6 +406,7 @@ type interactionInformation struct {
 	clientIndex   int
 	localIndex    int
 	scheduleTime  float64
+	properties    map[string]int
 }
 
 func (this *interactionInformation) TotalOrder() int {
@@ -340,6 +425,14 @@ func (this *interactionInformation) ClientId() int {
 	return this.clientIndex
 }
 
+func (this *interactionInformation) SetProperty(name string, value int) {
+	if this.properties == nil {
+		this.properties = make(map[string]int)
+	}
+
+	this.properties[name] = value
+}
+
 type interactionGenerator interface {
 	generate() <-chan *benchmarkInteraction
 }
@@ -355,7 +448,7 @@ func fuseGenerators(out chan<- *benchmarkInteraction, ins []<-chan *benchmarkInt
 		elements[i], _ = <- ins[i]
 	}
 
-	for {
+	for len(elements) > 0 {
 		min = 0
 
 		for i, element = range elements {
@@ -388,6 +481,31 @@ func fuseGenerators(out chan<- *benchmarkInteraction, ins []<-chan *benchmarkInt
 
 
 
+// Mark every field of `expr` and of its subexpressions as used.
+// The parsing of an expression stops at the first error so the fields it has
+// not read yet must not be reported as unknown.
+//
+func skipExpression(expr BenchmarkExpression) {
+	var children []BenchmarkExpression
+	var child BenchmarkExpression
+	var err error
+
+	children, err = expr.TryMap()
+	if err == nil {
+		for _, child = range children {
+			skipExpression(child.Value())
+		}
+	}
+
+	children, err = expr.TrySlice()
+	if err == nil {
+		for _, child = range children {
+			skipExpression(child)
+		}
+	}
+}
+
+
 type workloadGenerator struct {
 	clientLoads  []interactionGenerator
 }
@@ -460,12 +578,12 @@ func parseClient(expr BenchmarkExpression) (*clientLoadGenerator, error) {
 	var behaviors []BenchmarkExpression
 	var field BenchmarkExpression
 	var this clientLoadGenerator
+	var load interactionGenerator
 	var element interface{}
 	var view []string
 	var loc location
 	var local scope
 	var err error
-	var i int
 
 	field, err = expr.TryField("let")
 	if err == nil {
@@ -497,15 +615,22 @@ func parseClient(expr BenchmarkExpression) (*clientLoadGenerator, error) {
 
 	behaviors = expr.Field("behavior").Slice()
 
-	this.loads = make([]interactionGenerator, len(behaviors))
+	this.loads = make([]interactionGenerator, 0, len(behaviors))
 
-	for i, field = range behaviors {
-		this.loads[i], err = parseLoad(field, this.target)
+	for _, field = range behaviors {
+		load, err = parseLoad(field, this.target)
 		if err != nil {
-			return nil, err
+			err = expr.system().report(err)
+			if err != nil {
+				return nil, err
+			}
+
+			skipExpression(field)
+
+			continue
 		}
 
-		
+		this.loads = append(this.loads, load)
 	}
 
 	return &this, nil
@@ -518,7 +643,6 @@ func parseView(client BenchmarkExpression) ([]string, error) {
 	var view Variable
 	var seed64 int64
 	var err error
-	var seed int
 
 	vfield = client.Field("view")
 	view, err = vfield.Resource("endpoint")
@@ -532,18 +656,17 @@ func parseView(client BenchmarkExpression) ([]string, error) {
 
 		sfield, err = vfield.TryField("seed")
 		if err == nil {
-			fmt.Printf("explicit seed\n")
-			seed, err = sfield.GetInt()
+			seed64, err = parseSeed(sfield)
 			if err != nil {
 				return nil, err
 			}
-
-			seed64 = int64(seed)
 		} else {
 			seed64 = client.system().seed()
 		}
 	}
 
+	client.system().recordSeed(vfield.FullPosition(), "view", seed64)
+
 	view = copyVariable(view, seed64, TypeOnce)
 
 	for {
@@ -556,8 +679,8 @@ func parseView(client BenchmarkExpression) ([]string, error) {
 	}
 
 	if len(addrs) == 0 {
-		return nil, fmt.Errorf("%s: variable exhausted",
-			vfield.FullPosition())
+		return nil, fmt.Errorf("%s: %w",
+			vfield.FullPosition(), errVariableExhausted)
 	}
 
 	return addrs, nil
@@ -592,6 +715,12 @@ func parseLoad(expr BenchmarkExpression, sender client) (interactionGenerator, e
 
 	if btype == "timeload" {
 		return parseTimeload(expr, sender)
+	} else if btype == "poisson" {
+		return parsePoisson(expr, sender)
+	} else if btype == "closedloop" {
+		return parseClosedloop(expr, sender)
+	} else if btype == "trace" {
+		return parseTrace(expr, sender)
 	}
 
 	return nil, fmt.Errorf("%s: unknown behavior '%s'",
@@ -599,52 +728,115 @@ func parseLoad(expr BenchmarkExpression, sender client) (interactionGenerator, e
 }
 
 
-type timeloadGenerator struct {
-	load     map[float64]float64
-	sender   client
+// What an interaction is, as reported in the results.
+//
+type interactionKind struct {
+	name   string              // position of the interaction
+	label  string              // user defined label or empty
+	itype  string              // type of the interaction
+	steps  []*interactionKind  // steps of a sequence or nil
+}
+
+
+// The interaction generated by a behavior:
+//
+//   behavior:
+//     - label: "local transfer"
+//       interaction: !transfer { from: *a, to: *b, label: "eu transfer" }
+//
+// The optional `label` of the interaction overrides the one of the behavior.
+//
+type behaviorInteraction struct {
 	factory  InteractionFactory
 	source   BenchmarkExpression
 	current  scope
+	kind     *interactionKind
 }
 
-func parseTimeload(expr BenchmarkExpression, sender client) (*timeloadGenerator, error) {
-	var load, interaction BenchmarkExpression
-	var this timeloadGenerator
-	var itype string
-	var time float64
+func (this *behaviorInteraction) parse(behavior BenchmarkExpression) error {
+	var interaction, field BenchmarkExpression
+	var itype, label string
 	var err error
 	var ok bool
 
-	this.sender = sender
-
-	interaction = expr.Field("interaction")
+	interaction = behavior.Field("interaction")
 	itype, err = interaction.etype()
 	if err != nil {
-		return nil, err
+		return err
 	}
 
 	this.source = interaction
 	this.current = interaction.current()
 
-	this.factory, ok = expr.system().interactionFactory(itype)
+	this.factory, ok = behavior.system().interactionFactory(itype)
 	if !ok {
-		return nil, fmt.Errorf("%s: unknown interaction type '%s'",
+		return fmt.Errorf("%s: unknown interaction type '%s'",
 			interaction.FullPosition(), itype)
 	}
 
-	this.load = make(map[float64]float64)
-	for _, load = range expr.Field("load").Map() {
-		time, err = load.Key().GetFloat()
+	label = ""
+	for _, field = range []BenchmarkExpression{ behavior, interaction } {
+		field, err = field.TryField("label")
 		if err != nil {
-			return nil, err
+			continue
 		}
 
-		if time < 0 {
-			return nil, fmt.Errorf("%s: must be positive or zero",
-				load.Key().FullPosition())
+		label, err = field.GetString()
+		if err != nil {
+			return err
 		}
+	}
+
+	this.kind = &interactionKind{
+		name: interaction.FullPosition(),
+		label: label,
+		itype: itype,
+		steps: nil,
+	}
 
-		this.load[time], err = load.Value().GetFloat()
+	if itype == "sequence" {
+		this.kind.steps, err = parseSequenceSteps(interaction)
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+
+// Generate interactions following a load given as a rate over time (see
+// parseLoadSegments()).
+// A `timeload` triggers an interaction every unit of work, that is every
+// `1/rate` seconds for a constant rate, while a `poisson` draws exponential
+// amounts of work from a seeded random generator.
+//
+type timeloadGenerator struct {
+	behaviorInteraction
+	segments  []loadSegment
+	sender    client
+	rand      *rand.Rand             // nil for evenly spaced interactions
+}
+
+func parseTimeload(expr BenchmarkExpression, sender client) (*timeloadGenerator, error) {
+	var this timeloadGenerator
+	var err error
+
+	this.sender = sender
+
+	err = this.behaviorInteraction.parse(expr)
+	if err != nil {
+		return nil, err
+	}
+
+	this.segments, err = parseLoadSegments(expr)
+	if err != nil {
+		return nil, err
+	}
+
+	if expr.system().checking && (loadDuration(this.segments) <= 0) {
+		err = expr.system().report(fmt.Errorf("%s: load has zero " +
+			"duration", expr.Field("load").FullPosition()))
 		if err != nil {
 			return nil, err
 		}
@@ -653,6 +845,20 @@ func parseTimeload(expr BenchmarkExpression, sender client) (*timeloadGenerator,
 	return &this, nil
 }
 
+func parsePoisson(expr BenchmarkExpression, sender client) (*timeloadGenerator, error) {
+	var this *timeloadGenerator
+	var err error
+
+	this, err = parseTimeload(expr, sender)
+	if err != nil {
+		return nil, err
+	}
+
+	this.rand = rand.New(rand.NewSource(expr.system().seed()))
+
+	return this, nil
+}
+
 func (this *timeloadGenerator) generate() <-chan *benchmarkInteraction {
 	var ret chan *benchmarkInteraction = make(chan *benchmarkInteraction)
 
@@ -661,50 +867,174 @@ func (this *timeloadGenerator) generate() <-chan *benchmarkInteraction {
 	return ret
 }
 
+// Return how much work is needed before the next interaction.
+//
+func (this *timeloadGenerator) next() float64 {
+	if this.rand == nil {
+		return 1
+	} else {
+		return this.rand.ExpFloat64()
+	}
+}
+
 func (this *timeloadGenerator) flatten(out chan<- *benchmarkInteraction) {
-	var key, value, tick, done, clock, wait float64
-	var times []float64
-	var i int
+	var clock, end, work, time float64
+	var segment loadSegment
+	var ok bool
+
+	work = this.next()
+
+	for _, segment = range this.segments {
+		clock, end = segment.span()
 
-	times = make([]float64, 0, len(this.load))
-
-	for key = range this.load {
-		times = append(times, key)
-	}
-
-	sort.Float64s(times)
-
-	key = 0
-	value = 0
-	done = 0
-	for i = range times {
-		if (times[i] != key) && (value != 0) {
-			tick = 1 / value
-			clock = key
-
-			for {
-				wait = (1 - done) * tick
-
-				if (clock + wait) <= times[i] {
-					done = 0
-					clock += wait
-					out <- &benchmarkInteraction{
-						scheduleTime: clock,
-						sendingClient: this.sender,
-						factory: this.factory,
-						source: this.source,
-						current: this.current,
-					}
-				} else {
-					done += (times[i] - clock) / tick
-					clock = times[i]
-					break
-				}
+		for {
+			time, ok = segment.reach(clock, work)
+			if !ok {
+				break
+			}
+
+			clock = time
+			work = this.next()
+			out <- &benchmarkInteraction{
+				scheduleTime: clock,
+				sendingClient: this.sender,
+				factory: this.factory,
+				source: this.source,
+				current: this.current,
+				kind: this.kind,
 			}
 		}
 
-		key = times[i]
-		value = this.load[key]
+		work -= segment.work(clock, end)
+	}
+
+	close(out)
+}
+
+
+// Keep a fixed number of interactions in flight for a given duration:
+//
+//   !closedloop
+//     outstanding: 16      # interactions in flight (default 1)
+//     duration: 60         # seconds
+//     think: *think        # float variable, seconds (default 0)
+//     limit: 10000         # size of the interaction pool
+//     interaction: ...
+//
+// A secondary triggers the next interaction when one commits or aborts,
+// after waiting for the think time of the next interaction.
+// Interactions cannot be generated lazily by the secondary since only the
+// primary holds the builder and the state of its accounts. Instead, they are
+// encoded on the primary before the benchmark starts and the loop draws them
+// from a pool of `limit` interactions.
+// The default limit is 10 interactions per second for each outstanding
+// interaction, which lasts the whole loop as long as interactions take at
+// least 100 milliseconds to commit, a bound below the block time of every
+// supported blockchain. Faster blockchains need a larger `limit`.
+// If the pool is exhausted anyway, the loop stops early and the results
+// record when (see `LoopResult`) so an early stop is not mistaken for the
+// saturation load.
+//
+type closedloopGenerator struct {
+	behaviorInteraction
+	sender       client
+	loop         int
+	duration     float64
+	limit        int
+	think        BenchmarkExpression
+}
+
+func parseClosedloop(expr BenchmarkExpression, sender client) (*closedloopGenerator, error) {
+	var this closedloopGenerator
+	var field BenchmarkExpression
+	var outstanding int
+	var err error
+
+	this.sender = sender
+
+	err = this.behaviorInteraction.parse(expr)
+	if err != nil {
+		return nil, err
+	}
+
+	outstanding = 1
+	field, err = expr.TryField("outstanding")
+	if err == nil {
+		outstanding, err = field.GetInt()
+		if err != nil {
+			return nil, err
+		}
+
+		if outstanding <= 0 {
+			return nil, fmt.Errorf("%s: must be strictly positive",
+				field.FullPosition())
+		}
+	}
+
+	this.duration, err = expr.Field("duration").GetFloat()
+	if err != nil {
+		return nil, err
+	}
+
+	if this.duration <= 0 {
+		return nil, fmt.Errorf("%s: must be strictly positive",
+			expr.Field("duration").FullPosition())
+	}
+
+	field, err = expr.TryField("think")
+	if err == nil {
+		this.think = field
+	}
+
+	this.limit = outstanding * int(math.Ceil(this.duration * 10))
+	field, err = expr.TryField("limit")
+	if err == nil {
+		this.limit, err = field.GetInt()
+		if err != nil {
+			return nil, err
+		}
+
+		if this.limit <= 0 {
+			return nil, fmt.Errorf("%s: must be strictly positive",
+				field.FullPosition())
+		}
+	}
+
+	this.loop, err = sender.createLoop(outstanding, this.duration)
+	if err != nil {
+		return nil, err
+	}
+
+	return &this, nil
+}
+
+func (this *closedloopGenerator) generate() <-chan *benchmarkInteraction {
+	var ret chan *benchmarkInteraction = make(chan *benchmarkInteraction)
+
+	go this.fill(ret)
+
+	return ret
+}
+
+// Generate the pool of interactions.
+// The schedule times are only used to interleave the pool with the other
+// generators when variables are drawn.
+//
+func (this *closedloopGenerator) fill(out chan<- *benchmarkInteraction) {
+	var i int
+
+	for i = 0; i < this.limit; i++ {
+		out <- &benchmarkInteraction{
+			scheduleTime: this.duration * float64(i) /
+				float64(this.limit),
+			sendingClient: this.sender,
+			factory: this.factory,
+			source: this.source,
+			current: this.current,
+			kind: this.kind,
+			loop: this.loop,
+			think: this.think,
+		}
 	}
 
 	close(out)
@@ -846,8 +1176,28 @@ func (this *errorExpression) GetString() (string, error) {
 	return "", this.err
 }
 
+func (this *errorExpression) Seed(string) (int64, error) {
+	return 0, this.err
+}
+
 
 func parseBenchmarkYaml(context benchmarkContext, node *yaml.Node) (BenchmarkExpression, error) {
+	if node.Tag == "!include" {
+		return parseBenchmarkYamlInclude(context, node)
+	}
+
+	if node.Tag == "!param" {
+		return parseBenchmarkYamlParam(context, node)
+	}
+
+	if (node.Kind == yaml.ScalarNode) && (node.Tag == "!var") {
+		return parseBenchmarkYamlAlias(context, node)
+	}
+
+	if (node.Kind == yaml.ScalarNode) && (node.Tag == "!expr") {
+		return parseBenchmarkYamlExpr(context, node)
+	}
+
 	if node.Kind == yaml.MappingNode {
 		return parseBenchmarkYamlMapping(context, node)
 	}
@@ -869,6 +1219,174 @@ func parseBenchmarkYaml(context benchmarkContext, node *yaml.Node) (BenchmarkExp
 }
 
 
+// Replace `!include path` by the content of the YAML file at the given path.
+// A relative path is relative to the directory of the including file.
+// Since YAML anchors do not cross files, the variables defined in an included
+// file are referenced with `!var name` instead of `*name`.
+//
+func parseBenchmarkYamlInclude(context benchmarkContext, node *yaml.Node) (BenchmarkExpression, error) {
+	var include *sourceContext
+	var content []byte
+	var root yaml.Node
+	var path string
+	var sys *system
+	var err error
+
+	if node.Kind != yaml.ScalarNode {
+		return nil, fmt.Errorf("%s:%d:%d: include must be a path",
+			context.Source(), node.Line, node.Column)
+	}
+
+	path = node.Value
+	if !filepath.IsAbs(path) {
+		path = filepath.Join(filepath.Dir(context.Source()), path)
+	}
+
+	sys = context.system()
+	if sys.includes[path] {
+		return nil, fmt.Errorf("%s:%d:%d: recursive include of '%s'",
+			context.Source(), node.Line, node.Column, path)
+	}
+
+	content, err = os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("%s:%d:%d: %s", context.Source(),
+			node.Line, node.Column, err.Error())
+	}
+
+	err = yaml.Unmarshal(content, &root)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %s", path, err.Error())
+	}
+
+	if len(root.Content) == 0 {
+		return nil, fmt.Errorf("%s:%d:%d: empty include '%s'",
+			context.Source(), node.Line, node.Column, path)
+	}
+
+	Tracef("include '%s'", path)
+
+	sys.includes[path] = true
+	defer delete(sys.includes, path)
+
+	include = newSourceContext(context, path)
+
+	return parseBenchmarkYaml(include, root.Content[0])
+}
+
+// Replace `!param name` by the value given on the command line with
+// `--define name=value`.
+// The value is parsed as YAML so it can be a number, a string or even a
+// mapping. The form `!param { name: rate, default: 10 }` gives a value to use
+// when the parameter is not defined.
+//
+func parseBenchmarkYamlParam(context benchmarkContext, node *yaml.Node) (BenchmarkExpression, error) {
+	var fallback, value *yaml.Node
+	var name, define string
+	var root yaml.Node
+	var err error
+	var ok bool
+	var i int
+
+	if node.Kind == yaml.ScalarNode {
+		name = node.Value
+	} else if node.Kind == yaml.MappingNode {
+		for i = 0; (i + 1) < len(node.Content); i += 2 {
+			if node.Content[i].Value == "name" {
+				name = node.Content[i + 1].Value
+			} else if node.Content[i].Value == "default" {
+				fallback = node.Content[i + 1]
+			} else {
+				return nil, fmt.Errorf("%s:%d:%d: unknown " +
+					"field '%s'", context.Source(),
+					node.Content[i].Line,
+					node.Content[i].Column,
+					node.Content[i].Value)
+			}
+		}
+	}
+
+	if name == "" {
+		return nil, fmt.Errorf("%s:%d:%d: parameter must have a name",
+			context.Source(), node.Line, node.Column)
+	}
+
+	define, ok = context.system().defines[name]
+	if !ok {
+		if fallback == nil {
+			return nil, fmt.Errorf("%s:%d:%d: undefined parameter " +
+				"'%s'", context.Source(), node.Line,
+				node.Column, name)
+		}
+
+		return parseBenchmarkYaml(context, fallback)
+	}
+
+	err = yaml.Unmarshal([]byte(define), &root)
+	if err != nil {
+		return nil, fmt.Errorf("--define %s: %s", name, err.Error())
+	}
+
+	if len(root.Content) == 0 {
+		value = &yaml.Node{ Kind: yaml.ScalarNode, Tag: "!!str" }
+	} else {
+		value = root.Content[0]
+	}
+
+	// Plain strings are quoted in benchmark files.
+	//
+	if (value.Kind == yaml.ScalarNode) && (value.Tag == "!!str") &&
+		(value.Style == 0) {
+		value.Style = yaml.DoubleQuotedStyle
+	}
+
+	return parseBenchmarkYaml(newSourceContext(context,
+		"--define " + name), value)
+}
+
+
+// The context of expressions coming from another source than their parent,
+// such as an included file or a parameter given on the command line.
+//
+type sourceContext struct {
+	parent  benchmarkContext
+	source  string
+	slocal  scope
+}
+
+func newSourceContext(parent benchmarkContext, source string) *sourceContext {
+	return &sourceContext{
+		parent: parent,
+		source: source,
+		slocal: nil,
+	}
+}
+
+func (this *sourceContext) system() *system {
+	return this.parent.system()
+}
+
+func (this *sourceContext) Source() string {
+	return this.source
+}
+
+func (this *sourceContext) local() scope {
+	return this.slocal
+}
+
+func (this *sourceContext) current() scope {
+	if this.slocal != nil {
+		return this.slocal
+	} else {
+		return this.parent.current()
+	}
+}
+
+func (this *sourceContext) specialize(slocal scope) {
+	this.slocal = slocal
+}
+
+
 type benchmarkYamlNode struct {
 	parent  benchmarkContext
 	node    *yaml.Node
@@ -921,7 +1439,7 @@ func (this *benchmarkYamlNode) etype() (string, error) {
 	this.texpl = true
 
 	if (this.node.Style & yaml.TaggedStyle) == 0 {
-		return "", fmt.Errorf("%s:%s: no specified type",
+		return "", fmt.Errorf("%s: no specified type",
 			this.FullPosition())
 	}
 
@@ -1036,6 +1554,10 @@ func (this *benchmarkYamlNode) GetString() (string, error) {
 	return "", fmt.Errorf("%s: must be a string", this.FullPosition())
 }
 
+func (this *benchmarkYamlNode) Seed(string) (int64, error) {
+	return 0, fmt.Errorf("%s: must be a mapping", this.FullPosition())
+}
+
 
 type benchmarkYamlField struct {
 	benchmarkYamlNode
@@ -1079,6 +1601,7 @@ type benchmarkYamlMapping struct {
 	benchmarkYamlNode
 	index  map[string]int
 	fields []BenchmarkExpression
+	used   []bool                 // fields returned by a method
 }
 
 func parseBenchmarkYamlMapping(context benchmarkContext, node *yaml.Node) (BenchmarkExpression, error) {
@@ -1091,6 +1614,7 @@ func parseBenchmarkYamlMapping(context benchmarkContext, node *yaml.Node) (Bench
 	this.init(context, node)
 	this.index = make(map[string]int, len(node.Content) / 2)
 	this.fields = make([]BenchmarkExpression, len(node.Content) / 2)
+	this.used = make([]bool, len(this.fields))
 
 	for i = 0; i < len(this.fields); i++ {
 		key = node.Content[i * 2]
@@ -1137,18 +1661,77 @@ func (this *benchmarkYamlMapping) TryField(name string) (BenchmarkExpression, er
 			this.FullPosition(), name)
 	}
 
+	this.used[index] = true
+
 	return this.fields[index].Value(), nil
 }
 
+func (this *benchmarkYamlMapping) Seed(name string) (int64, error) {
+	var field BenchmarkExpression
+	var seed int64
+	var err error
+
+	field, err = this.TryField("seed")
+	if err == nil {
+		seed, err = parseSeed(field)
+		if err != nil {
+			return 0, err
+		}
+	} else {
+		seed = this.system().seed()
+	}
+
+	this.system().recordSeed(this.FullPosition(), name, seed)
+
+	return seed, nil
+}
+
 func (this *benchmarkYamlMapping) Map() []BenchmarkExpression {
+	var i int
+
+	for i = range this.used {
+		this.used[i] = true
+	}
+
 	return this.fields
 }
 
 func (this *benchmarkYamlMapping) TryMap() ([]BenchmarkExpression, error) {
-	return this.fields, nil
+	return this.Map(), nil
 }
 
+// A mapping none of which fields have been used has never been parsed (e.g.
+// the interaction of a behavior which never triggers) so its fields are not
+// reported as unknown.
+//
 func (this *benchmarkYamlMapping) Finish() error {
+	var explored bool
+	var err error
+	var i int
+
+	explored = false
+	for i = range this.used {
+		explored = explored || this.used[i]
+	}
+
+	if !explored {
+		return nil
+	}
+
+	for i = range this.fields {
+		if !this.used[i] {
+			err = this.system().report(fmt.Errorf("%s: unknown " +
+				"field '%s'", this.fields[i].Key().FullPosition(),
+				this.node.Content[i * 2].Value))
+		} else {
+			err = this.fields[i].Value().Finish()
+		}
+
+		if err != nil {
+			return err
+		}
+	}
+
 	return nil
 }
 
@@ -1186,6 +1769,16 @@ func (this *benchmarkYamlSequence) TrySlice() ([]BenchmarkExpression, error) {
 }
 
 func (this *benchmarkYamlSequence) Finish() error {
+	var item BenchmarkExpression
+	var err error
+
+	for _, item = range this.items {
+		err = item.Finish()
+		if err != nil {
+			return err
+		}
+	}
+
 	return nil
 }
 
@@ -1393,8 +1986,8 @@ func (this *benchmarkYamlAlias) GetResource(domain string) (interface{}, error)
 
 	resource = variable.Get()
 	if resource == nil {
-		return nil, fmt.Errorf("%s: variable exhausted",
-			this.FullPosition())
+		return nil, fmt.Errorf("%s: %w",
+			this.FullPosition(), errVariableExhausted)
 	}
 
 	return resource, nil
@@ -1438,8 +2031,8 @@ func (this *benchmarkYamlAlias) GetInt() (int, error) {
 
 	i, ok = v.TryGetInt()
 	if !ok {
-		return 0, fmt.Errorf("%s: variable exhausted",
-			this.FullPosition())
+		return 0, fmt.Errorf("%s: %w",
+			this.FullPosition(), errVariableExhausted)
 	}
 
 	return i, nil
@@ -1487,8 +2080,8 @@ func (this *benchmarkYamlAlias) GetFloat() (float64, error) {
 
 	f, ok = v.TryGetFloat()
 	if !ok {
-		return 0, fmt.Errorf("%s: variable exhausted",
-			this.FullPosition())
+		return 0, fmt.Errorf("%s: %w",
+			this.FullPosition(), errVariableExhausted)
 	}
 
 	return f, nil
@@ -1532,8 +2125,8 @@ func (this *benchmarkYamlAlias) GetString() (string, error) {
 
 	s, ok = v.TryGetString()
 	if !ok {
-		return "", fmt.Errorf("%s: variable exhausted",
-			this.FullPosition())
+		return "", fmt.Errorf("%s: %w",
+			this.FullPosition(), errVariableExhausted)
 	}
 
 	return s, nil
@@ -0,0 +1,303 @@
+package core
+
+
+import (
+	"math"
+	"math/rand"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+
+func getTestSchedule(generator interactionGenerator) []float64 {
+	var iact *benchmarkInteraction
+	var ret []float64
+
+	ret = make([]float64, 0)
+
+	for iact = range generator.generate() {
+		ret = append(ret, iact.scheduleTime)
+	}
+
+	return ret
+}
+
+
+func TestTimeloadEvenlySpaced(t *testing.T) {
+	var generator *timeloadGenerator
+	var times []float64
+	var i int
+
+	generator = &timeloadGenerator{
+		segments: newLoadSegments(map[float64]float64{ 0: 4, 10: 0 },
+			false),
+	}
+
+	times = getTestSchedule(generator)
+	if len(times) != 40 {
+		t.Fatalf("got %d interactions, expected 40", len(times))
+	}
+
+	for i = range times {
+		if times[i] != float64(i + 1) / 4 {
+			t.Fatalf("interaction %d at %f", i, times[i])
+		}
+	}
+}
+
+func TestPoissonSchedule(t *testing.T) {
+	var generator *timeloadGenerator
+	var a, b []float64
+	var i int
+
+	generator = &timeloadGenerator{
+		segments: newLoadSegments(map[float64]float64{
+			0: 100, 50: 0, 60: 100, 100: 0,
+		}, false),
+		rand: rand.New(rand.NewSource(42)),
+	}
+
+	a = getTestSchedule(generator)
+
+	// Expect 9000 interactions, the standard deviation is less than 100.
+	if (len(a) < 8500) || (len(a) > 9500) {
+		t.Fatalf("got %d interactions, expected about 9000", len(a))
+	}
+
+	for i = range a {
+		if (a[i] > 50) && (a[i] <= 60) {
+			t.Fatalf("interaction %d at %f with no load", i, a[i])
+		}
+
+		if (i > 0) && (a[i] < a[i-1]) {
+			t.Fatalf("interaction %d at %f before %f", i, a[i],
+				a[i-1])
+		}
+	}
+
+	generator.rand = rand.New(rand.NewSource(42))
+	b = getTestSchedule(generator)
+
+	if len(a) != len(b) {
+		t.Fatalf("same seed: %d != %d interactions", len(a), len(b))
+	}
+
+	for i = range a {
+		if a[i] != b[i] {
+			t.Fatalf("same seed: interaction %d at %f != %f", i,
+				a[i], b[i])
+		}
+	}
+}
+
+func TestTimeloadLinear(t *testing.T) {
+	var segments [][]loadSegment
+	var times []float64
+	var i, j int
+
+	// A rate of `t` does `t^2 / 2` work so the k-th interaction is at
+	// `sqrt(2k)`.
+	segments = [][]loadSegment{
+		newLoadSegments(map[float64]float64{ 0: 0, 10: 10 }, true),
+		[]loadSegment{ newLinearSegment(0, 10, 0, 10) },
+		[]loadSegment{
+			newLinearSegment(0, 4, 0, 4),
+			newLinearSegment(4, 10, 4, 10),
+		},
+	}
+
+	for i = range segments {
+		times = getTestSchedule(&timeloadGenerator{
+			segments: segments[i],
+		})
+
+		if len(times) != 50 {
+			t.Fatalf("shape %d: got %d interactions, expected 50",
+				i, len(times))
+		}
+
+		for j = range times {
+			if math.Abs(times[j] - math.Sqrt(float64(2*(j+1)))) >
+				1e-9 {
+				t.Fatalf("shape %d: interaction %d at %f", i,
+					j, times[j])
+			}
+		}
+	}
+}
+
+func TestTimeloadSine(t *testing.T) {
+	var generator *timeloadGenerator
+	var times []float64
+	var i, peak, trough int
+
+	// Two periods around a base of 10 do 80 units of work, the last
+	// interaction falls on the end up to rounding errors.
+	generator = &timeloadGenerator{
+		segments: []loadSegment{ newSineSegment(0, 8, 10, 5, 4) },
+	}
+
+	times = getTestSchedule(generator)
+	if (len(times) < 79) || (len(times) > 80) {
+		t.Fatalf("got %d interactions, expected 80", len(times))
+	}
+
+	for i = range times {
+		if (i > 0) && (times[i] <= times[i-1]) {
+			t.Fatalf("interaction %d at %f after %f", i, times[i],
+				times[i-1])
+		}
+
+		// The rate peaks in [0, 2] and drops in [2, 4].
+		if times[i] < 2 {
+			peak += 1
+		} else if times[i] < 4 {
+			trough += 1
+		}
+	}
+
+	if peak <= trough {
+		t.Fatalf("got %d interactions during peak and %d during " +
+			"trough", peak, trough)
+	}
+}
+
+func TestLoadShapeErrors(t *testing.T) {
+	var sys *system = newTestSystem()
+	var expr BenchmarkExpression
+	var src string
+	var err error
+
+	for _, src = range []string{
+		`{ load: !ramp { from: -1, to: 10, end: 10 } }`,
+		`{ load: !ramp { from: 1, to: 10, start: 10, end: 5 } }`,
+		`{ load: !sine { base: 1, amplitude: 2, period: 1, end: 5 } }`,
+		`{ load: !sine { base: 2, amplitude: 1, period: 0, end: 5 } }`,
+		`{ load: !square { end: 5 } }`,
+		`{ load: { 0: 1, 10: 0 }, interpolation: "cubic" }`,
+		`{ load: { 0: -1, 10: 0 } }`,
+	} {
+		expr, err = parseTestExpression(sys, src)
+		if err != nil {
+			t.Fatalf("parse: %s", err.Error())
+		}
+
+		_, err = parseLoadSegments(expr)
+		if err == nil {
+			t.Errorf("expected error for: %s", src)
+		}
+	}
+}
+
+
+func writeTestFile(t *testing.T, path, content string) {
+	var err error
+
+	err = os.WriteFile(path, []byte(content), 0644)
+	if err != nil {
+		t.Fatalf("write: %s", err.Error())
+	}
+}
+
+func TestInclude(t *testing.T) {
+	var dir string = t.TempDir()
+	var expr BenchmarkExpression
+	var s scope
+	var err error
+
+	writeTestFile(t, filepath.Join(dir, "vars.yaml"), `
+&a { sample: !integer { from: 0, to: 3 } }
+`)
+	writeTestFile(t, filepath.Join(dir, "main.yaml"), `
+- !include vars.yaml
+- &b { sample: !integer { from: 2, to: 5 } }
+- &c { compose: !union [ !var a, *b ] }
+`)
+
+	s = parseTestScope(t, newTestSystem(), "!include " +
+		filepath.Join(dir, "main.yaml"))
+
+	assertInts(t, "include", getTestInts(t, s, "a"), []int{ 0, 1, 2, 3 })
+	assertInts(t, "include", getTestInts(t, s, "c"),
+		[]int{ 0, 1, 2, 3, 4, 5 })
+
+	writeTestFile(t, filepath.Join(dir, "bad.yaml"), `
+{ from: 0, to: "three" }
+`)
+
+	expr, err = parseTestExpression(newTestSystem(), "!include " +
+		filepath.Join(dir, "bad.yaml"))
+	if err != nil {
+		t.Fatalf("parse: %s", err.Error())
+	}
+
+	if !strings.HasPrefix(expr.Field("to").FullPosition(),
+		filepath.Join(dir, "bad.yaml") + ":2:") {
+		t.Fatalf("wrong position '%s'", expr.Field("to").FullPosition())
+	}
+}
+
+func TestIncludeErrors(t *testing.T) {
+	var dir string = t.TempDir()
+	var err error
+
+	writeTestFile(t, filepath.Join(dir, "a.yaml"), "!include b.yaml\n")
+	writeTestFile(t, filepath.Join(dir, "b.yaml"), "!include a.yaml\n")
+
+	_, err = parseTestExpression(newTestSystem(), "!include " +
+		filepath.Join(dir, "a.yaml"))
+	if (err == nil) || !strings.Contains(err.Error(), "recursive") {
+		t.Fatalf("recursive include not detected: %v", err)
+	}
+
+	_, err = parseTestExpression(newTestSystem(), "!include " +
+		filepath.Join(dir, "missing.yaml"))
+	if err == nil {
+		t.Fatalf("missing include not detected")
+	}
+}
+
+func TestParam(t *testing.T) {
+	var sys *system = newTestSystem()
+	var expr BenchmarkExpression
+	var str string
+	var err error
+	var i int
+
+	sys.defines["rate"] = "25"
+	sys.defines["chain"] = "ethereum"
+
+	expr, err = parseTestExpression(sys, `
+{ rate: !param rate, chain: !param chain,
+  size: !param { name: size, default: 8 } }
+`)
+	if err != nil {
+		t.Fatalf("parse: %s", err.Error())
+	}
+
+	i, err = expr.Field("rate").GetInt()
+	if (err != nil) || (i != 25) {
+		t.Fatalf("got rate %d (%v), expected 25", i, err)
+	}
+
+	str, err = expr.Field("chain").GetString()
+	if (err != nil) || (str != "ethereum") {
+		t.Fatalf("got chain '%s' (%v), expected 'ethereum'", str, err)
+	}
+
+	i, err = expr.Field("size").GetInt()
+	if (err != nil) || (i != 8) {
+		t.Fatalf("got size %d (%v), expected 8", i, err)
+	}
+
+	if expr.Field("rate").Source() != "--define rate" {
+		t.Fatalf("wrong source '%s'", expr.Field("rate").Source())
+	}
+
+	_, err = parseTestExpression(sys, "{ rate: !param duration }")
+	if (err == nil) || !strings.Contains(err.Error(), "undefined") {
+		t.Fatalf("undefined parameter not detected: %v", err)
+	}
+}
@@ -2,7 +2,10 @@ package core
 
 
 import (
+	"errors"
 	"fmt"
+	"strings"
+	"time"
 )
 
 
@@ -22,6 +25,12 @@ type InteractionInfo interface {
 	// beginning of the benchmark.
 	//
 	Timestamp() float64
+
+	// Attach a numeric property `name` to the interaction being encoded
+	// (e.g. the number of outputs of a transaction).
+	// Properties are recorded along with the interaction in the results.
+	//
+	SetProperty(name string, value int)
 }
 
 
@@ -46,6 +55,19 @@ type BlockchainInterface interface {
 	Client(params map[string]string, env, view []string, logger Logger) (BlockchainClient, error)
 }
 
+// A blockchain interface can also implement this interface to let Diablo plan
+// or check a benchmark with the interactions specific to this blockchain but
+// without contacting it.
+//
+type BlockchainOfflineInterface interface {
+	// Create a blockchain initializer like `Builder` does but which never
+	// contacts the blockchain.
+	// The accounts and contracts it creates can be placeholders so the
+	// interactions it encodes are only good to plan or check a benchmark.
+	//
+	OfflineBuilder(params map[string]string, env []string, endpoints map[string][]string, logger Logger) (BlockchainBuilder, error)
+}
+
 type BlockchainBuilder interface {
 	CreateAccount(stake int) (interface{}, error)
 
@@ -65,11 +87,34 @@ type BlockchainBuilder interface {
 	//
 	EncodeTransfer(amount int, from, to interface{}, info InteractionInfo) ([]byte, error)
 
-	EncodeInvoke(from interface{}, contract interface{}, function string, info InteractionInfo) ([]byte, error)
+	// Encode an invoke interaction.
+	// An invoke calls the `function` of a `contract` from an account
+	// `from` with the given arguments `args`.
+	// Each argument is either an `int`, a `string` or a resource created
+	// by this builder (e.g. an account).
+	//
+	EncodeInvoke(from interface{}, contract interface{}, function string, args []interface{}, info InteractionInfo) ([]byte, error)
 
 	EncodeInteraction(itype string, expr BenchmarkExpression, info InteractionInfo) ([]byte, error)
 }
 
+// A blockchain builder can also implement this interface to sample the state
+// of the blockchain while the benchmark runs.
+//
+type BlockchainSampler interface {
+	// Start sampling the blockchain in the background.
+	// This is called by the Diablo primary right before it tells the
+	// secondaries to start at `start`, which is the time the interaction
+	// results are relative to.
+	//
+	StartSampling(start time.Time) error
+
+	// Stop sampling the blockchain and return what has been sampled.
+	// The returned value is encoded in JSON in the benchmark results.
+	//
+	StopSampling() (interface{}, error)
+}
+
 type BlockchainClient interface {
 	DecodePayload(bytes []byte) (interface{}, error)
 
@@ -93,6 +138,7 @@ func (this *accountFactory) Instance(expr BenchmarkExpression) (Sample, error) {
 	var elements []interface{}
 	var i, number, istake int
 	var stake IntVariable
+	var stakes []int
 	var err error
 	var ok bool
 
@@ -106,17 +152,30 @@ func (this *accountFactory) Instance(expr BenchmarkExpression) (Sample, error) {
 		number = 1
 	}
 
-	stake, err = expr.Field("stake").Int()
+	_, err = expr.Field("stake").TryField("distribution")
+	if err == nil {
+		stakes, err = parseStakeDistribution(expr.Field("stake"),
+			number)
+	} else {
+		stake, err = expr.Field("stake").Int()
+	}
+
 	if err != nil {
 		return nil, err
 	}
 
 	elements = make([]interface{}, number)
 	for i = range elements {
-		istake, ok = stake.TryGetInt()
+		if stakes != nil {
+			istake, ok = stakes[i], true
+		} else {
+			istake, ok = stake.TryGetInt()
+		}
+
 		if !ok {
-			return nil, fmt.Errorf("%s: variable exhausted",
-				expr.Field("stake").FullPosition())
+			return nil, fmt.Errorf("%s: %w",
+				expr.Field("stake").FullPosition(),
+				errVariableExhausted)
 		}
 
 		elements[i], err = this.builder.CreateAccount(istake)
@@ -168,8 +227,9 @@ func (this *contractFactory) Instance(expr BenchmarkExpression) (Sample, error)
 	for i = range elements {
 		iname, ok = name.TryGetString()
 		if !ok {
-			return nil, fmt.Errorf("%s: variable exhausted",
-				expr.Field("name").FullPosition())
+			return nil, fmt.Errorf("%s: %w",
+				expr.Field("name").FullPosition(),
+				errVariableExhausted)
 		}
 
 		elements[i], err = this.builder.CreateContract(iname)
@@ -235,8 +295,12 @@ func newInvokeInteractionFactory(builder BlockchainBuilder) *invokeInteractionFa
 
 func (this *invokeInteractionFactory) Instance(expr BenchmarkExpression, info InteractionInfo) ([]byte, error) {
 	var from, contract interface{}
+	var elements []BenchmarkExpression
+	var field BenchmarkExpression
+	var args []interface{}
 	var function string
 	var err error
+	var i int
 
 	from, err = expr.Field("from").GetResource("account")
 	if err != nil {
@@ -253,7 +317,78 @@ func (this *invokeInteractionFactory) Instance(expr BenchmarkExpression, info In
 		return nil, err
 	}
 
-	return this.builder.EncodeInvoke(from, contract, function, info)
+	args = make([]interface{}, 0)
+
+	field, err = expr.TryField("args")
+	if err == nil {
+		elements, err = field.TrySlice()
+		if err != nil {
+			return nil, fmt.Errorf("%s: must be a list of arguments",
+				field.FullPosition())
+		}
+
+		args = make([]interface{}, len(elements))
+		for i = range elements {
+			args[i], err = getInvokeArgument(elements[i])
+			if err != nil {
+				return nil, err
+			}
+		}
+	}
+
+	return this.builder.EncodeInvoke(from, contract, function, args, info)
+}
+
+// Return the value of an argument of an invoke interaction.
+// A variable gives a value of its own domain while an immediate value is an
+// int or a string depending on how it is written.
+// Floats are rejected since no blockchain encodes them in contract calls.
+//
+func getInvokeArgument(expr BenchmarkExpression) (interface{}, error) {
+	var name, domain string
+	var value interface{}
+	var err error
+	var ok bool
+
+	name, err = expr.target()
+	if err == nil {
+		_, domain, ok = expr.current().get(name)
+		if !ok {
+			return nil, fmt.Errorf("%s: unknown variable '%s'",
+				expr.FullPosition(), name)
+		}
+
+		switch domain {
+		case "integer":
+			return expr.GetInt()
+		case "float":
+			return nil, fmt.Errorf("%s: float arguments are not " +
+				"supported", expr.FullPosition())
+		case "string":
+			return expr.GetString()
+		default:
+			return expr.GetResource(domain)
+		}
+	}
+
+	value, err = expr.GetInt()
+	if (err == nil) || errors.Is(err, errVariableExhausted) {
+		return value, err
+	}
+
+	_, err = expr.GetFloat()
+	if err == nil {
+		return nil, fmt.Errorf("%s: float arguments are not " +
+			"supported", expr.FullPosition())
+	}
+
+	value, err = expr.GetString()
+	if err == nil {
+		return value, nil
+	}
+
+	return nil, fmt.Errorf("%s: must be an int, a string or a variable",
+		expr.FullPosition())
 }
 
 
@@ -269,6 +404,20 @@ func newProxyInteractionFactory(builder BlockchainBuilder, itype string) *proxyI
 	}
 }
 
+// Errors of the blockchain which do not tell where they occur are prefixed
+// with the position of the interaction.
+//
 func (this *proxyInteractionFactory) Instance(expr BenchmarkExpression, info InteractionInfo) ([]byte, error) {
-	return this.builder.EncodeInteraction(this.itype, expr, info)
+	var encoded []byte
+	var err error
+
+	encoded, err = this.builder.EncodeInteraction(this.itype, expr, info)
+
+	if (err != nil) &&
+		!strings.HasPrefix(err.Error(), expr.Source() + ":") {
+		return nil, fmt.Errorf("%s: %s", expr.FullPosition(),
+			err.Error())
+	}
+
+	return encoded, err
 }
@@ -3,8 +3,10 @@ package core
 
 import (
 	"fmt"
-	"regexp"
+	"math"
 	"math/rand"
+	"regexp"
+	"sort"
 )
 
 
@@ -196,12 +198,36 @@ func parseFilteredElementSample(expr BenchmarkExpression, elements []taggedEleme
 				field.FullPosition(), err.Error())
 		}
 
+		if expr.system().checking && !matchesAnyTag(filter, elements) {
+			err = expr.system().report(fmt.Errorf("%s: regexp " +
+				"'%s' matches no tag", field.FullPosition(),
+				pattern))
+			if err != nil {
+				return nil, err
+			}
+		}
+
 		filters = append(filters, filter)
 	}
 
 	return newFilteredElementSample(filters, elements), nil
 }
 
+func matchesAnyTag(filter *regexp.Regexp, elements []taggedElement) bool {
+	var telement taggedElement
+	var tag string
+
+	for _, telement = range elements {
+		for _, tag = range telement.tags() {
+			if filter.MatchString(tag) {
+				return true
+			}
+		}
+	}
+
+	return false
+}
+
 func newFilteredElementSample(filters []*regexp.Regexp, telements []taggedElement) Sample {
 	var faileds []bool = make([]bool, len(telements))
 	var elements []interface{}
@@ -359,6 +385,186 @@ func (this *uniformRandomFactory) instance(BenchmarkExpression) (Random, error)
 }
 
 
+// A distribution selecting events with probabilities proportional to their
+// weight.
+// Regular variables select events with the cumulative weights.
+// Once and loop variables draw a weighted random permutation of the events
+// (each event gets the key -ln(u)/weight for a uniform u and events are
+// selected by increasing key) so weights keep their meaning as events are
+// discarded.
+//
+type weightedDistribution struct {
+	rtype    VariableType
+	rand     *rand.Rand
+	weights  []float64   // weight of every event in the sample space
+	cumul    []float64   // cumulative weights (regular only)
+	pool     []int       // the events which can be selected
+	order    []int       // events left to select (once and loop only)
+}
+
+func newWeightedDistribution(weights []float64, seed int64, rtype VariableType) *weightedDistribution {
+	var pool []int = make([]int, len(weights))
+	var i int
+
+	for i = range pool {
+		pool[i] = i
+	}
+
+	return newWeightedDistributionOver(weights, pool, seed, rtype)
+}
+
+func newWeightedDistributionOver(weights []float64, pool []int, seed int64, rtype VariableType) *weightedDistribution {
+	var this weightedDistribution
+	var total float64
+	var i int
+
+	this.rtype = rtype
+	this.rand = rand.New(rand.NewSource(seed))
+	this.weights = weights
+	this.pool = pool
+
+	if rtype == TypeRegular {
+		this.cumul = make([]float64, len(pool))
+		total = 0
+
+		for i = range pool {
+			total += weights[pool[i]]
+			this.cumul[i] = total
+		}
+	} else {
+		this.shuffle()
+	}
+
+	return &this
+}
+
+func (this *weightedDistribution) shuffle() {
+	var keys []float64 = make([]float64, len(this.pool))
+	var i int
+
+	this.order = make([]int, len(this.pool))
+
+	for i = range this.order {
+		this.order[i] = i
+
+		if this.weights[this.pool[i]] > 0 {
+			keys[i] = this.rand.ExpFloat64() /
+				this.weights[this.pool[i]]
+		} else {
+			keys[i] = math.Inf(1)
+		}
+	}
+
+	sort.SliceStable(this.order, func (a, b int) bool {
+		return keys[this.order[a]] < keys[this.order[b]]
+	})
+
+	for i = range this.order {
+		this.order[i] = this.pool[this.order[i]]
+	}
+}
+
+func (this *weightedDistribution) Select() (int, error) {
+	var index, value int
+	var target float64
+
+	if this.rtype == TypeRegular {
+		if (len(this.cumul) == 0) || (this.cumul[len(this.cumul)-1] <= 0) {
+			return -1, fmt.Errorf("random space exhausted")
+		}
+
+		target = this.rand.Float64() * this.cumul[len(this.cumul)-1]
+
+		index = sort.Search(len(this.cumul), func (i int) bool {
+			return this.cumul[i] > target
+		})
+
+		if index == len(this.cumul) {
+			index -= 1
+		}
+
+		return this.pool[index], nil
+	}
+
+	if len(this.order) == 0 {
+		if (this.rtype == TypeLoop) && (len(this.pool) > 0) {
+			this.shuffle()
+		} else {
+			return -1, fmt.Errorf("random space exhausted")
+		}
+	}
+
+	value = this.order[0]
+	this.order = this.order[1:]
+
+	return value, nil
+}
+
+func (this *weightedDistribution) Copy(seed int64, rtype VariableType) Distribution {
+	var pool []int
+
+	if this.rtype == TypeRegular {
+		pool = make([]int, len(this.pool))
+		copy(pool, this.pool)
+	} else {
+		pool = make([]int, len(this.order))
+		copy(pool, this.order)
+		sort.Ints(pool)
+	}
+
+	return newWeightedDistributionOver(this.weights, pool, seed, rtype)
+}
+
+
+// A random space giving a weight to each index of the sample space.
+//
+type weightedRandom struct {
+	weight  func(index, size int) float64
+}
+
+func newWeightedRandom(weight func(int, int) float64) *weightedRandom {
+	return &weightedRandom{
+		weight: weight,
+	}
+}
+
+func (this *weightedRandom) Instance(size int, seed int64, rtype VariableType) Distribution {
+	var weights []float64 = make([]float64, size)
+	var i int
+
+	for i = range weights {
+		weights[i] = this.weight(i, size)
+	}
+
+	return newWeightedDistribution(weights, seed, rtype)
+}
+
+
+// Parse the float parameter `name` of a random space or return `value` if
+// there is no such parameter.
+//
+func parseRandomParameter(expr BenchmarkExpression, name string, value float64) (float64, error) {
+	var field BenchmarkExpression
+	var err error
+
+	if expr == nil {
+		return value, nil
+	}
+
+	field, err = expr.TryField(name)
+	if err != nil {
+		return value, nil
+	}
+
+	return field.GetFloat()
+}
+
+
+// Normal distribution over the sample space.
+// The `mean` and `stddev` parameters are fractions of the sample space size,
+// so the default `!normal { mean: 0.5, stddev: 0.25 }` favors the elements in
+// the middle of the sample.
+//
 type normalRandomFactory struct {
 }
 
@@ -367,5 +573,144 @@ func newNormalRandomFactory() *normalRandomFactory {
 }
 
 func (this *normalRandomFactory) instance(expr BenchmarkExpression) (Random, error) {
-	return nil, fmt.Errorf("%s: not yet implemented", expr.FullPosition())
+	var mean, stddev float64
+	var err error
+
+	mean, err = parseRandomParameter(expr, "mean", 0.5)
+	if err != nil {
+		return nil, err
+	}
+
+	stddev, err = parseRandomParameter(expr, "stddev", 0.25)
+	if err != nil {
+		return nil, err
+	}
+
+	if stddev <= 0 {
+		return nil, fmt.Errorf("%s: stddev must be strictly positive",
+			expr.FullPosition())
+	}
+
+	return newWeightedRandom(func (index, size int) float64 {
+		var x float64 = (float64(index) + 0.5) / float64(size)
+
+		x = (x - mean) / stddev
+
+		return math.Exp(-0.5 * x * x)
+	}), nil
+}
+
+
+// Exponential distribution over the sample space.
+// The `mean` parameter is a fraction of the sample space size, so the default
+// `!exponential { mean: 0.1 }` favors the first elements of the sample.
+//
+type exponentialRandomFactory struct {
+}
+
+func newExponentialRandomFactory() *exponentialRandomFactory {
+	return &exponentialRandomFactory{}
+}
+
+func (this *exponentialRandomFactory) instance(expr BenchmarkExpression) (Random, error) {
+	var mean float64
+	var err error
+
+	mean, err = parseRandomParameter(expr, "mean", 0.1)
+	if err != nil {
+		return nil, err
+	}
+
+	if mean <= 0 {
+		return nil, fmt.Errorf("%s: mean must be strictly positive",
+			expr.FullPosition())
+	}
+
+	return newWeightedRandom(func (index, size int) float64 {
+		var x float64 = (float64(index) + 0.5) / float64(size)
+
+		return math.Exp(-x / mean)
+	}), nil
+}
+
+
+// Zipf distribution over the sample space.
+// The element of rank k (starting at 1) has a weight of 1/k^s where `s`
+// defaults to 1.
+//
+type zipfRandomFactory struct {
+}
+
+func newZipfRandomFactory() *zipfRandomFactory {
+	return &zipfRandomFactory{}
+}
+
+func (this *zipfRandomFactory) instance(expr BenchmarkExpression) (Random, error) {
+	var s float64
+	var err error
+
+	s, err = parseRandomParameter(expr, "s", 1)
+	if err != nil {
+		return nil, err
+	}
+
+	if s <= 0 {
+		return nil, fmt.Errorf("%s: s must be strictly positive",
+			expr.FullPosition())
+	}
+
+	return newWeightedRandom(func (index, size int) float64 {
+		return math.Pow(float64(index + 1), -s)
+	}), nil
+}
+
+
+// Hotspot distribution over the sample space.
+// The first `fraction` of the sample is selected with the given
+// `probability`, the rest of the sample is selected otherwise. Inside each
+// part, the selection is uniform. The default is
+// `!hotspot { fraction: 0.2, probability: 0.8 }`.
+//
+type hotspotRandomFactory struct {
+}
+
+func newHotspotRandomFactory() *hotspotRandomFactory {
+	return &hotspotRandomFactory{}
+}
+
+func (this *hotspotRandomFactory) instance(expr BenchmarkExpression) (Random, error) {
+	var fraction, probability float64
+	var err error
+
+	fraction, err = parseRandomParameter(expr, "fraction", 0.2)
+	if err != nil {
+		return nil, err
+	}
+
+	if (fraction < 0) || (fraction > 1) {
+		return nil, fmt.Errorf("%s: fraction must be between 0 and 1",
+			expr.FullPosition())
+	}
+
+	probability, err = parseRandomParameter(expr, "probability", 0.8)
+	if err != nil {
+		return nil, err
+	}
+
+	if (probability < 0) || (probability > 1) {
+		return nil, fmt.Errorf("%s: probability must be between 0 " +
+			"and 1", expr.FullPosition())
+	}
+
+	return newWeightedRandom(func (index, size int) float64 {
+		var hot int = int(math.Ceil(fraction * float64(size)))
+
+		if (hot == 0) || (hot == size) {
+			return 1
+		} else if index < hot {
+			return probability / float64(hot)
+		} else {
+			return (1 - probability) / float64(size - hot)
+		}
+	}), nil
 }
@@ -0,0 +1,156 @@
+package core
+
+
+import (
+	"testing"
+)
+
+
+// Draw `n` events from the given distribution and return how many times each
+// event has been drawn.
+//
+func drawTestCounts(t *testing.T, distrib Distribution, size, n int) []int {
+	var counts []int = make([]int, size)
+	var index, i int
+	var err error
+
+	for i = 0; i < n; i++ {
+		index, err = distrib.Select()
+		if err != nil {
+			t.Fatalf("select %d: %s", i, err.Error())
+		}
+
+		counts[index] += 1
+	}
+
+	return counts
+}
+
+func TestWeightedDeterministic(t *testing.T) {
+	var a, b Distribution
+	var x, y, i int
+
+	a = newWeightedDistribution([]float64{ 1, 2, 3, 4 }, 7, TypeRegular)
+	b = newWeightedDistribution([]float64{ 1, 2, 3, 4 }, 7, TypeRegular)
+
+	for i = 0; i < 100; i++ {
+		x, _ = a.Select()
+		y, _ = b.Select()
+
+		if x != y {
+			t.Fatalf("draw %d: %d != %d", i, x, y)
+		}
+	}
+}
+
+func TestWeightedOnce(t *testing.T) {
+	var distrib Distribution
+	var counts []int
+	var i int
+	var err error
+
+	distrib = newWeightedDistribution([]float64{ 1, 0, 100, 5, 1 }, 3,
+		TypeOnce)
+	counts = drawTestCounts(t, distrib, 5, 5)
+
+	for i = range counts {
+		if counts[i] != 1 {
+			t.Fatalf("once: got counts %v", counts)
+		}
+	}
+
+	_, err = distrib.Select()
+	if err == nil {
+		t.Fatalf("once: not exhausted after 5 draws")
+	}
+}
+
+func TestWeightedLoop(t *testing.T) {
+	var distrib Distribution
+	var counts []int
+	var i int
+
+	distrib = newWeightedDistribution([]float64{ 1, 10, 100 }, 3, TypeLoop)
+	counts = drawTestCounts(t, distrib, 3, 30)
+
+	for i = range counts {
+		if counts[i] != 10 {
+			t.Fatalf("loop: got counts %v", counts)
+		}
+	}
+}
+
+func TestWeightedCopy(t *testing.T) {
+	var distrib, dup Distribution
+	var first, index, i int
+	var counts []int
+
+	distrib = newWeightedDistribution([]float64{ 1, 1, 1, 1 }, 3, TypeOnce)
+	first, _ = distrib.Select()
+
+	dup = distrib.Copy(5, TypeRegular)
+	counts = make([]int, 4)
+
+	for i = 0; i < 100; i++ {
+		index, _ = dup.Select()
+		counts[index] += 1
+	}
+
+	if counts[first] != 0 {
+		t.Fatalf("copy: selected discarded event %d: %v", first,
+			counts)
+	}
+}
+
+func TestWeightedSkew(t *testing.T) {
+	var variable Variable
+	var src string
+	var hits, i int
+
+	for _, src = range []string{
+		`- &v { sample: !integer { from: 0, to: 99 }, random: !zipf }`,
+		`- &v { sample: !integer { from: 0, to: 99 }, random: ` +
+			`!exponential { mean: 0.05 } }`,
+		`- &v { sample: !integer { from: 0, to: 99 }, random: ` +
+			`!hotspot { fraction: 0.1, probability: 0.9 } }`,
+		`- &v { sample: !integer { from: 0, to: 99 }, random: ` +
+			`!normal { mean: 0.05, stddev: 0.05 } }`,
+	} {
+		variable = getTestVariable(t,
+			parseTestScope(t, newTestSystem(), src), "v")
+		hits = 0
+
+		for i = 0; i < 10000; i++ {
+			if variable.Get().(int) < 10 {
+				hits += 1
+			}
+		}
+
+		if hits < 5000 {
+			t.Errorf("%s: first decile drawn %d/10000 times", src,
+				hits)
+		}
+	}
+}
+
+func TestWeightedErrors(t *testing.T) {
+	var sys *system = newTestSystem()
+	var src string
+
+	for _, src = range []string{
+		`- &v { sample: !integer { from: 0, to: 9 }, random: ` +
+			`!normal { stddev: 0 } }`,
+		`- &v { sample: !integer { from: 0, to: 9 }, random: ` +
+			`!exponential { mean: -1 } }`,
+		`- &v { sample: !integer { from: 0, to: 9 }, random: ` +
+			`!zipf { s: 0 } }`,
+		`- &v { sample: !integer { from: 0, to: 9 }, random: ` +
+			`!hotspot { probability: 2 } }`,
+		`- &v { sample: !integer { from: 0, to: 9 }, random: ` +
+			`!normal { mean: "middle" } }`,
+	} {
+		if parseTestScopeError(sys, src) == nil {
+			t.Errorf("expected error for: %s", src)
+		}
+	}
+}
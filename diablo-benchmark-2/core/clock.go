@@ -0,0 +1,78 @@
+package core
+
+
+import (
+	"time"
+)
+
+
+const (
+	// How many pings the primary sends to each secondary to estimate its
+	// clock.
+	CLOCK_SYNC_ROUNDS int = 8
+
+	// How long after the last clock estimation the benchmark starts, in
+	// addition to the largest round trip time.
+	START_MARGIN time.Duration = 100 * time.Millisecond
+)
+
+
+// The clock of a secondary compared to the clock of the primary.
+// It is estimated like NTP does from a ping sent by the primary at `t0`,
+// received by the secondary at `t1`, answered at `t2` and received back by
+// the primary at `t3`, assuming both ways take as long:
+//
+//   offset    = ((t1 - t0) + (t2 - t3)) / 2
+//   roundTrip = (t3 - t0) - (t2 - t1)
+//
+// The true offset is within `roundTrip / 2` of the estimation.
+//
+type clockEstimate struct {
+	offset     time.Duration  // secondary clock minus primary clock
+	roundTrip  time.Duration
+}
+
+func newClockEstimate(t0, t1, t2, t3 int64) *clockEstimate {
+	var roundTrip int64 = (t3 - t0) - (t2 - t1)
+
+	if roundTrip < 0 {
+		roundTrip = 0
+	}
+
+	return &clockEstimate{
+		offset: time.Duration(((t1 - t0) + (t2 - t3)) / 2),
+		roundTrip: time.Duration(roundTrip),
+	}
+}
+
+func (this *clockEstimate) uncertainty() time.Duration {
+	return this.roundTrip / 2
+}
+
+// Return the given time of the primary clock as seen by the secondary clock.
+//
+func (this *clockEstimate) toSecondary(t time.Time) time.Time {
+	return t.Add(this.offset)
+}
+
+// Estimate the clock of a secondary with `rounds` pings and keep the one
+// with the shortest round trip since it is the least uncertain.
+//
+func estimateClock(conn *secondaryConn, rounds int) (*clockEstimate, error) {
+	var best, estimate *clockEstimate
+	var err error
+	var i int
+
+	for i = 0; i < rounds; i++ {
+		estimate, err = conn.ping()
+		if err != nil {
+			return nil, err
+		}
+
+		if (best == nil) || (estimate.roundTrip < best.roundTrip) {
+			best = estimate
+		}
+	}
+
+	return best, nil
+}
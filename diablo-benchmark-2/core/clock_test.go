@@ -0,0 +1,93 @@
+package core
+
+
+import (
+	"net"
+	"testing"
+	"time"
+)
+
+
+func TestClockEstimate(t *testing.T) {
+	var estimate *clockEstimate
+	var t0 time.Time
+
+	// The secondary clock is 500 ahead, each way takes 10 and the
+	// secondary answers in 5.
+	estimate = newClockEstimate(1000, 1510, 1515, 1025)
+
+	if (estimate.offset != 500) || (estimate.roundTrip != 20) ||
+		(estimate.uncertainty() != 10) {
+		t.Fatalf("got %v", estimate)
+	}
+
+	// The same with a way taking 2 and the other 18: the estimation is
+	// wrong but within its uncertainty.
+	estimate = newClockEstimate(1000, 1502, 1507, 1025)
+
+	if (estimate.roundTrip != 20) || (estimate.offset != 492) {
+		t.Fatalf("got %v", estimate)
+	}
+
+	t0 = time.Unix(0, 1000)
+	if !estimate.toSecondary(t0).Equal(time.Unix(0, 1492)) {
+		t.Fatalf("got %s", estimate.toSecondary(t0))
+	}
+}
+
+func TestClockSync(t *testing.T) {
+	var primarySide, secondarySide net.Conn
+	var estimate *clockEstimate
+	var conn *secondaryConn
+	var done chan *msgStart
+	var start time.Time
+	var msg *msgStart
+	var err error
+
+	primarySide, secondarySide = net.Pipe()
+	defer primarySide.Close()
+	defer secondarySide.Close()
+
+	done = make(chan *msgStart)
+	go func() {
+		var msg *msgStart
+		var err error
+
+		msg, err = newPrimaryConn(secondarySide).waitStart()
+		if err != nil {
+			t.Errorf("wait start: %s", err.Error())
+		}
+
+		done <- msg
+	}()
+
+	conn = newSecondaryConn(primarySide)
+
+	estimate, err = estimateClock(conn, CLOCK_SYNC_ROUNDS)
+	if err != nil {
+		t.Fatalf("estimate: %s", err.Error())
+	}
+
+	// Both sides use the same clock.
+	if (estimate.offset > estimate.uncertainty()) ||
+		(-estimate.offset > estimate.uncertainty()) {
+		t.Fatalf("offset %s beyond uncertainty %s", estimate.offset,
+			estimate.uncertainty())
+	}
+
+	start = time.Now().Add(START_MARGIN)
+
+	err = conn.sendStart(&msgStart{
+		duration: 1,
+		startTime: estimate.toSecondary(start).UnixNano(),
+	})
+	if err != nil {
+		t.Fatalf("start: %s", err.Error())
+	}
+
+	msg = <-done
+	if (msg == nil) || (msg.duration != 1) || (msg.startTime !=
+		start.Add(estimate.offset).UnixNano()) {
+		t.Fatalf("got start %v", msg)
+	}
+}
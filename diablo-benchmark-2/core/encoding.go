@@ -2,81 +2,231 @@ package core
 
 
 import (
+	"bytes"
 	"encoding/binary"
 	"fmt"
 	"io"
+	"math"
 )
 
 
-type msgPrimaryParameters struct {
-	sysname      string
-	chainParams  map[string]string
-	maxDelay     float64
-	maxSkew      float64
+// The version of the protocol spoken between the primary and the secondaries.
+// Increment it each time the encoding of a message changes so mismatched
+// binaries refuse to talk instead of misreading each other.
+//
+const protocolVersion = 7
+
+// The bytes every connection starts with, before the protocol version.
+//
+var protocolMagic []byte = []byte("diablo")
+
+// The largest length or count a decoder accepts.
+// A corrupted or hostile stream then fails with an error instead of making
+// the decoder allocate gigabytes.
+//
+const maxMessageLength = 1 << 24
+
+
+// Read a varint encoded unsigned integer that must fit in an `int`.
+//
+func readUvarint(src io.Reader) (int, error) {
+	var reader io.ByteReader
+	var value uint64
+	var err error
+	var ok bool
+
+	reader, ok = src.(io.ByteReader)
+	if !ok {
+		reader = &byteReader{ src: src }
+	}
+
+	value, err = binary.ReadUvarint(reader)
+	if err != nil {
+		return 0, err
+	}
+
+	if value > math.MaxInt32 {
+		return 0, fmt.Errorf("integer too large (%d)", value)
+	}
+
+	return int(value), nil
 }
 
-func decodeMsgPrimaryParameters(src io.Reader) (*msgPrimaryParameters, error) {
-	var buf []byte = make([]byte, 255)
-	var this msgPrimaryParameters
-	var key, value string
+func writeUvarint(dest io.Writer, value int) error {
+	var buf []byte = make([]byte, binary.MaxVarintLen64)
 	var err error
-	var i, n, k, v int
+	var n int
+
+	if value < 0 {
+		return fmt.Errorf("negative integer (%d)", value)
+	}
+
+	n = binary.PutUvarint(buf, uint64(value))
+	_, err = dest.Write(buf[:n])
 
-	_, err = io.ReadFull(src, buf[:1])
+	return err
+}
+
+// Read a varint encoded length or count.
+//
+func readLength(src io.Reader, what string) (int, error) {
+	var length int
+	var err error
+
+	length, err = readUvarint(src)
 	if err != nil {
-		return nil, err
+		return 0, err
+	}
+
+	if length > maxMessageLength {
+		return 0, fmt.Errorf("%s too large (%d)", what, length)
 	}
 
-	n = int(buf[0])
+	return length, nil
+}
+
+func writeLength(dest io.Writer, what string, length int) error {
+	if length > maxMessageLength {
+		return fmt.Errorf("%s too large (%d)", what, length)
+	}
 
-	_, err = io.ReadFull(src, buf[:n])
+	return writeUvarint(dest, length)
+}
+
+// Read a varint length followed by as many bytes.
+//
+func readBytes(src io.Reader, what string) ([]byte, error) {
+	var buf []byte
+	var err error
+	var n int
+
+	n, err = readLength(src, what)
 	if err != nil {
 		return nil, err
 	}
 
-	this.sysname = string(buf[:n])
+	buf = make([]byte, n)
 
-	_, err = io.ReadFull(src, buf[:1])
+	_, err = io.ReadFull(src, buf)
 	if err != nil {
 		return nil, err
 	}
 
-	n = int(buf[0])
+	return buf, nil
+}
 
-	this.chainParams = make(map[string]string, n)
+func writeBytes(dest io.Writer, what string, buf []byte) error {
+	var err error
 
-	for i = 0; i < n; i++ {
-		_, err = io.ReadFull(src, buf[:2])
-		if err != nil {
-			return nil, err
-		}
+	err = writeLength(dest, what, len(buf))
+	if err != nil {
+		return err
+	}
 
-		k = int(buf[0])
-		v = int(buf[1])
+	_, err = dest.Write(buf)
 
-		_, err = io.ReadFull(src, buf[:k])
-		if err != nil {
-			return nil, err
-		}
+	return err
+}
 
-		key = string(buf[:k])
+func readString(src io.Reader, what string) (string, error) {
+	var buf []byte
+	var err error
 
-		_, err = io.ReadFull(src, buf[:v])
-		if err != nil {
-			return nil, err
-		}
+	buf, err = readBytes(src, what)
+	if err != nil {
+		return "", err
+	}
 
-		value = string(buf[:v])
+	return string(buf), nil
+}
 
-		this.chainParams[key] = value
+func writeString(dest io.Writer, what string, str string) error {
+	var err error
+
+	err = writeLength(dest, what, len(str))
+	if err != nil {
+		return err
 	}
 
-	err = binary.Read(src, binary.LittleEndian, &this.maxDelay)
+	_, err = io.WriteString(dest, str)
+
+	return err
+}
+
+func readBool(src io.Reader) (bool, error) {
+	var buf []byte = make([]byte, 1)
+	var err error
+
+	_, err = io.ReadFull(src, buf)
+	if err != nil {
+		return false, err
+	}
+
+	switch buf[0] {
+	case 0:
+		return false, nil
+	case 1:
+		return true, nil
+	default:
+		return false, fmt.Errorf("invalid boolean %d", buf[0])
+	}
+}
+
+func writeBool(dest io.Writer, value bool) error {
+	var buf []byte = make([]byte, 1)
+	var err error
+
+	if value {
+		buf[0] = 1
+	} else {
+		buf[0] = 0
+	}
+
+	_, err = dest.Write(buf)
+
+	return err
+}
+
+type byteReader struct {
+	src  io.Reader
+	buf  [1]byte
+}
+
+func (this *byteReader) ReadByte() (byte, error) {
+	var err error
+
+	_, err = io.ReadFull(this.src, this.buf[:])
+	if err != nil {
+		return 0, err
+	}
+
+	return this.buf[0], nil
+}
+
+
+// The first message each side sends on a new connection.
+//
+type msgHello struct {
+	version  int
+}
+
+func decodeMsgHello(src io.Reader) (*msgHello, error) {
+	var buf []byte = make([]byte, len(protocolMagic))
+	var this msgHello
+	var err error
+
+	_, err = io.ReadFull(src, buf)
 	if err != nil {
 		return nil, err
 	}
 
-	err = binary.Read(src, binary.LittleEndian, &this.maxSkew)
+	if !bytes.Equal(buf, protocolMagic) {
+		return nil, fmt.Errorf("unexpected handshake: peer is not " +
+			"diablo or speaks a protocol older than version %d",
+			protocolVersion)
+	}
+
+	this.version, err = readUvarint(src)
 	if err != nil {
 		return nil, err
 	}
@@ -84,66 +234,103 @@ func decodeMsgPrimaryParameters(src io.Reader) (*msgPrimaryParameters, error) {
 	return &this, nil
 }
 
-func (this *msgPrimaryParameters) encode(dest io.Writer) error {
+func (this *msgHello) encode(dest io.Writer) error {
+	var err error
+
+	_, err = dest.Write(protocolMagic)
+	if err != nil {
+		return err
+	}
+
+	return writeUvarint(dest, this.version)
+}
+
+
+type msgPrimaryParameters struct {
+	sysname            string
+	chainParams        map[string]string
+	maxDelay           float64
+	maxSkew            float64
+	maxInflight        int  // per secondary, 0 for no limit
+	maxClientInflight  int  // per client, 0 for no limit
+}
+
+func decodeMsgPrimaryParameters(src io.Reader) (*msgPrimaryParameters, error) {
+	var this msgPrimaryParameters
 	var key, value string
-	var buf []byte
 	var err error
+	var i, n int
 
-	if len(this.sysname) > 255 {
-		return fmt.Errorf("interface name '%s' too long (%d bytes)",
-			this.sysname, len(this.sysname))
+	this.sysname, err = readString(src, "interface name")
+	if err != nil {
+		return nil, err
 	}
 
-	if len(this.chainParams) > 255 {
-		return fmt.Errorf("too many chain parameters (%d)",
-			len(this.chainParams))
+	n, err = readLength(src, "chain parameter count")
+	if err != nil {
+		return nil, err
 	}
 
-	for key, value = range this.chainParams {
-		if len(key) > 255 {
-			return fmt.Errorf("chain parameter name '%s' too " +
-				"long (%d bytes)", key, len(key))
+	this.chainParams = make(map[string]string)
+
+	for i = 0; i < n; i++ {
+		key, err = readString(src, "chain parameter name")
+		if err != nil {
+			return nil, err
 		}
 
-		if len(value) > 255 {
-			return fmt.Errorf("chain parameter value '%s' too " +
-				"long (%d bytes)", value, len(value))
+		value, err = readString(src, "chain parameter value")
+		if err != nil {
+			return nil, err
 		}
+
+		this.chainParams[key] = value
 	}
 
-	buf = make([]byte, 2)
+	err = binary.Read(src, binary.LittleEndian, &this.maxDelay)
+	if err != nil {
+		return nil, err
+	}
 
-	buf[0] = uint8(len(this.sysname))
-	_, err = dest.Write(buf[:1])
+	err = binary.Read(src, binary.LittleEndian, &this.maxSkew)
 	if err != nil {
-		return err
+		return nil, err
+	}
+
+	this.maxInflight, err = readUvarint(src)
+	if err != nil {
+		return nil, err
 	}
 
-	_, err = io.WriteString(dest, this.sysname)
+	this.maxClientInflight, err = readUvarint(src)
+	if err != nil {
+		return nil, err
+	}
+
+	return &this, nil
+}
+
+func (this *msgPrimaryParameters) encode(dest io.Writer) error {
+	var key, value string
+	var err error
+
+	err = writeString(dest, "interface name", this.sysname)
 	if err != nil {
 		return err
 	}
 
-	buf[0] = uint8(len(this.chainParams))
-	_, err = dest.Write(buf[:1])
+	err = writeLength(dest, "chain parameter count",len(this.chainParams))
 	if err != nil {
 		return err
 	}
 
 	for key, value = range this.chainParams {
-		buf[0] = uint8(len(key))
-		buf[1] = uint8(len(value))
-		_, err = dest.Write(buf)
-		if err != nil {
-			return err
-		}
-
-		_, err = io.WriteString(dest, key)
+		err = writeString(dest, "chain parameter name", key)
 		if err != nil {
 			return err
 		}
 
-		_, err = io.WriteString(dest, value)
+		err = writeString(dest, "chain parameter value", value)
 		if err != nil {
 			return err
 		}
@@ -159,84 +346,91 @@ func (this *msgPrimaryParameters) encode(dest io.Writer) error {
 		return err
 	}
 
-	return nil
+	err = writeUvarint(dest, this.maxInflight)
+	if err != nil {
+		return err
+	}
+
+	return writeUvarint(dest, this.maxClientInflight)
 }
 
 
 type msgSecondaryParameters struct {
-	tags  []string
+	tags   []string
+	token  string
 }
 
 func decodeMsgSecondaryParameters(src io.Reader) (*msgSecondaryParameters, error) {
-	var buf []byte = make([]byte, 255)
 	var this msgSecondaryParameters
+	var tag string
 	var err error
 	var i, n int
 
-	_, err = io.ReadFull(src, buf[:1])
+	n, err = readLength(src, "tag count")
 	if err != nil {
 		return nil, err
 	}
 
-	this.tags = make([]string, int(buf[0]))
+	this.tags = make([]string, 0)
 
-	for i = range this.tags {
-		_, err = io.ReadFull(src, buf[:1])
+	for i = 0; i < n; i++ {
+		tag, err = readString(src, "tag")
 		if err != nil {
 			return nil, err
 		}
 
-		n = int(buf[0])
-
-		_, err = io.ReadFull(src, buf[:n])
-		if err != nil {
-			return nil, err
-		}
+		this.tags = append(this.tags, tag)
+	}
 
-		this.tags[i] = string(buf[:n])
+	this.token, err = readString(src, "token")
+	if err != nil {
+		return nil, err
 	}
 
 	return &this, nil
 }
 
 func (this *msgSecondaryParameters) encode(dest io.Writer) error {
-	var buf []byte
 	var tag string
 	var err error
 
-	if len(this.tags) > 255 {
-		return fmt.Errorf("too many tags (%d)", len(this.tags))
-	}
-
-	for _, tag = range this.tags {
-		if len(tag) > 255 {
-			return fmt.Errorf("tag '%s' too long (%d bytes)", tag,
-				len(tag))
-		}
-	}
-
-	buf = make([]byte, 1)
-
-	buf[0] = uint8(len(this.tags))
-	_, err = dest.Write(buf)
+	err = writeLength(dest, "tag count", len(this.tags))
 	if err != nil {
 		return err
 	}
 
 	for _, tag = range this.tags {
-		buf[0] = uint8(len(tag))
-		_, err = dest.Write(buf)
+		err = writeString(dest, "tag", tag)
 		if err != nil {
 			return err
 		}
+	}
 
-		_, err = io.WriteString(dest, tag)
-		if err != nil {
-			return err
-		}
+	return writeString(dest, "token", this.token)
+}
+
+
+// The answer of the primary to the parameters of a secondary.
+// A secondary is accepted if there is no reason to reject it.
+//
+type msgAdmission struct {
+	reason  string
+}
+
+func decodeMsgAdmission(src io.Reader) (*msgAdmission, error) {
+	var this msgAdmission
+	var err error
+
+	this.reason, err = readString(src, "rejection reason")
+	if err != nil {
+		return nil, err
 	}
 
-	return nil
+	return &this, nil
+}
+
+func (this *msgAdmission) encode(dest io.Writer) error {
+	return writeString(dest, "rejection reason", this.reason)
 }
 
 
@@ -250,6 +444,8 @@ const (
 	MSG_PREPARE_TYPE_DONE         msgPrepareType = 0
 	MSG_PREPARE_TYPE_CLIENT       msgPrepareType = 1
 	MSG_PREPARE_TYPE_INTERACTION  msgPrepareType = 2
+	MSG_PREPARE_TYPE_LOOP         msgPrepareType = 3
+	MSG_PREPARE_TYPE_SEQUENCE     msgPrepareType = 4
 )
 
 func decodeMsgPrepare(src io.Reader) (msgPrepare, error) {
@@ -267,7 +463,11 @@ func decodeMsgPrepare(src io.Reader) (msgPrepare, error) {
 	case MSG_PREPARE_TYPE_CLIENT:
 		return decodeMsgPrepareClient(src)
 	case MSG_PREPARE_TYPE_INTERACTION:
-		return decodeMsgPrepareInteraction(src)
+		return decodeMsgPrepareInteraction(src, false)
+	case MSG_PREPARE_TYPE_SEQUENCE:
+		return decodeMsgPrepareInteraction(src, true)
+	case MSG_PREPARE_TYPE_LOOP:
+		return decodeMsgPrepareLoop(src)
 	default:
 		return nil, fmt.Errorf("unknown prepare message type %d",
 			mtype[0])
@@ -299,43 +499,32 @@ type msgPrepareClient struct {
 }
 
 func decodeMsgPrepareClient(src io.Reader) (msgPrepare, error) {
-	var buf []byte = make([]byte, 255)
 	var this msgPrepareClient
-	var nview uint16
-	var index uint32
+	var addr string
 	var err error
 	var i, n int
 
-	err = binary.Read(src, binary.LittleEndian, &nview)
+	n, err = readLength(src, "address count")
 	if err != nil {
 		return nil, err
 	}
 
-	this.view = make([]string, int(nview))
-
-	for i = range this.view {
-		_, err = io.ReadFull(src, buf[:1])
-		if err != nil {
-			return nil, err
-		}
-
-		n = int(buf[0])
+	this.view = make([]string, 0)
 
-		_, err = io.ReadFull(src, buf[:n])
+	for i = 0; i < n; i++ {
+		addr, err = readString(src, "address")
 		if err != nil {
 			return nil, err
 		}
 
-		this.view[i] = string(buf[:n])
+		this.view = append(this.view, addr)
 	}
 
-	err = binary.Read(src, binary.LittleEndian, &index)
+	this.index, err = readUvarint(src)
 	if err != nil {
 		return nil, err
 	}
 
-	this.index = int(index)
-
 	return &this, nil
 }
 
@@ -344,96 +533,68 @@ func (this *msgPrepareClient) encode(dest io.Writer) error {
 	var addr string
 	var err error
 
-	if len(this.view) > 65535 {
-		return fmt.Errorf("too many addresses (%d)", len(this.view))
-	}
-
-	for _, addr = range this.view {
-		if len(addr) > 255 {
-			return fmt.Errorf("address '%s' too long (%d bytes)",
-				addr, len(addr))
-		}
-	}
-
-	if this.index >= (1 << 32) {
-		return fmt.Errorf("client index too large (%d)", this.index)
-	}
-
-	buf = make([]byte, 1)
 	buf[0] = MSG_PREPARE_TYPE_CLIENT
 	_, err = dest.Write(buf)
 	if err != nil {
 		return err
 	}
 
-	err = binary.Write(dest, binary.LittleEndian, uint16(len(this.view)))
+	err = writeLength(dest, "address count", len(this.view))
 	if err != nil {
 		return err
 	}
 
 	for _, addr = range this.view {
-		buf[0] = uint8(len(addr))
-		_, err = dest.Write(buf)
+		err = writeString(dest, "address", addr)
 		if err != nil {
 			return err
 		}
-
-		_, err = io.WriteString(dest, addr)
-		if err != nil {
-			return err
-		}
-	}
-
-	err = binary.Write(dest, binary.LittleEndian, uint32(this.index))
-	if err != nil {
-		return err
 	}
 
-	return nil
+	return writeUvarint(dest, this.index)
 }
 
 
+// An interaction to trigger.
+// The payload of a sequence packs the payloads of its steps (see
+// encodeSequencePayload()).
+//
 type msgPrepareInteraction struct {
-	index    int
-	ikind    int
-	time     float64
-	payload  []byte
+	index     int
+	loop      int      // closed loop index, 0 if open loop
+	ikind     int
+	time      float64  // think time if in a closed loop
+	sequence  bool
+	payload   []byte
 }
 
-func decodeMsgPrepareInteraction(src io.Reader) (msgPrepare, error) {
-	var buf []byte = make([]byte, 1)
+func decodeMsgPrepareInteraction(src io.Reader, sequence bool) (msgPrepare, error) {
 	var this msgPrepareInteraction
-	var lpayload uint16
-	var index uint32
 	var err error
 
-	err = binary.Read(src, binary.LittleEndian, &index)
+	this.sequence = sequence
+
+	this.index, err = readUvarint(src)
 	if err != nil {
 		return nil, err
 	}
 
-	this.index = int(uint8(index))
-
-	_, err = io.ReadFull(src, buf)
+	this.loop, err = readUvarint(src)
 	if err != nil {
 		return nil, err
 	}
 
-	this.ikind = int(buf[0])
-
-	err = binary.Read(src, binary.LittleEndian, &this.time)
+	this.ikind, err = readUvarint(src)
 	if err != nil {
 		return nil, err
 	}
 
-	err = binary.Read(src, binary.LittleEndian, &lpayload)
+	err = binary.Read(src, binary.LittleEndian, &this.time)
 	if err != nil {
 		return nil, err
 	}
 
-	this.payload = make([]byte, int(lpayload))
-
-	_, err = io.ReadFull(src, this.payload)
+	this.payload, err = readBytes(src, "payload")
 	if err != nil {
 		return nil, err
 	}
@@ -445,14 +606,6 @@ func (this *msgPrepareInteraction) encode(dest io.Writer) error {
 	var buf []byte = make([]byte, 1)
 	var err error
 
-	if this.index >= (1 << 32) {
-		return fmt.Errorf("client index too large (%d)", this.index)
-	}
-
-	if this.ikind > 255 {
-		return fmt.Errorf("interaction kind too large (%d)",this.ikind)
-	}
-
 	// If you find yourself stuck by this limit then wait a moment before
 	// to change it.
 	// There is a single Diablo primary sending tons of these messages to
@@ -465,20 +618,27 @@ func (this *msgPrepareInteraction) encode(dest io.Writer) error {
 			len(this.payload))
 	}
 
-	buf = make([]byte, 1)
-	buf[0] = MSG_PREPARE_TYPE_INTERACTION
+	if this.sequence {
+		buf[0] = MSG_PREPARE_TYPE_SEQUENCE
+	} else {
+		buf[0] = MSG_PREPARE_TYPE_INTERACTION
+	}
 	_, err = dest.Write(buf)
 	if err != nil {
 		return err
 	}
 
-	err = binary.Write(dest, binary.LittleEndian, uint32(this.index))
+	err = writeUvarint(dest, this.index)
 	if err != nil {
 		return err
 	}
 
-	buf[0] = uint8(this.ikind)
-	_, err = dest.Write(buf)
+	err = writeUvarint(dest, this.loop)
+	if err != nil {
+		return err
+	}
+
+	err = writeUvarint(dest, this.ikind)
 	if err != nil {
 		return err
 	}
@@ -488,25 +648,198 @@ func (this *msgPrepareInteraction) encode(dest io.Writer) error {
 		return err
 	}
 
-	err = binary.Write(dest, binary.LittleEndian,uint16(len(this.payload)))
+	return writeBytes(dest, "payload", this.payload)
+}
+
+
+// Declare a closed loop on a client.
+// The interactions of the loop are sent afterward with the index of the loop.
+//
+type msgPrepareLoop struct {
+	index        int      // client index
+	loop         int      // loop index, starting at 1
+	outstanding  int
+	duration     float64
+}
+
+func decodeMsgPrepareLoop(src io.Reader) (msgPrepare, error) {
+	var this msgPrepareLoop
+	var err error
+
+	this.index, err = readUvarint(src)
+	if err != nil {
+		return nil, err
+	}
+
+	this.loop, err = readUvarint(src)
+	if err != nil {
+		return nil, err
+	}
+
+	this.outstanding, err = readUvarint(src)
+	if err != nil {
+		return nil, err
+	}
+
+	err = binary.Read(src, binary.LittleEndian, &this.duration)
+	if err != nil {
+		return nil, err
+	}
+
+	return &this, nil
+}
+
+func (this *msgPrepareLoop) encode(dest io.Writer) error {
+	var buf []byte = make([]byte, 1)
+	var err error
+
+	buf[0] = MSG_PREPARE_TYPE_LOOP
+	_, err = dest.Write(buf)
 	if err != nil {
 		return err
 	}
 
-	_, err = dest.Write(this.payload)
+	err = writeUvarint(dest, this.index)
 	if err != nil {
 		return err
 	}
 
-	return nil
+	err = writeUvarint(dest, this.loop)
+	if err != nil {
+		return err
+	}
+
+	err = writeUvarint(dest, this.outstanding)
+	if err != nil {
+		return err
+	}
+
+	return binary.Write(dest, binary.LittleEndian, this.duration)
+}
+
+
+type msgSyncType = uint8
+
+type msgSync interface {
+	encode(dest io.Writer) error
+}
+
+const (
+	MSG_SYNC_TYPE_PING   msgSyncType = 0
+	MSG_SYNC_TYPE_START  msgSyncType = 1
+)
+
+func decodeMsgSync(src io.Reader) (msgSync, error) {
+	var mtype []byte = make([]byte, 1)
+	var err error
+
+	_, err = io.ReadFull(src, mtype)
+	if err != nil {
+		return nil, err
+	}
+
+	switch (mtype[0]) {
+	case MSG_SYNC_TYPE_PING:
+		return decodeMsgPing(src)
+	case MSG_SYNC_TYPE_START:
+		return decodeMsgStart(src)
+	default:
+		return nil, fmt.Errorf("unknown sync message type %d",
+			mtype[0])
+	}
+}
+
+
+// A clock probe from the primary.
+// All times are Unix times in nanoseconds, each measured with the clock of
+// the node sending it.
+//
+type msgPing struct {
+	sendTime  int64  // primary clock
 }
 
+func decodeMsgPing(src io.Reader) (msgSync, error) {
+	var this msgPing
+	var err error
+
+	err = binary.Read(src, binary.LittleEndian, &this.sendTime)
+	if err != nil {
+		return nil, err
+	}
+
+	return &this, nil
+}
+
+func (this *msgPing) encode(dest io.Writer) error {
+	var buf []byte = make([]byte, 1)
+	var err error
+
+	buf[0] = MSG_SYNC_TYPE_PING
+	_, err = dest.Write(buf)
+	if err != nil {
+		return err
+	}
+
+	return binary.Write(dest, binary.LittleEndian, this.sendTime)
+}
+
+
+// The answer of a secondary to a `msgPing`.
+//
+type msgPong struct {
+	pingTime     int64  // primary clock, copied from the ping
+	receiveTime  int64  // secondary clock
+	sendTime     int64  // secondary clock
+}
+
+func decodeMsgPong(src io.Reader) (*msgPong, error) {
+	var this msgPong
+	var err error
+
+	err = binary.Read(src, binary.LittleEndian, &this.pingTime)
+	if err != nil {
+		return nil, err
+	}
+
+	err = binary.Read(src, binary.LittleEndian, &this.receiveTime)
+	if err != nil {
+		return nil, err
+	}
+
+	err = binary.Read(src, binary.LittleEndian, &this.sendTime)
+	if err != nil {
+		return nil, err
+	}
+
+	return &this, nil
+}
+
+func (this *msgPong) encode(dest io.Writer) error {
+	var err error
+
+	err = binary.Write(dest, binary.LittleEndian, this.pingTime)
+	if err != nil {
+		return err
+	}
+
+	err = binary.Write(dest, binary.LittleEndian, this.receiveTime)
+	if err != nil {
+		return err
+	}
 
+	return binary.Write(dest, binary.LittleEndian, this.sendTime)
+}
+
+
+// Start the benchmark at `startTime`, a Unix time in nanoseconds given with
+// the clock of the secondary receiving the message.
+//
 type msgStart struct {
-	duration  float64
+	duration   float64
+	startTime  int64
 }
 
-func decodeMsgStart(src io.Reader) (*msgStart, error) {
+func decodeMsgStart(src io.Reader) (msgSync, error) {
 	var this msgStart
 	var err error
 
@@ -515,11 +848,30 @@ func decodeMsgStart(src io.Reader) (*msgStart, error) {
 		return nil, err
 	}
 
+	err = binary.Read(src, binary.LittleEndian, &this.startTime)
+	if err != nil {
+		return nil, err
+	}
+
 	return &this, nil
 }
 
 func (this *msgStart) encode(dest io.Writer) error {
-	return binary.Write(dest, binary.LittleEndian, this.duration)
+	var buf []byte = make([]byte, 1)
+	var err error
+
+	buf[0] = MSG_SYNC_TYPE_START
+	_, err = dest.Write(buf)
+	if err != nil {
+		return err
+	}
+
+	err = binary.Write(dest, binary.LittleEndian, this.duration)
+	if err != nil {
+		return err
+	}
+
+	return binary.Write(dest, binary.LittleEndian, this.startTime)
 }
 
 
@@ -532,6 +884,8 @@ type msgResult interface {
 const (
 	MSG_RESULT_TYPE_DONE         msgResultType = 0
 	MSG_RESULT_TYPE_INTERACTION  msgResultType = 1
+	MSG_RESULT_TYPE_SEQUENCE     msgResultType = 2
+	MSG_RESULT_TYPE_LOOP         msgResultType = 3
 )
 
 func decodeMsgResult(src io.Reader) (msgResult, error) {
@@ -547,7 +901,11 @@ func decodeMsgResult(src io.Reader) (msgResult, error) {
 	case MSG_RESULT_TYPE_DONE:
 		return decodeMsgResultDone(src)
 	case MSG_RESULT_TYPE_INTERACTION:
-		return decodeMsgResultInteraction(src)
+		return decodeMsgResultInteraction(src, false)
+	case MSG_RESULT_TYPE_SEQUENCE:
+		return decodeMsgResultInteraction(src, true)
+	case MSG_RESULT_TYPE_LOOP:
+		return decodeMsgResultLoop(src)
 	default:
 		return nil, fmt.Errorf("unknown result message type %d",
 			mtype[0])
@@ -576,116 +934,241 @@ func (this *msgResultDone) encode(dest io.Writer) error {
 }
 
 
+// The result of an interaction.
+// The result of a sequence is followed by the result of each of its steps.
+//
 type msgResultInteraction struct {
-	index       int      // client index
-	ikind       int      // interaction kind index
-	submitTime  float64  // negative if not submitted
-	commitTime  float64  // negative if not committed
-	abortTime   float64  // negative if not aborted
+	index        int      // client index
+	ikind        int      // interaction kind index
+	schedTime    float64
+	dequeueTime  float64  // negative if not dequeued
+	submitTime   float64  // negative if not submitted
+	commitTime   float64  // negative if not committed
+	abortTime    float64  // negative if not aborted
+	hasError     bool
+	steps        []*msgResultStep  // nil if not a sequence
+}
+
+type msgResultStep struct {
+	submitTime  float64
+	commitTime  float64
+	abortTime   float64
 	hasError    bool
 }
 
-func decodeMsgResultInteraction(src io.Reader) (msgResult, error) {
-	var buf []byte = make([]byte, 1)
+func decodeMsgResultInteraction(src io.Reader, sequence bool) (msgResult, error) {
 	var this msgResultInteraction
-	var index uint32
+	var step *msgResultStep
 	var err error
+	var i, n int
 
-	err = binary.Read(src, binary.LittleEndian, &index)
+	this.index, err = readUvarint(src)
 	if err != nil {
 		return nil, err
 	}
 
-	this.index = int(index)
-
-	_, err = io.ReadFull(src, buf)
+	this.ikind, err = readUvarint(src)
 	if err != nil {
 		return nil, err
 	}
 
-	this.ikind = int(uint8(buf[0]))
-
-	err = binary.Read(src, binary.LittleEndian, &this.submitTime)
+	err = binary.Read(src, binary.LittleEndian, &this.schedTime)
 	if err != nil {
 		return nil, err
 	}
 
-	err = binary.Read(src, binary.LittleEndian, &this.commitTime)
+	err = binary.Read(src, binary.LittleEndian, &this.dequeueTime)
 	if err != nil {
 		return nil, err
 	}
 
-	err = binary.Read(src, binary.LittleEndian, &this.abortTime)
+	err = decodeResultTimes(src, &this.submitTime, &this.commitTime,
+		&this.abortTime, &this.hasError)
 	if err != nil {
 		return nil, err
 	}
 
-	_, err = io.ReadFull(src, buf)
+	if !sequence {
+		return &this, nil
+	}
+
+	n, err = readLength(src, "step count")
 	if err != nil {
 		return nil, err
 	}
 
-	this.hasError = (buf[0] == 1)
+	this.steps = make([]*msgResultStep, 0)
+
+	for i = 0; i < n; i++ {
+		step = &msgResultStep{}
+
+		err = decodeResultTimes(src, &step.submitTime,
+			&step.commitTime, &step.abortTime, &step.hasError)
+		if err != nil {
+			return nil, err
+		}
+
+		this.steps = append(this.steps, step)
+	}
 
 	return &this, nil
 }
 
-func (this *msgResultInteraction) encode(dest io.Writer) error {
-	var buf []byte
+func decodeResultTimes(src io.Reader, submitTime, commitTime, abortTime *float64, hasError *bool) error {
 	var err error
 
-	if this.index >= (1 << 32) {
-		return fmt.Errorf("client index too large (%d)", this.index)
+	err = binary.Read(src, binary.LittleEndian, submitTime)
+	if err != nil {
+		return err
+	}
+
+	err = binary.Read(src, binary.LittleEndian, commitTime)
+	if err != nil {
+		return err
 	}
 
-	if this.ikind > 255 {
-		return fmt.Errorf("interaction kind too large (%d)",this.ikind)
+	err = binary.Read(src, binary.LittleEndian, abortTime)
+	if err != nil {
+		return err
 	}
 
-	buf = make([]byte, 1)
+	*hasError, err = readBool(src)
 
-	buf[0] = MSG_RESULT_TYPE_INTERACTION
-	_, err = dest.Write(buf)
+	return err
+}
+
+func encodeResultTimes(dest io.Writer, submitTime, commitTime, abortTime float64, hasError bool) error {
+	var err error
+
+	err = binary.Write(dest, binary.LittleEndian, submitTime)
 	if err != nil {
 		return err
 	}
 
-	err = binary.Write(dest, binary.LittleEndian, uint32(this.index))
+	err = binary.Write(dest, binary.LittleEndian, commitTime)
 	if err != nil {
 		return err
 	}
 
-	buf[0] = uint8(this.ikind)
+	err = binary.Write(dest, binary.LittleEndian, abortTime)
+	if err != nil {
+		return err
+	}
+
+	return writeBool(dest, hasError)
+}
+
+func (this *msgResultInteraction) encode(dest io.Writer) error {
+	var buf []byte = make([]byte, 1)
+	var step *msgResultStep
+	var err error
+
+	if this.steps != nil {
+		buf[0] = MSG_RESULT_TYPE_SEQUENCE
+	} else {
+		buf[0] = MSG_RESULT_TYPE_INTERACTION
+	}
 	_, err = dest.Write(buf)
 	if err != nil {
 		return err
 	}
 
-	err = binary.Write(dest, binary.LittleEndian, this.submitTime)
+	err = writeUvarint(dest, this.index)
 	if err != nil {
 		return err
 	}
 
-	err = binary.Write(dest, binary.LittleEndian, this.commitTime)
+	err = writeUvarint(dest, this.ikind)
 	if err != nil {
 		return err
 	}
 
-	err = binary.Write(dest, binary.LittleEndian, this.abortTime)
+	err = binary.Write(dest, binary.LittleEndian, this.schedTime)
 	if err != nil {
 		return err
 	}
 
-	if this.hasError {
-		buf[0] = 1
-	} else {
-		buf[0] = 0
+	err = binary.Write(dest, binary.LittleEndian, this.dequeueTime)
+	if err != nil {
+		return err
 	}
 
-	_, err = dest.Write(buf)
+	err = encodeResultTimes(dest, this.submitTime, this.commitTime,
+		this.abortTime, this.hasError)
+	if err != nil {
+		return err
+	}
+
+	if this.steps == nil {
+		return nil
+	}
+
+	err = writeLength(dest, "step count", len(this.steps))
 	if err != nil {
 		return err
 	}
 
+	for _, step = range this.steps {
+		err = encodeResultTimes(dest, step.submitTime, step.commitTime,
+			step.abortTime, step.hasError)
+		if err != nil {
+			return err
+		}
+	}
+
 	return nil
 }
+
+
+// A closed loop which ran out of interactions before its end.
+//
+type msgResultLoop struct {
+	index        int      // client index
+	loop         int
+	exhaustTime  float64
+}
+
+func decodeMsgResultLoop(src io.Reader) (msgResult, error) {
+	var this msgResultLoop
+	var err error
+
+	this.index, err = readUvarint(src)
+	if err != nil {
+		return nil, err
+	}
+
+	this.loop, err = readUvarint(src)
+	if err != nil {
+		return nil, err
+	}
+
+	err = binary.Read(src, binary.LittleEndian, &this.exhaustTime)
+	if err != nil {
+		return nil, err
+	}
+
+	return &this, nil
+}
+
+func (this *msgResultLoop) encode(dest io.Writer) error {
+	var buf []byte = make([]byte, 1)
+	var err error
+
+	buf[0] = MSG_RESULT_TYPE_LOOP
+	_, err = dest.Write(buf)
+	if err != nil {
+		return err
+	}
+
+	err = writeUvarint(dest, this.index)
+	if err != nil {
+		return err
+	}
+
+	err = writeUvarint(dest, this.loop)
+	if err != nil {
+		return err
+	}
+
+	return binary.Write(dest, binary.LittleEndian, this.exhaustTime)
+}
@@ -0,0 +1,497 @@
+package core
+
+
+import (
+	"bytes"
+	"io"
+	"net"
+	"strings"
+	"testing"
+)
+
+
+type testMessage interface {
+	encode(dest io.Writer) error
+}
+
+type testDecoder = func(io.Reader) (testMessage, error)
+
+
+func encodeTestMessages(t testing.TB, msgs ...testMessage) []byte {
+	var buf bytes.Buffer
+	var msg testMessage
+	var err error
+
+	for _, msg = range msgs {
+		err = msg.encode(&buf)
+		if err != nil {
+			t.Fatalf("encode: %s", err.Error())
+		}
+	}
+
+	return buf.Bytes()
+}
+
+func testPrimaryParameters() *msgPrimaryParameters {
+	return &msgPrimaryParameters{
+		sysname: "ethereum",
+		chainParams: map[string]string{
+			"path": strings.Repeat("/dir", 100),
+			"json": "{" + strings.Repeat(`"k": 1, `, 5000) + "}",
+			"": "",
+		},
+		maxDelay: 1.5,
+		maxSkew: 2.5,
+	}
+}
+
+func testPrepareMessages() []testMessage {
+	return []testMessage{
+		&msgPrepareClient{
+			view: []string{ strings.Repeat("a", 300), "b" },
+			index: 70000,
+		},
+		&msgPrepareLoop{ index: 1, loop: 2, outstanding: 3, duration: 4 },
+		&msgPrepareInteraction{
+			index: 70000, loop: 0, ikind: 300, time: 0.5,
+			payload: bytes.Repeat([]byte("x"), 1000),
+		},
+		&msgPrepareInteraction{
+			index: 1, ikind: 2, sequence: true, payload: []byte{},
+		},
+		&msgPrepareDone{},
+	}
+}
+
+func testResultMessages() []testMessage {
+	return []testMessage{
+		&msgResultInteraction{
+			index: 70000, ikind: 300, submitTime: 1,
+			commitTime: 2, abortTime: -1, hasError: true,
+		},
+		&msgResultInteraction{
+			index: 1, ikind: 0, submitTime: 1, commitTime: -1,
+			abortTime: 3, steps: []*msgResultStep{
+				&msgResultStep{ 1, 2, -1, false },
+				&msgResultStep{ 2, -1, 3, true },
+			},
+		},
+		&msgResultLoop{ index: 70000, loop: 2, exhaustTime: 12.5 },
+		&msgResultDone{},
+	}
+}
+
+func TestEncodePrimaryParametersLong(t *testing.T) {
+	var expected *msgPrimaryParameters = testPrimaryParameters()
+	var params *msgPrimaryParameters
+	var key, value string
+	var err error
+
+	params, err = decodeMsgPrimaryParameters(bytes.NewReader(
+		encodeTestMessages(t, expected)))
+	if err != nil {
+		t.Fatalf("decode: %s", err.Error())
+	}
+
+	if (params.sysname != expected.sysname) ||
+		(len(params.chainParams) != len(expected.chainParams)) ||
+		(params.maxDelay != expected.maxDelay) ||
+		(params.maxSkew != expected.maxSkew) {
+		t.Fatalf("decode: got %v", params)
+	}
+
+	for key, value = range expected.chainParams {
+		if params.chainParams[key] != value {
+			t.Fatalf("decode: parameter '%s' has %d bytes, " +
+				"expected %d", key, len(params.chainParams[key]),
+				len(value))
+		}
+	}
+}
+
+func TestEncodeAdmission(t *testing.T) {
+	var admission *msgAdmission
+	var reason string
+	var err error
+
+	for _, reason = range []string{ "", "invalid token" } {
+		admission, err = decodeMsgAdmission(bytes.NewReader(
+			encodeTestMessages(t, &msgAdmission{ reason: reason })))
+		if (err != nil) || (admission.reason != reason) {
+			t.Fatalf("decode '%s': got %v, %v", reason, admission,
+				err)
+		}
+	}
+}
+
+func TestEncodePrepareLarge(t *testing.T) {
+	var client *msgPrepareClient
+	var iact *msgPrepareInteraction
+	var src *bytes.Reader
+	var msg msgPrepare
+	var err error
+	var ok bool
+
+	src = bytes.NewReader(encodeTestMessages(t, testPrepareMessages()...))
+
+	msg, err = decodeMsgPrepare(src)
+	if err != nil {
+		t.Fatalf("decode: %s", err.Error())
+	}
+
+	client, ok = msg.(*msgPrepareClient)
+	if !ok || (client.index != 70000) || (len(client.view) != 2) ||
+		(len(client.view[0]) != 300) {
+		t.Fatalf("decode: got %v", msg)
+	}
+
+	_, err = decodeMsgPrepare(src)
+	if err != nil {
+		t.Fatalf("decode: %s", err.Error())
+	}
+
+	msg, err = decodeMsgPrepare(src)
+	if err != nil {
+		t.Fatalf("decode: %s", err.Error())
+	}
+
+	iact, ok = msg.(*msgPrepareInteraction)
+	if !ok || (iact.index != 70000) || (iact.ikind != 300) ||
+		(len(iact.payload) != 1000) || iact.sequence {
+		t.Fatalf("decode: got %v", msg)
+	}
+}
+
+func TestDecodeTruncated(t *testing.T) {
+	var decoders []testDecoder = []testDecoder{
+		testDecodeHello, testDecodePrimaryParameters,
+		testDecodeSecondaryParameters, testDecodePrepare,
+		testDecodeSync, testDecodePong, testDecodeResult,
+		testDecodeAdmission, testDecodeAdmission,
+	}
+	var inputs [][]byte = [][]byte{
+		encodeTestMessages(t, &msgHello{ version: protocolVersion }),
+		encodeTestMessages(t, testPrimaryParameters()),
+		encodeTestMessages(t, &msgSecondaryParameters{
+			tags: []string{ "eu", strings.Repeat("t", 400) },
+		}),
+		encodeTestMessages(t, testPrepareMessages()[2]),
+		encodeTestMessages(t, &msgStart{ duration: 60, startTime: 2 }),
+		encodeTestMessages(t, &msgPong{ 1, 2, 3 }),
+		encodeTestMessages(t, testResultMessages()[1]),
+		encodeTestMessages(t, &msgAdmission{}),
+		encodeTestMessages(t, &msgAdmission{ reason: "invalid token" }),
+	}
+	var err error
+	var i, n int
+
+	for i = range decoders {
+		for n = 0; n < len(inputs[i]); n++ {
+			_, err = decoders[i](bytes.NewReader(inputs[i][:n]))
+			if err == nil {
+				t.Fatalf("decoder %d accepted %d of %d bytes",
+					i, n, len(inputs[i]))
+			}
+		}
+
+		_, err = decoders[i](bytes.NewReader(inputs[i]))
+		if err != nil {
+			t.Fatalf("decoder %d: %s", i, err.Error())
+		}
+	}
+}
+
+func TestDecodeHostileLength(t *testing.T) {
+	var err error
+
+	// A string announcing 2^31 - 1 bytes.
+	_, err = decodeMsgSecondaryParameters(bytes.NewReader([]byte{
+		1, 0xff, 0xff, 0xff, 0xff, 0x07,
+	}))
+	if err == nil {
+		t.Fatalf("decode: hostile length accepted")
+	}
+
+	// A rejection reason announcing 2^31 - 1 bytes.
+	_, err = decodeMsgAdmission(bytes.NewReader([]byte{
+		0xff, 0xff, 0xff, 0xff, 0x07,
+	}))
+	if err == nil {
+		t.Fatalf("decode: hostile admission length accepted")
+	}
+
+	// An index that does not fit on 64 bits.
+	_, err = decodeMsgPrepare(bytes.NewReader([]byte{
+		MSG_PREPARE_TYPE_LOOP, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff,
+		0xff, 0xff, 0xff, 0xff, 0x01,
+	}))
+	if err == nil {
+		t.Fatalf("decode: overflowing index accepted")
+	}
+}
+
+func runTestHandshake(t *testing.T, primaryVersion int, secondaryVersion int) (error, error) {
+	var primarySide, secondarySide net.Conn
+	var primaryErr, secondaryErr error
+	var done chan struct{}
+	var pconn *primaryConn
+	var sconn *secondaryConn
+
+	primarySide, secondarySide = net.Pipe()
+	done = make(chan struct{})
+	sconn = newSecondaryConn(primarySide)
+	pconn = newPrimaryConn(secondarySide)
+
+	go func() {
+		var hello *msgHello
+
+		defer close(done)
+		defer secondarySide.Close()
+
+		if secondaryVersion == protocolVersion {
+			_, secondaryErr = pconn.init(&msgSecondaryParameters{
+				tags: []string{ "eu" },
+			})
+			return
+		}
+
+		// Mimic a secondary built with another version.
+		hello, secondaryErr = decodeMsgHello(pconn.reader)
+		if secondaryErr != nil {
+			return
+		}
+
+		(&msgHello{ version: secondaryVersion }).encode(pconn.writer)
+		pconn.writer.Flush()
+
+		if hello.version != protocolVersion {
+			t.Errorf("primary sent version %d", hello.version)
+		}
+	}()
+
+	if primaryVersion == protocolVersion {
+		_, primaryErr = sconn.init()
+		if primaryErr == nil {
+			primaryErr = sconn.admit("")
+		}
+		if primaryErr == nil {
+			primaryErr = sconn.sendParameters(
+				testPrimaryParameters())
+		}
+	} else {
+		// Mimic a primary built with another version.
+		(&msgHello{ version: primaryVersion }).encode(sconn.writer)
+		sconn.writer.Flush()
+		_, primaryErr = decodeMsgHello(sconn.reader)
+	}
+
+	primarySide.Close()
+	<-done
+
+	return primaryErr, secondaryErr
+}
+
+func TestHandshake(t *testing.T) {
+	var primaryErr, secondaryErr error
+
+	primaryErr, secondaryErr = runTestHandshake(t, protocolVersion,
+		protocolVersion)
+	if (primaryErr != nil) || (secondaryErr != nil) {
+		t.Fatalf("handshake: %v, %v", primaryErr, secondaryErr)
+	}
+
+	primaryErr, _ = runTestHandshake(t, protocolVersion,
+		protocolVersion + 1)
+	if (primaryErr == nil) ||
+		!strings.Contains(primaryErr.Error(), "protocol version") {
+		t.Fatalf("primary: got %v", primaryErr)
+	}
+
+	_, secondaryErr = runTestHandshake(t, protocolVersion + 1,
+		protocolVersion)
+	if (secondaryErr == nil) ||
+		!strings.Contains(secondaryErr.Error(), "protocol version") {
+		t.Fatalf("secondary: got %v", secondaryErr)
+	}
+}
+
+func TestHandshakeLegacy(t *testing.T) {
+	var err error
+
+	// What a primary speaking the original protocol sends first.
+	_, err = decodeMsgHello(bytes.NewReader([]byte("\x08ethereum\x00")))
+	if (err == nil) || !strings.Contains(err.Error(), "handshake") {
+		t.Fatalf("decode: got %v", err)
+	}
+}
+
+
+func testDecodeHello(src io.Reader) (testMessage, error) {
+	return decodeMsgHello(src)
+}
+
+func testDecodePrimaryParameters(src io.Reader) (testMessage, error) {
+	return decodeMsgPrimaryParameters(src)
+}
+
+func testDecodeSecondaryParameters(src io.Reader) (testMessage, error) {
+	return decodeMsgSecondaryParameters(src)
+}
+
+func testDecodePrepare(src io.Reader) (testMessage, error) {
+	return decodeMsgPrepare(src)
+}
+
+func testDecodeSync(src io.Reader) (testMessage, error) {
+	return decodeMsgSync(src)
+}
+
+func testDecodePong(src io.Reader) (testMessage, error) {
+	return decodeMsgPong(src)
+}
+
+func testDecodeResult(src io.Reader) (testMessage, error) {
+	return decodeMsgResult(src)
+}
+
+func testDecodeAdmission(src io.Reader) (testMessage, error) {
+	return decodeMsgAdmission(src)
+}
+
+// Decode `data` and check that whatever decodes also encodes and decodes
+// again.
+//
+func fuzzDecoder(t *testing.T, decode testDecoder, data []byte) {
+	var msg testMessage
+	var buf bytes.Buffer
+	var err error
+
+	msg, err = decode(bytes.NewReader(data))
+	if err != nil {
+		return
+	}
+
+	err = msg.encode(&buf)
+	if err != nil {
+		return
+	}
+
+	_, err = decode(&buf)
+	if err != nil {
+		t.Fatalf("cannot decode re-encoded message: %s", err.Error())
+	}
+}
+
+func addFuzzSeeds(f *testing.F, data ...[]byte) {
+	var seed []byte
+
+	f.Add([]byte{})
+	for _, seed = range data {
+		f.Add(seed)
+	}
+}
+
+func FuzzDecodeHello(f *testing.F) {
+	addFuzzSeeds(f, encodeTestMessages(f,
+		&msgHello{ version: protocolVersion }))
+	f.Fuzz(func (t *testing.T, data []byte) {
+		fuzzDecoder(t, testDecodeHello, data)
+	})
+}
+
+func FuzzDecodePrimaryParameters(f *testing.F) {
+	addFuzzSeeds(f, encodeTestMessages(f, testPrimaryParameters()),
+		encodeTestMessages(f, &msgPrimaryParameters{}))
+	f.Fuzz(func (t *testing.T, data []byte) {
+		fuzzDecoder(t, testDecodePrimaryParameters, data)
+	})
+}
+
+func FuzzDecodeSecondaryParameters(f *testing.F) {
+	addFuzzSeeds(f, encodeTestMessages(f, &msgSecondaryParameters{
+		tags: []string{ "eu", "us" },
+	}))
+	f.Fuzz(func (t *testing.T, data []byte) {
+		fuzzDecoder(t, testDecodeSecondaryParameters, data)
+	})
+}
+
+func FuzzDecodePrepare(f *testing.F) {
+	var msg testMessage
+
+	for _, msg = range testPrepareMessages() {
+		addFuzzSeeds(f, encodeTestMessages(f, msg))
+	}
+
+	f.Fuzz(func (t *testing.T, data []byte) {
+		fuzzDecoder(t, testDecodePrepare, data)
+	})
+}
+
+func FuzzDecodeSync(f *testing.F) {
+	addFuzzSeeds(f, encodeTestMessages(f, &msgPing{ sendTime: 1 }),
+		encodeTestMessages(f, &msgStart{ duration: 60, startTime: 2 }))
+	f.Fuzz(func (t *testing.T, data []byte) {
+		fuzzDecoder(t, testDecodeSync, data)
+	})
+}
+
+func FuzzDecodePong(f *testing.F) {
+	addFuzzSeeds(f, encodeTestMessages(f, &msgPong{ 1, 2, 3 }))
+	f.Fuzz(func (t *testing.T, data []byte) {
+		fuzzDecoder(t, testDecodePong, data)
+	})
+}
+
+func FuzzDecodeAdmission(f *testing.F) {
+	addFuzzSeeds(f, encodeTestMessages(f, &msgAdmission{}),
+		encodeTestMessages(f, &msgAdmission{ reason: "invalid token" }))
+	f.Fuzz(func (t *testing.T, data []byte) {
+		fuzzDecoder(t, testDecodeAdmission, data)
+	})
+}
+
+func FuzzDecodeResult(f *testing.F) {
+	var msg testMessage
+
+	for _, msg = range testResultMessages() {
+		addFuzzSeeds(f, encodeTestMessages(f, msg))
+	}
+
+	f.Fuzz(func (t *testing.T, data []byte) {
+		fuzzDecoder(t, testDecodeResult, data)
+	})
+}
+
+func FuzzDecodeSequencePayload(f *testing.F) {
+	var seed []byte
+	var err error
+
+	seed, err = encodeSequencePayload([][]byte{ []byte("a"), []byte{} })
+	if err != nil {
+		f.Fatalf("encode: %s", err.Error())
+	}
+
+	addFuzzSeeds(f, seed)
+	f.Fuzz(func (t *testing.T, data []byte) {
+		var payloads [][]byte
+		var err error
+
+		payloads, err = decodeSequencePayload(data)
+		if err != nil {
+			return
+		}
+
+		data, err = encodeSequencePayload(payloads)
+		if err != nil {
+			t.Fatalf("cannot encode decoded payloads: %s",
+				err.Error())
+		}
+
+		_, err = decodeSequencePayload(data)
+		if err != nil {
+			t.Fatalf("cannot decode re-encoded payloads: %s",
+				err.Error())
+		}
+	})
+}
@@ -0,0 +1,651 @@
+package core
+
+
+import (
+	"fmt"
+	"gopkg.in/yaml.v3"
+	"math"
+	"strconv"
+)
+
+
+// An arithmetic expression in a benchmark file:
+//
+//   stake: !expr "supply / accounts"
+//   rate: !expr "base * (index + 1)"
+//
+// An expression is made of integer and float numbers, the operators `+`, `-`,
+// `*`, `/` and `%`, parentheses and the functions `min`, `max`, `floor`,
+// `ceil` and `round`.
+// An identifier is either a variable of the current scope with an `integer`
+// or `float` domain or a parameter given with `--define`.
+// The operators on integers give integers except `/` which always gives a
+// float. The `floor`, `ceil` and `round` functions give integers.
+//
+// The expression is parsed with the benchmark file but it is evaluated each
+// time its value is read so that variables are drawn for each interaction.
+//
+type benchmarkYamlExpr struct {
+	benchmarkYamlNode
+	root  exprNode
+}
+
+func parseBenchmarkYamlExpr(context benchmarkContext, node *yaml.Node) (BenchmarkExpression, error) {
+	var this benchmarkYamlExpr
+	var parser exprParser
+	var err error
+
+	this.init(context, node)
+
+	parser.init(&this, node.Value)
+
+	this.root, err = parser.parse()
+	if err != nil {
+		return nil, err
+	}
+
+	return &this, nil
+}
+
+// Return the position of the character at the given offset of the
+// expression.
+// The YAML node starts at its tag which is assumed to be followed by a single
+// space as in `!expr "a + b"`.
+//
+func (this *benchmarkYamlExpr) positionAt(offset int) string {
+	var column int = this.node.Column + offset
+
+	if (this.node.Style & yaml.TaggedStyle) != 0 {
+		column += len(this.node.Tag) + 1
+	}
+
+	if (this.node.Style & yaml.DoubleQuotedStyle) != 0 {
+		column += 1
+	} else if (this.node.Style & yaml.SingleQuotedStyle) != 0 {
+		column += 1
+	}
+
+	return fmt.Sprintf("%s:%d:%d", this.Source(), this.node.Line, column)
+}
+
+func (this *benchmarkYamlExpr) Finish() error {
+	return nil
+}
+
+func (this *benchmarkYamlExpr) Int() (IntVariable, error) {
+	var err error
+	var val int
+
+	val, err = this.GetInt()
+	if err != nil {
+		return nil, err
+	}
+
+	return newIntImmediate(val), nil
+}
+
+func (this *benchmarkYamlExpr) GetInt() (int, error) {
+	var value exprValue
+	var err error
+
+	value, err = this.root.eval(this)
+	if err != nil {
+		return 0, err
+	}
+
+	if value.integer {
+		return value.i, nil
+	}
+
+	if (value.f == math.Trunc(value.f)) && !math.IsInf(value.f, 0) {
+		return int(value.f), nil
+	}
+
+	return 0, fmt.Errorf("%s: must be an int (%f)", this.FullPosition(),
+		value.f)
+}
+
+func (this *benchmarkYamlExpr) Float() (FloatVariable, error) {
+	var value float64
+	var err error
+
+	value, err = this.GetFloat()
+	if err != nil {
+		return nil, err
+	}
+
+	return newFloatImmediate(value), nil
+}
+
+func (this *benchmarkYamlExpr) GetFloat() (float64, error) {
+	var value exprValue
+	var err error
+
+	value, err = this.root.eval(this)
+	if err != nil {
+		return 0, err
+	}
+
+	return value.float(), nil
+}
+
+// Return the value of the given identifier.
+// Variables of the current scope shadow the parameters.
+//
+func (this *benchmarkYamlExpr) lookup(name string, offset int) (exprValue, error) {
+	var variable Variable
+	var opaque interface{}
+	var domain, define string
+	var f float64
+	var err error
+	var ok bool
+	var i int64
+
+	variable, domain, ok = this.current().get(name)
+	if ok {
+		if (domain != "integer") && (domain != "float") {
+			return exprValue{}, fmt.Errorf("%s: cannot use " +
+				"'%s' variable '%s' in expression",
+				this.positionAt(offset), domain, name)
+		}
+
+		opaque = variable.Get()
+		if opaque == nil {
+			return exprValue{}, fmt.Errorf("%s: %w ('%s')",
+				this.positionAt(offset), errVariableExhausted,
+				name)
+		}
+
+		switch opaque.(type) {
+		case int:
+			return exprValue{ integer: true, i: opaque.(int) }, nil
+		case float64:
+			return exprValue{ f: opaque.(float64) }, nil
+		}
+
+		return exprValue{}, fmt.Errorf("%s: variable '%s' is not " +
+			"a number", this.positionAt(offset), name)
+	}
+
+	define, ok = this.system().defines[name]
+	if !ok {
+		return exprValue{}, fmt.Errorf("%s: unknown variable or " +
+			"parameter '%s'", this.positionAt(offset), name)
+	}
+
+	i, err = strconv.ParseInt(define, 10, 0)
+	if err == nil {
+		return exprValue{ integer: true, i: int(i) }, nil
+	}
+
+	f, err = strconv.ParseFloat(define, 64)
+	if err == nil {
+		return exprValue{ f: f }, nil
+	}
+
+	return exprValue{}, fmt.Errorf("%s: parameter '%s' is not a " +
+		"number ('%s')", this.positionAt(offset), name, define)
+}
+
+
+// The value of an expression: an int if `integer` is true or a float
+// otherwise.
+//
+type exprValue struct {
+	integer  bool
+	i        int
+	f        float64
+}
+
+func (this exprValue) float() float64 {
+	if this.integer {
+		return float64(this.i)
+	} else {
+		return this.f
+	}
+}
+
+
+type exprNode interface {
+	eval(expr *benchmarkYamlExpr) (exprValue, error)
+}
+
+
+type exprNumber struct {
+	value  exprValue
+}
+
+func (this *exprNumber) eval(*benchmarkYamlExpr) (exprValue, error) {
+	return this.value, nil
+}
+
+
+type exprIdentifier struct {
+	offset  int
+	name    string
+}
+
+func (this *exprIdentifier) eval(expr *benchmarkYamlExpr) (exprValue, error) {
+	return expr.lookup(this.name, this.offset)
+}
+
+
+type exprNegate struct {
+	operand  exprNode
+}
+
+func (this *exprNegate) eval(expr *benchmarkYamlExpr) (exprValue, error) {
+	var value exprValue
+	var err error
+
+	value, err = this.operand.eval(expr)
+	if err != nil {
+		return exprValue{}, err
+	}
+
+	value.i = -value.i
+	value.f = -value.f
+
+	return value, nil
+}
+
+
+type exprBinary struct {
+	offset    int
+	operator  byte
+	left      exprNode
+	right     exprNode
+}
+
+func (this *exprBinary) eval(expr *benchmarkYamlExpr) (exprValue, error) {
+	var left, right exprValue
+	var err error
+
+	left, err = this.left.eval(expr)
+	if err != nil {
+		return exprValue{}, err
+	}
+
+	right, err = this.right.eval(expr)
+	if err != nil {
+		return exprValue{}, err
+	}
+
+	switch this.operator {
+	case '/':
+		if right.float() == 0 {
+			return exprValue{}, fmt.Errorf("%s: division by zero",
+				expr.positionAt(this.offset))
+		}
+
+		return exprValue{ f: left.float() / right.float() }, nil
+	case '%':
+		if !left.integer || !right.integer {
+			return exprValue{}, fmt.Errorf("%s: operands of '%%' " +
+				"must be ints", expr.positionAt(this.offset))
+		}
+
+		if right.i == 0 {
+			return exprValue{}, fmt.Errorf("%s: division by zero",
+				expr.positionAt(this.offset))
+		}
+
+		return exprValue{ integer: true, i: left.i % right.i }, nil
+	}
+
+	if left.integer && right.integer {
+		switch this.operator {
+		case '+':
+			return exprValue{ integer: true, i: left.i + right.i }, nil
+		case '-':
+			return exprValue{ integer: true, i: left.i - right.i }, nil
+		default:
+			return exprValue{ integer: true, i: left.i * right.i }, nil
+		}
+	}
+
+	switch this.operator {
+	case '+':
+		return exprValue{ f: left.float() + right.float() }, nil
+	case '-':
+		return exprValue{ f: left.float() - right.float() }, nil
+	default:
+		return exprValue{ f: left.float() * right.float() }, nil
+	}
+}
+
+
+type exprCall struct {
+	offset     int
+	name       string
+	arguments  []exprNode
+}
+
+func (this *exprCall) eval(expr *benchmarkYamlExpr) (exprValue, error) {
+	var values []exprValue
+	var value exprValue
+	var argument exprNode
+	var err error
+	var i int
+
+	values = make([]exprValue, len(this.arguments))
+
+	for i, argument = range this.arguments {
+		values[i], err = argument.eval(expr)
+		if err != nil {
+			return exprValue{}, err
+		}
+	}
+
+	switch this.name {
+	case "min", "max":
+		value = values[0]
+
+		for i = 1; i < len(values); i++ {
+			if (this.name == "min") == (values[i].float() <
+				value.float()) {
+				value = values[i]
+			}
+		}
+
+		return value, nil
+	case "floor":
+		return exprValue{
+			integer: true,
+			i: int(math.Floor(values[0].float())),
+		}, nil
+	case "ceil":
+		return exprValue{
+			integer: true,
+			i: int(math.Ceil(values[0].float())),
+		}, nil
+	default:
+		return exprValue{
+			integer: true,
+			i: int(math.Round(values[0].float())),
+		}, nil
+	}
+}
+
+
+// A recursive descent parser for expressions:
+//
+//   sum     := product (('+' | '-') product)*
+//   product := unary (('*' | '/' | '%') unary)*
+//   unary   := '-' unary | primary
+//   primary := number | identifier | identifier '(' sum (',' sum)* ')'
+//            | '(' sum ')'
+//
+type exprParser struct {
+	expr    *benchmarkYamlExpr
+	text    string
+	offset  int
+}
+
+func (this *exprParser) init(expr *benchmarkYamlExpr, text string) {
+	this.expr = expr
+	this.text = text
+	this.offset = 0
+}
+
+func (this *exprParser) parse() (exprNode, error) {
+	var node exprNode
+	var err error
+
+	node, err = this.parseSum()
+	if err != nil {
+		return nil, err
+	}
+
+	if this.peek() != 0 {
+		return nil, this.errorf("unexpected '%c'", this.peek())
+	}
+
+	return node, nil
+}
+
+func (this *exprParser) errorf(format string, args ...interface{}) error {
+	return fmt.Errorf("%s: %s", this.expr.positionAt(this.offset),
+		fmt.Sprintf(format, args...))
+}
+
+// Skip the spaces and return the next character or 0 at the end of the
+// expression.
+//
+func (this *exprParser) peek() byte {
+	for this.offset < len(this.text) {
+		if (this.text[this.offset] != ' ') &&
+			(this.text[this.offset] != '\t') {
+			return this.text[this.offset]
+		}
+
+		this.offset += 1
+	}
+
+	return 0
+}
+
+func (this *exprParser) parseSum() (exprNode, error) {
+	var left, right exprNode
+	var operator byte
+	var offset int
+	var err error
+
+	left, err = this.parseProduct()
+	if err != nil {
+		return nil, err
+	}
+
+	for {
+		operator = this.peek()
+		if (operator != '+') && (operator != '-') {
+			return left, nil
+		}
+
+		offset = this.offset
+		this.offset += 1
+
+		right, err = this.parseProduct()
+		if err != nil {
+			return nil, err
+		}
+
+		left = &exprBinary{ offset, operator, left, right }
+	}
+}
+
+func (this *exprParser) parseProduct() (exprNode, error) {
+	var left, right exprNode
+	var operator byte
+	var offset int
+	var err error
+
+	left, err = this.parseUnary()
+	if err != nil {
+		return nil, err
+	}
+
+	for {
+		operator = this.peek()
+		if (operator != '*') && (operator != '/') && (operator != '%') {
+			return left, nil
+		}
+
+		offset = this.offset
+		this.offset += 1
+
+		right, err = this.parseUnary()
+		if err != nil {
+			return nil, err
+		}
+
+		left = &exprBinary{ offset, operator, left, right }
+	}
+}
+
+func (this *exprParser) parseUnary() (exprNode, error) {
+	var operand exprNode
+	var err error
+
+	if this.peek() != '-' {
+		return this.parsePrimary()
+	}
+
+	this.offset += 1
+
+	operand, err = this.parseUnary()
+	if err != nil {
+		return nil, err
+	}
+
+	return &exprNegate{ operand }, nil
+}
+
+func (this *exprParser) parsePrimary() (exprNode, error) {
+	var node exprNode
+	var c byte
+	var err error
+
+	c = this.peek()
+
+	if c == 0 {
+		return nil, this.errorf("unexpected end of expression")
+	}
+
+	if c == '(' {
+		this.offset += 1
+
+		node, err = this.parseSum()
+		if err != nil {
+			return nil, err
+		}
+
+		if this.peek() != ')' {
+			return nil, this.errorf("missing ')'")
+		}
+
+		this.offset += 1
+
+		return node, nil
+	}
+
+	if ((c >= '0') && (c <= '9')) || (c == '.') {
+		return this.parseNumber()
+	}
+
+	if isExprIdentifierStart(c) {
+		return this.parseIdentifier()
+	}
+
+	return nil, this.errorf("unexpected '%c'", c)
+}
+
+func (this *exprParser) parseNumber() (exprNode, error) {
+	var start int = this.offset
+	var text string
+	var f float64
+	var err error
+	var i int64
+	var c byte
+
+	for this.offset < len(this.text) {
+		c = this.text[this.offset]
+
+		if ((c < '0') || (c > '9')) && (c != '.') && (c != 'e') &&
+			(c != 'E') && (c != '_') {
+			break
+		}
+
+		if ((c == 'e') || (c == 'E')) &&
+			((this.offset + 1) < len(this.text)) &&
+			((this.text[this.offset + 1] == '-') ||
+			(this.text[this.offset + 1] == '+')) {
+			this.offset += 1
+		}
+
+		this.offset += 1
+	}
+
+	text = this.text[start:this.offset]
+
+	i, err = strconv.ParseInt(text, 0, 0)
+	if err == nil {
+		return &exprNumber{ exprValue{ integer: true, i: int(i) } }, nil
+	}
+
+	f, err = strconv.ParseFloat(text, 64)
+	if err == nil {
+		return &exprNumber{ exprValue{ f: f } }, nil
+	}
+
+	this.offset = start
+
+	return nil, this.errorf("invalid number '%s'", text)
+}
+
+func (this *exprParser) parseIdentifier() (exprNode, error) {
+	var arguments []exprNode
+	var start int = this.offset
+	var argument exprNode
+	var name string
+	var err error
+
+	for this.offset < len(this.text) {
+		if !isExprIdentifierStart(this.text[this.offset]) &&
+			((this.text[this.offset] < '0') ||
+			(this.text[this.offset] > '9')) {
+			break
+		}
+
+		this.offset += 1
+	}
+
+	name = this.text[start:this.offset]
+
+	if this.peek() != '(' {
+		return &exprIdentifier{ start, name }, nil
+	}
+
+	this.offset += 1
+
+	arguments = make([]exprNode, 0)
+
+	for {
+		argument, err = this.parseSum()
+		if err != nil {
+			return nil, err
+		}
+
+		arguments = append(arguments, argument)
+
+		if this.peek() == ')' {
+			this.offset += 1
+			break
+		} else if this.peek() != ',' {
+			return nil, this.errorf("missing ')'")
+		}
+
+		this.offset += 1
+	}
+
+	switch name {
+	case "min", "max":
+		break
+	case "floor", "ceil", "round":
+		if len(arguments) != 1 {
+			this.offset = start
+			return nil, this.errorf("'%s' takes one argument",
+				name)
+		}
+	default:
+		this.offset = start
+		return nil, this.errorf("unknown function '%s'", name)
+	}
+
+	return &exprCall{ start, name, arguments }, nil
+}
+
+func isExprIdentifierStart(c byte) bool {
+	return ((c >= 'a') && (c <= 'z')) || ((c >= 'A') && (c <= 'Z')) ||
+		(c == '_')
+}
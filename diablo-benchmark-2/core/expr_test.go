@@ -0,0 +1,128 @@
+package core
+
+
+import (
+	"strings"
+	"testing"
+)
+
+
+func parseTestExpr(t *testing.T, sys *system, src string) BenchmarkExpression {
+	var expr BenchmarkExpression
+	var err error
+
+	expr, err = parseTestExpression(sys, src)
+	if err != nil {
+		t.Fatalf("parse: %s", err.Error())
+	}
+
+	return expr
+}
+
+func TestExprArithmetic(t *testing.T) {
+	var expr BenchmarkExpression
+	var f float64
+	var err error
+	var i int
+
+	expr = parseTestExpr(t, newTestSystem(), `!expr "1 + 2 * (3 - -1) % 5"`)
+	i, err = expr.GetInt()
+	if (err != nil) || (i != 4) {
+		t.Fatalf("got %d (%v), expected 4", i, err)
+	}
+
+	expr = parseTestExpr(t, newTestSystem(), `!expr "7 / 2"`)
+	f, err = expr.GetFloat()
+	if (err != nil) || (f != 3.5) {
+		t.Fatalf("got %f (%v), expected 3.5", f, err)
+	}
+
+	_, err = expr.GetInt()
+	if err == nil {
+		t.Fatalf("non integral division read as int")
+	}
+
+	expr = parseTestExpr(t, newTestSystem(), `!expr "8 / 2"`)
+	i, err = expr.GetInt()
+	if (err != nil) || (i != 4) {
+		t.Fatalf("got %d (%v), expected 4", i, err)
+	}
+
+	expr = parseTestExpr(t, newTestSystem(),
+		`!expr "max(floor(2.7), ceil(1.2), round(0.4)) + min(1.5, 3)"`)
+	f, err = expr.GetFloat()
+	if (err != nil) || (f != 3.5) {
+		t.Fatalf("got %f (%v), expected 3.5", f, err)
+	}
+}
+
+func TestExprIdentifiers(t *testing.T) {
+	var sys *system = newTestSystem()
+	var expr BenchmarkExpression
+	var s scope
+	var err error
+	var i int
+
+	sys.defines["supply"] = "1000"
+	sys.defines["accounts"] = "8"
+
+	expr = parseTestExpr(t, sys, `!expr "supply / accounts"`)
+	i, err = expr.GetInt()
+	if (err != nil) || (i != 125) {
+		t.Fatalf("got %d (%v), expected 125", i, err)
+	}
+
+	s = parseTestScope(t, sys, `
+- &index { sample: !integer { from: 3, to: 3 } }
+- &accounts { sample: !integer { from: 10, to: 10 } }
+`)
+
+	expr = parseTestExpr(t, sys, `!expr "supply / accounts + index"`)
+	expr.specialize(s)
+
+	i, err = expr.GetInt()
+	if (err != nil) || (i != 103) {
+		t.Fatalf("got %d (%v), expected 103", i, err)
+	}
+}
+
+func TestExprErrors(t *testing.T) {
+	var sys *system = newTestSystem()
+	var expr BenchmarkExpression
+	var err error
+
+	sys.defines["chain"] = "ethereum"
+
+	_, err = parseTestExpression(sys, `!expr "1 + * 2"`)
+	if (err == nil) || !strings.HasPrefix(err.Error(), "test:1:12:") {
+		t.Fatalf("wrong syntax error: %v", err)
+	}
+
+	_, err = parseTestExpression(sys, `!expr "(1 + 2"`)
+	if (err == nil) || !strings.Contains(err.Error(), "missing ')'") {
+		t.Fatalf("wrong syntax error: %v", err)
+	}
+
+	_, err = parseTestExpression(sys, `!expr "sqrt(2)"`)
+	if (err == nil) || !strings.Contains(err.Error(), "unknown function") {
+		t.Fatalf("wrong syntax error: %v", err)
+	}
+
+	expr = parseTestExpr(t, sys, `!expr "2 * rate"`)
+	_, err = expr.GetInt()
+	if (err == nil) || !strings.HasPrefix(err.Error(), "test:1:12:") {
+		t.Fatalf("wrong unknown identifier error: %v", err)
+	}
+
+	expr = parseTestExpr(t, sys, `!expr "chain + 1"`)
+	_, err = expr.GetInt()
+	if (err == nil) || !strings.Contains(err.Error(), "not a number") {
+		t.Fatalf("wrong parameter error: %v", err)
+	}
+
+	expr = parseTestExpr(t, sys, `!expr "1 % 0"`)
+	_, err = expr.GetInt()
+	if (err == nil) || !strings.Contains(err.Error(), "division by zero") {
+		t.Fatalf("wrong division error: %v", err)
+	}
+}
@@ -0,0 +1,395 @@
+package core
+
+
+import (
+	"fmt"
+	"math"
+	"sort"
+)
+
+
+// A time interval during which the rate of a load follows a continuous
+// function.
+// The work done during an interval is the integral of the rate over this
+// interval. A load generator triggers an interaction each time a given
+// amount of work is done.
+//
+type loadSegment interface {
+	// Return the time interval covered by the segment.
+	//
+	span() (float64, float64)
+
+	// Return the work done between `from` and `to`, both within the
+	// segment.
+	//
+	work(from, to float64) float64
+
+	// Return the time at which `amount` work is done starting from
+	// `from` or false if this happens after the end of the segment.
+	//
+	reach(from, amount float64) (float64, bool)
+}
+
+
+// A segment with a rate changing linearly from `rate` at `start` to
+// `rate + slope * (end - start)` at `end`.
+// A constant rate is a linear segment with a slope of 0.
+//
+type linearSegment struct {
+	start  float64
+	end    float64
+	rate   float64
+	slope  float64
+}
+
+func newLinearSegment(start, end, from, to float64) *linearSegment {
+	var slope float64 = 0
+
+	if end > start {
+		slope = (to - from) / (end - start)
+	}
+
+	return &linearSegment{
+		start: start,
+		end: end,
+		rate: from,
+		slope: slope,
+	}
+}
+
+func (this *linearSegment) span() (float64, float64) {
+	return this.start, this.end
+}
+
+func (this *linearSegment) rateAt(time float64) float64 {
+	return this.rate + this.slope * (time - this.start)
+}
+
+func (this *linearSegment) work(from, to float64) float64 {
+	return (this.rateAt(from) + this.rateAt(to)) * (to - from) / 2
+}
+
+func (this *linearSegment) reach(from, amount float64) (float64, bool) {
+	var rate, disc, delta float64
+
+	rate = this.rateAt(from)
+
+	// Solve `slope/2 * delta^2 + rate * delta = amount` with the form
+	// which stays accurate for a slope close to 0.
+	//
+	disc = rate * rate + 2 * this.slope * amount
+	if disc < 0 {
+		return 0, false
+	}
+
+	delta = rate + math.Sqrt(disc)
+	if delta <= 0 {
+		return 0, false
+	}
+
+	delta = 2 * amount / delta
+
+	if (from + delta) > this.end {
+		return 0, false
+	}
+
+	return from + delta, true
+}
+
+
+// A segment with a rate of `base + amplitude * sin(2 pi (t - start) /
+// period)`.
+//
+type sineSegment struct {
+	start      float64
+	end        float64
+	base       float64
+	amplitude  float64
+	period     float64
+}
+
+func newSineSegment(start, end, base, amplitude, period float64) *sineSegment {
+	return &sineSegment{
+		start: start,
+		end: end,
+		base: base,
+		amplitude: amplitude,
+		period: period,
+	}
+}
+
+func (this *sineSegment) span() (float64, float64) {
+	return this.start, this.end
+}
+
+// Return the work done between `start` and `time`.
+//
+func (this *sineSegment) primitive(time float64) float64 {
+	var omega float64 = 2 * math.Pi / this.period
+
+	return this.base * (time - this.start) + this.amplitude / omega *
+		(1 - math.Cos(omega * (time - this.start)))
+}
+
+func (this *sineSegment) work(from, to float64) float64 {
+	return this.primitive(to) - this.primitive(from)
+}
+
+// The work is not invertible in closed form so bisect on the time.
+// The rate is never negative so the work is monotonic.
+//
+func (this *sineSegment) reach(from, amount float64) (float64, bool) {
+	var target, low, high, mid float64
+
+	target = this.primitive(from) + amount
+
+	if this.primitive(this.end) < target {
+		return 0, false
+	}
+
+	low = from
+	high = this.end
+
+	for {
+		mid = low + (high - low) / 2
+
+		if (mid <= low) || (mid >= high) {
+			break
+		}
+
+		if this.primitive(mid) < target {
+			low = mid
+		} else {
+			high = mid
+		}
+	}
+
+	return high, true
+}
+
+
+// Parse the `load` of a behavior:
+//
+//   load: { 0: 10, 30: 50, 60: 0 }   # time to rate map
+//   load: !ramp { from: 1, to: 100, start: 0, end: 60 }
+//   load: !sine { base: 50, amplitude: 20, period: 10, start: 0, end: 60 }
+//
+// A time to rate map keeps each rate constant until the next time unless
+// `interpolation` is `linear` in which case the rate changes linearly between
+// two times.
+// A ramp changes the rate linearly from `from` to `to` between `start`
+// (default 0) and `end`.
+// A sine oscillates around `base` during `start` (default 0) and `end`. The
+// amplitude cannot exceed the base so the rate is never negative.
+// The rate is 0 outside of the specified times.
+//
+func parseLoadSegments(behavior BenchmarkExpression) ([]loadSegment, error) {
+	var load BenchmarkExpression
+	var ltype string
+	var err error
+
+	load = behavior.Field("load")
+
+	ltype, err = load.etype()
+	if err != nil {
+		return parseLoadMap(behavior, load)
+	} else if ltype == "ramp" {
+		return parseLoadRamp(load)
+	} else if ltype == "sine" {
+		return parseLoadSine(load)
+	}
+
+	return nil, fmt.Errorf("%s: unknown load shape '%s'",
+		load.FullPosition(), ltype)
+}
+
+func parseLoadMap(behavior, load BenchmarkExpression) ([]loadSegment, error) {
+	var rates map[float64]float64 = make(map[float64]float64)
+	var field, entry BenchmarkExpression
+	var interpolation string
+	var time float64
+	var err error
+
+	interpolation = "step"
+	field, err = behavior.TryField("interpolation")
+	if err == nil {
+		interpolation, err = field.GetString()
+		if err != nil {
+			return nil, err
+		}
+
+		if (interpolation != "step") && (interpolation != "linear") {
+			return nil, fmt.Errorf("%s: unknown interpolation " +
+				"'%s'", field.FullPosition(), interpolation)
+		}
+	}
+
+	for _, entry = range load.Map() {
+		time, err = entry.Key().GetFloat()
+		if err != nil {
+			return nil, err
+		}
+
+		if time < 0 {
+			return nil, fmt.Errorf("%s: must be positive or zero",
+				entry.Key().FullPosition())
+		}
+
+		rates[time], err = entry.Value().GetFloat()
+		if err != nil {
+			return nil, err
+		}
+
+		if rates[time] < 0 {
+			return nil, fmt.Errorf("%s: must be positive or zero",
+				entry.Value().FullPosition())
+		}
+	}
+
+	return newLoadSegments(rates, (interpolation == "linear")), nil
+}
+
+// Return the segments of a time to rate map.
+// The rate of the last time is ignored since there is no end to its segment.
+//
+func newLoadSegments(rates map[float64]float64, linear bool) []loadSegment {
+	var segments []loadSegment
+	var times []float64
+	var time, to float64
+	var i int
+
+	times = make([]float64, 0, len(rates))
+	for time = range rates {
+		times = append(times, time)
+	}
+
+	sort.Float64s(times)
+
+	segments = make([]loadSegment, 0, len(times))
+
+	for i = 1; i < len(times); i++ {
+		if linear {
+			to = rates[times[i]]
+		} else {
+			to = rates[times[i-1]]
+		}
+
+		segments = append(segments, newLinearSegment(times[i-1],
+			times[i], rates[times[i-1]], to))
+	}
+
+	return segments
+}
+
+// Return the total time covered by the given segments.
+//
+func loadDuration(segments []loadSegment) float64 {
+	var segment loadSegment
+	var start, end float64
+	var ret float64 = 0
+
+	for _, segment = range segments {
+		start, end = segment.span()
+		ret += end - start
+	}
+
+	return ret
+}
+
+func parseLoadRamp(load BenchmarkExpression) ([]loadSegment, error) {
+	var from, to, start, end float64
+	var err error
+
+	from, err = load.Field("from").GetFloat()
+	if err != nil {
+		return nil, err
+	}
+
+	to, err = load.Field("to").GetFloat()
+	if err != nil {
+		return nil, err
+	}
+
+	if (from < 0) || (to < 0) {
+		return nil, fmt.Errorf("%s: rates must be positive or zero",
+			load.FullPosition())
+	}
+
+	start, end, err = parseLoadInterval(load)
+	if err != nil {
+		return nil, err
+	}
+
+	return []loadSegment{ newLinearSegment(start, end, from, to) }, nil
+}
+
+func parseLoadSine(load BenchmarkExpression) ([]loadSegment, error) {
+	var base, amplitude, period, start, end float64
+	var err error
+
+	base, err = load.Field("base").GetFloat()
+	if err != nil {
+		return nil, err
+	}
+
+	amplitude, err = load.Field("amplitude").GetFloat()
+	if err != nil {
+		return nil, err
+	}
+
+	if math.Abs(amplitude) > base {
+		return nil, fmt.Errorf("%s: amplitude cannot exceed base",
+			load.Field("amplitude").FullPosition())
+	}
+
+	period, err = load.Field("period").GetFloat()
+	if err != nil {
+		return nil, err
+	}
+
+	if period <= 0 {
+		return nil, fmt.Errorf("%s: must be strictly positive",
+			load.Field("period").FullPosition())
+	}
+
+	start, end, err = parseLoadInterval(load)
+	if err != nil {
+		return nil, err
+	}
+
+	return []loadSegment{
+		newSineSegment(start, end, base, amplitude, period),
+	}, nil
+}
+
+func parseLoadInterval(load BenchmarkExpression) (float64, float64, error) {
+	var field BenchmarkExpression
+	var start, end float64
+	var err error
+
+	start = 0
+	field, err = load.TryField("start")
+	if err == nil {
+		start, err = field.GetFloat()
+		if err != nil {
+			return 0, 0, err
+		}
+
+		if start < 0 {
+			return 0, 0, fmt.Errorf("%s: must be positive or zero",
+				field.FullPosition())
+		}
+	}
+
+	end, err = load.Field("end").GetFloat()
+	if err != nil {
+		return 0, 0, err
+	}
+
+	if end <= start {
+		return 0, 0, fmt.Errorf("%s: must be after start",
+			load.Field("end").FullPosition())
+	}
+
+	return start, end, nil
+}
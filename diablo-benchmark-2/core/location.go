@@ -32,8 +32,22 @@ type client interface {
 	// Send an interaction `encoded` to trigger (i.e. send the transactions
 	// it represents to the blockchain) at the specified `time` after the
 	// begining of the test.
+	// The `kind` and the `properties` set by the blockchain builder are
+	// recorded in the result of the interaction. The properties can be
+	// nil.
+	// If `loop` is not 0 then the interaction belongs to the pool of the
+	// given closed loop and `time` is how long to wait after an
+	// interaction completes before to trigger this one.
 	//
-	sendInteraction(kind string, time float64, encoded []byte) error
+	sendInteraction(loop int, kind *interactionKind, properties map[string]int, time float64, encoded []byte) error
+
+	// Create a closed loop which keeps `outstanding` interactions in
+	// flight for `duration` seconds after the begining of the test and
+	// return its index.
+	// The interactions of the loop are triggered in the order they are
+	// sent and the loop stops early if it has no more interaction.
+	//
+	createLoop(outstanding int, duration float64) (int, error)
 }
 
 
@@ -0,0 +1,75 @@
+package core
+
+
+// Check a benchmark without running it and report all the problems found
+// instead of stopping at the first one.
+// The benchmark is parsed like a plan does (see `Nplan`) with each of the
+// `Locations` as a fake secondary with the given list of tags. Without
+// locations, there is one location for each endpoint of the setup with the
+// tags of this endpoint.
+//
+type Ncheck struct {
+	SetupPath      string
+
+	BenchmarkPath  string
+
+	SystemMap      map[string]BlockchainInterface
+
+	Chain          BlockchainInterface
+
+	Locations      [][]string
+
+	Env            []string
+
+	Defines        map[string]string
+}
+
+// Return the problems found in the benchmark, each prefixed with the position
+// where it occurs.
+// Return an error only if the benchmark cannot be checked (e.g. the setup
+// file cannot be read).
+//
+func (this *Ncheck) Run() ([]string, error) {
+	var endpoint endpoint
+	var problems []string
+	var setup setup
+	var nplan Nplan
+	var sys *system
+	var err error
+
+	nplan = Nplan{
+		SetupPath: this.SetupPath,
+		BenchmarkPath: this.BenchmarkPath,
+		SystemMap: this.SystemMap,
+		Chain: this.Chain,
+		Locations: this.Locations,
+		MasterSeed: 0,
+		Env: this.Env,
+		Defines: this.Defines,
+	}
+
+	if len(nplan.Locations) == 0 {
+		setup, err = parseSetupYamlPath(this.SetupPath)
+		if err != nil {
+			return nil, err
+		}
+
+		nplan.Locations = make([][]string, 0)
+		for _, endpoint = range setup.endpoints() {
+			nplan.Locations = append(nplan.Locations,
+				endpoint.tags())
+		}
+	}
+
+	_, sys, err = nplan.run(true)
+	if sys == nil {
+		return nil, err
+	}
+
+	problems = sys.problems
+	if err != nil {
+		problems = append(problems, err.Error())
+	}
+
+	return problems, nil
+}
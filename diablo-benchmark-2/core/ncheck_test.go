@@ -0,0 +1,192 @@
+package core
+
+
+import (
+	"fmt"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+
+func runTestCheck(t *testing.T, benchmark string) []string {
+	var dir string = t.TempDir()
+	var problems []string
+	var ncheck Ncheck
+	var err error
+
+	writeTestFile(t, filepath.Join(dir, "setup.yaml"), `
+interface: "test"
+endpoints:
+  - addresses: [ "node-0" ]
+    tags: [ "eu" ]
+`)
+	writeTestFile(t, filepath.Join(dir, "benchmark.yaml"), benchmark)
+
+	ncheck = Ncheck{
+		SetupPath: filepath.Join(dir, "setup.yaml"),
+		BenchmarkPath: filepath.Join(dir, "benchmark.yaml"),
+		Chain: &testPlanChain{},
+	}
+
+	problems, err = ncheck.Run()
+	if err != nil {
+		t.Fatalf("check: %s", err.Error())
+	}
+
+	return problems
+}
+
+func TestCheckValid(t *testing.T) {
+	var problems []string
+
+	problems = runTestCheck(t, `
+let:
+  - &loc { sample: !location [ "eu" ] }
+  - &endpoint { sample: !endpoint [ ".*" ] }
+  - &account { sample: !account { number: 4, stake: 100 } }
+workloads:
+  - number: 2
+    client:
+      location: *loc
+      view: *endpoint
+      behavior:
+        - interaction: !transfer { from: *account, to: *account }
+          load: { 0: 2, 5: 0 }
+`)
+
+	if len(problems) != 0 {
+		t.Fatalf("unexpected problems %v", problems)
+	}
+}
+
+func TestCheckProblems(t *testing.T) {
+	var expected []string
+	var problems []string
+	var i int
+
+	problems = runTestCheck(t, `
+let:
+  - &loc { sample: !location [ "us" ] }
+  - &eu { sample: !location [ "eu" ] }
+  - &endpoint { sample: !endpoint [ ".*" ] }
+  - &account { sample: !account { number: 4, stake: 100 } }
+workloads:
+  - client:
+      location: *loc
+      view: *endpoint
+      behavior:
+        - interaction: !transfer { from: *account, to: *account }
+          load: { 0: 2, 5: 0 }
+  - client:
+      location: *eu
+      view: *endpoint
+      behavior:
+        - interaction: !transfer { from: *account, to: !var "nobody" }
+          load: { 0: 2, 5: 0 }
+        - interaction: !transfer { from: *account, to: *account }
+          load: { 0: 2 }
+        - interaction: !transfer { from: *account, to: *account }
+          lod: { 0: 2, 5: 0 }
+        - !burst
+          interaction: !transfer { from: *account, to: *account }
+        - interaction: !transfer { from: *account, to: *account }
+          load: { 0: 2, 5: 0 }
+          interpolation: "step"
+          weight: 3
+`)
+
+	expected = []string{
+		"benchmark.yaml:3:32: regexp 'us' matches no tag",
+		"benchmark.yaml:9:17: variable exhausted",
+		"benchmark.yaml:21:17: load has zero duration",
+		"benchmark.yaml:22:11: missing 'load' field",
+		"benchmark.yaml:24:11: unknown behavior 'burst'",
+		"benchmark.yaml:18:56: unknown variable 'nobody'",
+		"benchmark.yaml:29:11: unknown field 'weight'",
+	}
+
+	if len(problems) != len(expected) {
+		t.Fatalf("got problems %q", problems)
+	}
+
+	for i = range expected {
+		if !strings.HasSuffix(problems[i], expected[i]) {
+			t.Fatalf("problem %d is '%s', expected '%s'", i,
+				problems[i], expected[i])
+		}
+	}
+}
+
+
+// A blockchain interface with its own interaction types which can only be
+// checked offline.
+//
+type testCheckChain struct {
+	testOfflineChain
+}
+
+func (this *testCheckChain) OfflineBuilder(map[string]string, []string, map[string][]string, Logger) (BlockchainBuilder, error) {
+	return &testCheckBuilder{}, nil
+}
+
+
+type testCheckBuilder struct {
+	testPlanBuilder
+}
+
+func (this *testCheckBuilder) EncodeInteraction(itype string, expr BenchmarkExpression, info InteractionInfo) ([]byte, error) {
+	if itype != "custom" {
+		return nil, fmt.Errorf("unknown interaction type '%s'", itype)
+	}
+
+	return []byte{}, nil
+}
+
+
+func TestCheckSetupInteractions(t *testing.T) {
+	var dir string = t.TempDir()
+	var problems []string
+	var ncheck Ncheck
+	var err error
+
+	writeTestFile(t, filepath.Join(dir, "setup.yaml"), `
+interface: "test"
+endpoints:
+  - addresses: [ "node-0" ]
+    tags: [ "eu" ]
+`)
+	writeTestFile(t, filepath.Join(dir, "benchmark.yaml"), `
+let:
+  - &loc { sample: !location [ "eu" ] }
+  - &endpoint { sample: !endpoint [ ".*" ] }
+workloads:
+  - client:
+      location: *loc
+      view: *endpoint
+      behavior:
+        - interaction: !custom {}
+          load: { 0: 2, 5: 0 }
+        - interaction: !bogus {}
+          load: { 0: 2, 5: 0 }
+`)
+
+	ncheck = Ncheck{
+		SetupPath: filepath.Join(dir, "setup.yaml"),
+		BenchmarkPath: filepath.Join(dir, "benchmark.yaml"),
+		SystemMap: map[string]BlockchainInterface{
+			"test": &testCheckChain{},
+		},
+		Chain: &testPlanChain{},
+	}
+
+	problems, err = ncheck.Run()
+	if err != nil {
+		t.Fatalf("check: %s", err.Error())
+	}
+
+	if (len(problems) != 1) ||
+		!strings.Contains(problems[0], "unknown interaction type 'bogus'") {
+		t.Fatalf("got problems %q", problems)
+	}
+}
@@ -3,7 +3,9 @@ package core
 
 import (
 	"bufio"
+	"fmt"
 	"net"
+	"time"
 )
 
 
@@ -21,15 +23,41 @@ func newPrimaryConn(conn net.Conn) *primaryConn {
 	}
 }
 
+// Exchange the protocol versions with the primary then send the parameters
+// of this secondary.
+// The version of this secondary is sent back even if it does not match so
+// the primary reports the mismatch too.
+// The primary then admits or rejects this secondary and sends its own
+// parameters only once admitted, so a secondary with an invalid token never
+// learns the parameters of the blockchain.
+//
 func (this *primaryConn) init(fromSecondary *msgSecondaryParameters) (*msgPrimaryParameters, error) {
-	var fromPrimary *msgPrimaryParameters
+	var admission *msgAdmission
+	var hello *msgHello
 	var err error
 
-	fromPrimary, err = decodeMsgPrimaryParameters(this.reader)
+	hello, err = decodeMsgHello(this.reader)
+	if err != nil {
+		return nil, fmt.Errorf("handshake with primary: %s",
+			err.Error())
+	}
+
+	err = (&msgHello{ version: protocolVersion }).encode(this.writer)
+	if err != nil {
+		return nil, err
+	}
+
+	err = this.writer.Flush()
 	if err != nil {
 		return nil, err
 	}
 
+	if hello.version != protocolVersion {
+		return nil, fmt.Errorf("primary speaks protocol version %d " +
+			"but this secondary speaks version %d", hello.version,
+			protocolVersion)
+	}
+
 	err = fromSecondary.encode(this.writer)
 	if err != nil {
 		return nil, err
@@ -40,7 +68,17 @@ func (this *primaryConn) init(fromSecondary *msgSecondaryParameters) (*msgPrimar
 		return nil, err
 	}
 
-	return fromPrimary, nil
+	admission, err = decodeMsgAdmission(this.reader)
+	if err != nil {
+		return nil, err
+	}
+
+	if admission.reason != "" {
+		return nil, fmt.Errorf("rejected by primary: %s",
+			admission.reason)
+	}
+
+	return decodeMsgPrimaryParameters(this.reader)
 }
 
 func (this *primaryConn) waitPrepare() (msgPrepare, error) {
@@ -58,8 +96,45 @@ func (this *primaryConn) syncReady() error {
 	return this.writer.Flush()
 }
 
+// Answer the pings of the primary until it sends the start message.
+//
 func (this *primaryConn) waitStart() (*msgStart, error) {
-	return decodeMsgStart(this.reader)
+	var receiveTime int64
+	var start *msgStart
+	var ping *msgPing
+	var msg msgSync
+	var err error
+	var ok bool
+
+	for {
+		msg, err = decodeMsgSync(this.reader)
+		if err != nil {
+			return nil, err
+		}
+
+		receiveTime = time.Now().UnixNano()
+
+		start, ok = msg.(*msgStart)
+		if ok {
+			return start, nil
+		}
+
+		ping = msg.(*msgPing)
+
+		err = (&msgPong{
+			pingTime: ping.sendTime,
+			receiveTime: receiveTime,
+			sendTime: time.Now().UnixNano(),
+		}).encode(this.writer)
+		if err != nil {
+			return nil, err
+		}
+
+		err = this.writer.Flush()
+		if err != nil {
+			return nil, err
+		}
+	}
 }
 
 func (this *primaryConn) pushResult(fromSecondary msgResult) error {
@@ -101,10 +176,16 @@ func newSecondaryConn(conn net.Conn) *secondaryConn {
 	}
 }
 
-func (this *secondaryConn) init(fromPrimary *msgPrimaryParameters) (*msgSecondaryParameters, error) {
+// Exchange the protocol versions with the secondary then receive its
+// parameters.
+// The primary must then admit or reject the secondary before sending its own
+// parameters.
+//
+func (this *secondaryConn) init() (*msgSecondaryParameters, error) {
+	var hello *msgHello
 	var err error
 
-	err = fromPrimary.encode(this.writer)
+	err = (&msgHello{ version: protocolVersion }).encode(this.writer)
 	if err != nil {
 		return nil, err
 	}
@@ -114,9 +195,48 @@ func (this *secondaryConn) init(fromPrimary *msgPrimaryParameters) (*msgSecondar
 		return nil, err
 	}
 
+	hello, err = decodeMsgHello(this.reader)
+	if err != nil {
+		return nil, fmt.Errorf("handshake with secondary %s: %s",
+			this.addr(), err.Error())
+	}
+
+	if hello.version != protocolVersion {
+		return nil, fmt.Errorf("secondary %s speaks protocol version " +
+			"%d but this primary speaks version %d", this.addr(),
+			hello.version, protocolVersion)
+	}
+
 	return decodeMsgSecondaryParameters(this.reader)
 }
 
+// Tell the secondary if it is admitted, i.e. if `reason` is empty, or why it
+// is rejected.
+//
+func (this *secondaryConn) admit(reason string) error {
+	var err error
+
+	err = (&msgAdmission{ reason: reason }).encode(this.writer)
+	if err != nil {
+		return err
+	}
+
+	return this.writer.Flush()
+}
+
+// Send the parameters of the primary to an admitted secondary.
+//
+func (this *secondaryConn) sendParameters(fromPrimary *msgPrimaryParameters) error {
+	var err error
+
+	err = fromPrimary.encode(this.writer)
+	if err != nil {
+		return err
+	}
+
+	return this.writer.Flush()
+}
+
 func (this *secondaryConn) sendPrepare(fromPrimary msgPrepare) error {
 	return fromPrimary.encode(this.writer)
 }
@@ -142,6 +262,40 @@ func (this *secondaryConn) syncReady() error {
 	return nil
 }
 
+// Send a ping to the secondary and estimate its clock from the answer.
+//
+func (this *secondaryConn) ping() (*clockEstimate, error) {
+	var sendTime, receiveTime int64
+	var pong *msgPong
+	var err error
+
+	sendTime = time.Now().UnixNano()
+
+	err = (&msgPing{ sendTime: sendTime }).encode(this.writer)
+	if err != nil {
+		return nil, err
+	}
+
+	err = this.writer.Flush()
+	if err != nil {
+		return nil, err
+	}
+
+	pong, err = decodeMsgPong(this.reader)
+	if err != nil {
+		return nil, err
+	}
+
+	receiveTime = time.Now().UnixNano()
+
+	if pong.pingTime != sendTime {
+		return nil, fmt.Errorf("unexpected pong from %s", this.addr())
+	}
+
+	return newClockEstimate(sendTime, pong.receiveTime, pong.sendTime,
+		receiveTime), nil
+}
+
 func (this *secondaryConn) sendStart(fromPrimary *msgStart) error {
 	var err error
 
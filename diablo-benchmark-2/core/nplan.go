@@ -0,0 +1,294 @@
+package core
+
+
+import (
+	"errors"
+	"fmt"
+	"math"
+)
+
+
+// Parse a benchmark as a primary would do but without any secondary and
+// without contacting any blockchain.
+// The builder is the offline builder of the setup interface if this interface
+// is in `SystemMap` and implements `BlockchainOfflineInterface`. Otherwise,
+// the builder is created by `Chain` which must never contact any blockchain.
+// Each of the `Locations` is a fake secondary with the given list of tags.
+// The generated interactions are recorded in a plan instead of being sent.
+//
+type Nplan struct {
+	SetupPath      string
+
+	BenchmarkPath  string
+
+	SystemMap      map[string]BlockchainInterface
+
+	Chain          BlockchainInterface
+
+	Locations      [][]string
+
+	MasterSeed     int64
+
+	Env            []string
+
+	Defines        map[string]string
+}
+
+func (this *Nplan) Run() (*Plan, error) {
+	var plan *Plan
+	var err error
+
+	plan, _, err = this.run(false)
+
+	return plan, err
+}
+
+// Parse the benchmark and return the plan along with the system used to
+// parse it.
+// If `checking` then the parsing goes on after errors and the system records
+// them.
+//
+func (this *Nplan) run(checking bool) (*Plan, *system, error) {
+	var endpoints map[string][]string
+	var builder BlockchainBuilder
+	var locations []location
+	var endpoint endpoint
+	var tags []string
+	var setup setup
+	var plan *Plan
+	var sys *system
+	var err error
+	var i int
+
+	Debugf("use master seed: %d", this.MasterSeed)
+	Debugf("parse setup file '%s'", this.SetupPath)
+	setup, err = parseSetupYamlPath(this.SetupPath)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	endpoints = make(map[string][]string)
+	for _, endpoint = range setup.endpoints() {
+		tags = make([]string, len(endpoint.tags()))
+		copy(tags, endpoint.tags())
+		endpoints[endpoint.address()] = tags
+	}
+
+	builder, err = this.offlineBuilder(setup, endpoints)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	plan = newPlan()
+
+	locations = make([]location, len(this.Locations))
+	for i = range this.Locations {
+		locations[i] = newPlanLocation(plan,
+			fmt.Sprintf("plan-%d", i), this.Locations[i])
+	}
+
+	sys = newSystem(this.MasterSeed, locations, setup, builder)
+	sys.checking = checking
+	if this.Defines != nil {
+		sys.defines = this.Defines
+	}
+
+	Debugf("parse benchmark '%s'", this.BenchmarkPath)
+	err = parseBenchmarkYamlPath(this.BenchmarkPath, sys)
+
+	// An exhausted variable stops the generation like it would do for a
+	// primary. Report it and keep what has been generated so far.
+	//
+	if errors.Is(err, errVariableExhausted) {
+		plan.Warnings = append(plan.Warnings, err.Error())
+	} else if err != nil {
+		return nil, sys, err
+	}
+
+	plan.Variables = sys.seeds
+	plan.Stakes = sys.stakes
+
+	return plan, sys, nil
+}
+
+func (this *Nplan) offlineBuilder(setup setup, endpoints map[string][]string) (BlockchainBuilder, error) {
+	var offline BlockchainOfflineInterface
+	var chain BlockchainInterface
+	var logger Logger
+	var ok bool
+
+	logger = ExtendLogger("builder")
+
+	chain, ok = this.SystemMap[setup.sysname()]
+	if ok {
+		offline, ok = chain.(BlockchainOfflineInterface)
+	}
+
+	if ok {
+		Debugf("use offline builder of interface '%s'",
+			setup.sysname())
+		return offline.OfflineBuilder(setup.parameters(), this.Env,
+			endpoints, logger)
+	}
+
+	if this.Chain == nil {
+		return nil, fmt.Errorf("interface '%s' cannot build " +
+			"offline", setup.sysname())
+	}
+
+	Debugf("interface '%s' cannot build offline, use a placeholder " +
+		"interface", setup.sysname())
+
+	return this.Chain.Builder(setup.parameters(), this.Env, endpoints,
+		logger)
+}
+
+
+// The interactions a benchmark would send to the secondaries.
+//
+type Plan struct {
+	Duration   float64
+	Variables  []*VariableResult
+	Stakes     []*StakeResult
+	Clients    []*PlanClient
+	Warnings   []string
+}
+
+type PlanClient struct {
+	Location      string
+	Index         int
+	Kind          string
+	View          []string
+	Loops         []*PlanLoop
+	Interactions  []*PlanInteraction
+}
+
+type PlanLoop struct {
+	Outstanding  int
+	Duration     float64
+}
+
+type PlanInteraction struct {
+	Kind        string
+	Label       string
+	Type        string
+	Loop        int      // 0 if not part of a closed loop
+	Time        float64  // think time if part of a closed loop
+	Properties  map[string]int
+}
+
+
+func newPlan() *Plan {
+	return &Plan{
+		Duration: 0,
+		Clients: make([]*PlanClient, 0),
+		Warnings: make([]string, 0),
+	}
+}
+
+// Return the number of open loop interactions scheduled during each second
+// of the benchmark.
+//
+func (this *Plan) PerSecond() []int {
+	var iact *PlanInteraction
+	var client *PlanClient
+	var ret []int
+	var second int
+
+	ret = make([]int, int(math.Ceil(this.Duration)) + 1)
+
+	for _, client = range this.Clients {
+		for _, iact = range client.Interactions {
+			if iact.Loop != 0 {
+				continue
+			}
+
+			second = int(iact.Time)
+			ret[second] += 1
+		}
+	}
+
+	return ret
+}
+
+
+type planLocation struct {
+	plan   *Plan
+	name   string
+	ltags  []string
+	index  int
+}
+
+func newPlanLocation(plan *Plan, name string, tags []string) *planLocation {
+	var ltags []string
+
+	ltags = make([]string, len(tags), len(tags) + 1)
+	copy(ltags, tags)
+	ltags = append(ltags, name)
+
+	return &planLocation{
+		plan: plan,
+		name: name,
+		ltags: ltags,
+		index: 0,
+	}
+}
+
+func (this *planLocation) createClient(kind string, view []string) (client, error) {
+	var client *PlanClient
+
+	client = &PlanClient{
+		Location: this.name,
+		Index: this.index,
+		Kind: kind,
+		View: view,
+		Loops: make([]*PlanLoop, 0),
+		Interactions: make([]*PlanInteraction, 0),
+	}
+
+	this.index += 1
+	this.plan.Clients = append(this.plan.Clients, client)
+
+	return &planClient{ this.plan, client }, nil
+}
+
+func (this *planLocation) tags() []string {
+	return this.ltags
+}
+
+
+type planClient struct {
+	plan    *Plan
+	client  *PlanClient
+}
+
+func (this *planClient) sendInteraction(loop int, kind *interactionKind, properties map[string]int, time float64, encoded []byte) error {
+	if (loop == 0) && (time > this.plan.Duration) {
+		this.plan.Duration = time
+	}
+
+	this.client.Interactions = append(this.client.Interactions,
+		&PlanInteraction{
+			Kind: kind.name,
+			Label: kind.label,
+			Type: kind.itype,
+			Loop: loop,
+			Time: time,
+			Properties: properties,
+		})
+
+	return nil
+}
+
+func (this *planClient) createLoop(outstanding int, duration float64) (int, error) {
+	this.client.Loops = append(this.client.Loops, &PlanLoop{
+		Outstanding: outstanding,
+		Duration: duration,
+	})
+
+	if duration > this.plan.Duration {
+		this.plan.Duration = duration
+	}
+
+	return len(this.client.Loops), nil
+}
@@ -0,0 +1,386 @@
+package core
+
+
+import (
+	"fmt"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+
+// A blockchain interface which never contacts any blockchain.
+//
+type testPlanChain struct {
+	builder  *testPlanBuilder  // last created builder
+}
+
+func (this *testPlanChain) Builder(map[string]string, []string, map[string][]string, Logger) (BlockchainBuilder, error) {
+	this.builder = &testPlanBuilder{ 0, nil }
+	return this.builder, nil
+}
+
+func (this *testPlanChain) Client(map[string]string, []string, []string, Logger) (BlockchainClient, error) {
+	return nil, fmt.Errorf("no client")
+}
+
+
+type testPlanBuilder struct {
+	accounts  int
+	invokes   [][]interface{}  // arguments of the encoded invokes
+}
+
+func (this *testPlanBuilder) CreateAccount(int) (interface{}, error) {
+	this.accounts += 1
+	return this.accounts, nil
+}
+
+func (this *testPlanBuilder) CreateContract(string) (interface{}, error) {
+	return 0, nil
+}
+
+func (this *testPlanBuilder) CreateResource(string) (SampleFactory, bool) {
+	return nil, false
+}
+
+func (this *testPlanBuilder) EncodeTransfer(int, interface{}, interface{}, InteractionInfo) ([]byte, error) {
+	return []byte{}, nil
+}
+
+func (this *testPlanBuilder) EncodeInvoke(from, contract interface{}, function string, args []interface{}, info InteractionInfo) ([]byte, error) {
+	this.invokes = append(this.invokes, args)
+	return []byte{}, nil
+}
+
+func (this *testPlanBuilder) EncodeInteraction(string, BenchmarkExpression, InteractionInfo) ([]byte, error) {
+	return []byte{}, nil
+}
+
+
+func runTestPlan(t *testing.T, benchmark string, locations [][]string) *Plan {
+	return runTestPlanChain(t, benchmark, locations, &testPlanChain{})
+}
+
+func runTestPlanChain(t *testing.T, benchmark string, locations [][]string, chain *testPlanChain) *Plan {
+	var dir string = t.TempDir()
+	var nplan Nplan
+	var plan *Plan
+	var err error
+
+	writeTestFile(t, filepath.Join(dir, "setup.yaml"), `
+interface: "test"
+endpoints:
+  - addresses: [ "node-0" ]
+    tags: [ "eu" ]
+`)
+	writeTestFile(t, filepath.Join(dir, "benchmark.yaml"), benchmark)
+
+	nplan = Nplan{
+		SetupPath: filepath.Join(dir, "setup.yaml"),
+		BenchmarkPath: filepath.Join(dir, "benchmark.yaml"),
+		Chain: chain,
+		Locations: locations,
+		MasterSeed: 42,
+	}
+
+	plan, err = nplan.Run()
+	if err != nil {
+		t.Fatalf("plan: %s", err.Error())
+	}
+
+	return plan
+}
+
+func TestPlanSchedule(t *testing.T) {
+	var counts []int
+	var plan *Plan
+	var i, sum int
+
+	plan = runTestPlan(t, `
+let:
+  - &loc { sample: !location [ "eu" ] }
+  - &endpoint { sample: !endpoint [ ".*" ] }
+  - &account { sample: !account { number: 4, stake: 100 } }
+workloads:
+  - number: 2
+    client:
+      location: *loc
+      view: *endpoint
+      behavior:
+        - interaction: !transfer { from: *account, to: *account }
+          load: { 0: 2, 5: 0 }
+`, [][]string{ []string{ "eu" }, []string{ "us" } })
+
+	if len(plan.Clients) != 2 {
+		t.Fatalf("got %d clients, expected 2", len(plan.Clients))
+	}
+
+	for i = range plan.Clients {
+		if plan.Clients[i].Location != "plan-0" {
+			t.Fatalf("client on wrong location '%s'",
+				plan.Clients[i].Location)
+		}
+
+		if len(plan.Clients[i].Interactions) != 10 {
+			t.Fatalf("got %d interactions, expected 10",
+				len(plan.Clients[i].Interactions))
+		}
+	}
+
+	if (plan.Duration <= 4) || (plan.Duration > 5) {
+		t.Fatalf("got duration %f, expected 5", plan.Duration)
+	}
+
+	counts = plan.PerSecond()
+	sum = 0
+	for i = range counts {
+		sum += counts[i]
+	}
+
+	if (len(counts) != 6) || (counts[2] != 4) || (sum != 20) {
+		t.Fatalf("wrong counts per second %v", counts)
+	}
+
+	if len(plan.Warnings) != 0 {
+		t.Fatalf("unexpected warnings %v", plan.Warnings)
+	}
+}
+
+func TestPlanExhausted(t *testing.T) {
+	var plan *Plan
+
+	plan = runTestPlan(t, `
+let:
+  - &loc { sample: !location [ ".*" ] }
+  - &endpoint { sample: !endpoint [ ".*" ] }
+  - !iter &account { sample: !account { number: 3, stake: 100 } }
+workloads:
+  - client:
+      location: *loc
+      view: *endpoint
+      behavior:
+        - interaction: !transfer { from: *account, to: *account }
+          load: { 0: 1, 10: 0 }
+`, [][]string{ []string{} })
+
+	if len(plan.Warnings) != 1 {
+		t.Fatalf("got %d warnings, expected 1", len(plan.Warnings))
+	}
+
+	if len(plan.Clients[0].Interactions) != 1 {
+		t.Fatalf("got %d interactions before exhaustion, expected 1",
+			len(plan.Clients[0].Interactions))
+	}
+}
+
+func TestPlanLabels(t *testing.T) {
+	var iact *PlanInteraction
+	var labels map[string]int
+	var plan *Plan
+
+	plan = runTestPlan(t, `
+let:
+  - &loc { sample: !location [ ".*" ] }
+  - &endpoint { sample: !endpoint [ ".*" ] }
+  - &account { sample: !account { number: 4, stake: 100 } }
+workloads:
+  - client:
+      location: *loc
+      view: *endpoint
+      behavior:
+        - label: "local"
+          interaction: !transfer { from: *account, to: *account }
+          load: { 0: 1, 3: 0 }
+        - label: "local"
+          interaction: !transfer
+            from: *account
+            to: *account
+            label: "remote"
+          load: { 0: 1, 3: 0 }
+        - interaction: !transfer { from: *account, to: *account }
+          load: { 0: 1, 3: 0 }
+`, [][]string{ []string{} })
+
+	labels = make(map[string]int)
+	for _, iact = range plan.Clients[0].Interactions {
+		labels[iact.Label] += 1
+
+		if iact.Type != "transfer" {
+			t.Fatalf("got type '%s', expected 'transfer'",
+				iact.Type)
+		}
+	}
+
+	if (labels["local"] != 3) || (labels["remote"] != 3) ||
+		(labels[""] != 3) {
+		t.Fatalf("wrong labels %v", labels)
+	}
+}
+
+func TestPlanInvokeArguments(t *testing.T) {
+	var chain *testPlanChain = &testPlanChain{}
+	var args []interface{}
+
+	runTestPlanChain(t, `
+let:
+  - &loc { sample: !location [ ".*" ] }
+  - &endpoint { sample: !endpoint [ ".*" ] }
+  - &account { sample: !account { number: 1, stake: 100 } }
+  - &token { sample: !contract { name: "token" } }
+  - &n { sample: !integer { from: 5, to: 5 } }
+workloads:
+  - client:
+      location: *loc
+      view: *endpoint
+      behavior:
+        - interaction: !invoke
+            from: *account
+            contract: *token
+            function: "transfer(address,uint256)"
+            args: [ 7, "memo", *account, *n, !expr "n * 2" ]
+          load: { 0: 1, 1: 0 }
+`, [][]string{ []string{} }, chain)
+
+	if len(chain.builder.invokes) != 1 {
+		t.Fatalf("got %d invokes, expected 1",
+			len(chain.builder.invokes))
+	}
+
+	args = chain.builder.invokes[0]
+	if len(args) != 5 {
+		t.Fatalf("got %d arguments, expected 5", len(args))
+	}
+
+	if (args[0] != 7) || (args[1] != "memo") || (args[2] != 1) ||
+		(args[3] != 5) || (args[4] != 10) {
+		t.Fatalf("wrong arguments %v", args)
+	}
+}
+
+func TestPlanInvokeFloatArguments(t *testing.T) {
+	var dir string = t.TempDir()
+	var nplan Nplan
+	var arg string
+	var err error
+
+	writeTestFile(t, filepath.Join(dir, "setup.yaml"), `
+interface: "test"
+endpoints:
+  - addresses: [ "node-0" ]
+    tags: [ "eu" ]
+`)
+
+	for _, arg = range []string{ "2.5", "*x" } {
+		writeTestFile(t, filepath.Join(dir, "benchmark.yaml"), `
+let:
+  - &loc { sample: !location [ ".*" ] }
+  - &endpoint { sample: !endpoint [ ".*" ] }
+  - &account { sample: !account { number: 1, stake: 100 } }
+  - &token { sample: !contract { name: "token" } }
+  - &x { sample: !float { from: 0.5, to: 0.5 } }
+workloads:
+  - client:
+      location: *loc
+      view: *endpoint
+      behavior:
+        - interaction: !invoke
+            from: *account
+            contract: *token
+            function: "f"
+            args: [ ` + arg + ` ]
+          load: { 0: 1, 1: 0 }
+`)
+
+		nplan = Nplan{
+			SetupPath: filepath.Join(dir, "setup.yaml"),
+			BenchmarkPath: filepath.Join(dir, "benchmark.yaml"),
+			Chain: &testPlanChain{},
+			Locations: [][]string{ []string{} },
+		}
+
+		_, err = nplan.Run()
+		if (err == nil) ||
+			!strings.Contains(err.Error(), "float arguments") {
+			t.Fatalf("argument %s: got %v", arg, err)
+		}
+	}
+}
+
+
+// A blockchain interface which can build offline and which fails if asked to
+// contact the blockchain.
+//
+type testOfflineChain struct {
+	testPlanChain
+}
+
+func (this *testOfflineChain) Builder(map[string]string, []string, map[string][]string, Logger) (BlockchainBuilder, error) {
+	return nil, fmt.Errorf("contacted the blockchain")
+}
+
+func (this *testOfflineChain) OfflineBuilder(params map[string]string, env []string, endpoints map[string][]string, logger Logger) (BlockchainBuilder, error) {
+	return this.testPlanChain.Builder(params, env, endpoints, logger)
+}
+
+
+func TestPlanOfflineBuilder(t *testing.T) {
+	var offline *testOfflineChain = &testOfflineChain{}
+	var fallback *testPlanChain = &testPlanChain{}
+	var dir string = t.TempDir()
+	var nplan Nplan
+	var err error
+
+	writeTestFile(t, filepath.Join(dir, "setup.yaml"), `
+interface: "test"
+endpoints:
+  - addresses: [ "node-0" ]
+    tags: [ "eu" ]
+`)
+	writeTestFile(t, filepath.Join(dir, "benchmark.yaml"), `
+let:
+  - &loc { sample: !location [ ".*" ] }
+  - &endpoint { sample: !endpoint [ ".*" ] }
+  - &account { sample: !account { number: 2, stake: 100 } }
+workloads:
+  - client:
+      location: *loc
+      view: *endpoint
+      behavior:
+        - interaction: !transfer { from: *account, to: *account }
+          load: { 0: 1, 1: 0 }
+`)
+
+	nplan = Nplan{
+		SetupPath: filepath.Join(dir, "setup.yaml"),
+		BenchmarkPath: filepath.Join(dir, "benchmark.yaml"),
+		SystemMap: map[string]BlockchainInterface{ "test": offline },
+		Chain: fallback,
+		Locations: [][]string{ []string{} },
+	}
+
+	_, err = nplan.Run()
+	if err != nil {
+		t.Fatalf("plan: %s", err.Error())
+	}
+
+	if (offline.builder == nil) || (offline.builder.accounts != 2) ||
+		(fallback.builder != nil) {
+		t.Fatalf("offline builder not used")
+	}
+
+	nplan.SystemMap = map[string]BlockchainInterface{
+		"test": &testPlanChain{},
+	}
+
+	_, err = nplan.Run()
+	if (err != nil) || (fallback.builder == nil) {
+		t.Fatalf("fallback interface not used: %v", err)
+	}
+
+	nplan.Chain = nil
+
+	_, err = nplan.Run()
+	if (err == nil) || !strings.Contains(err.Error(), "offline") {
+		t.Fatalf("plan without offline builder: got %v", err)
+	}
+}
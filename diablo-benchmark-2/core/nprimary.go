@@ -2,29 +2,47 @@ package core
 
 
 import (
+	"crypto/tls"
 	"fmt"
 	"net"
+	"sort"
+	"time"
+)
+
+
+const (
+	// How long a new connection has to complete the handshake before the
+	// primary gives up on it.
+	HANDSHAKE_TIMEOUT time.Duration = 10 * time.Second
 )
 
 
 type Nprimary struct {
-	NumSecondary   int
+	NumSecondary       int
+
+	SetupPath          string
 
-	SetupPath      string
+	BenchmarkPath      string
 
-	BenchmarkPath  string
+	SystemMap          map[string]BlockchainInterface
 
-	SystemMap      map[string]BlockchainInterface
+	ListenPort         int
 
-	ListenPort     int
+	MasterSeed         int64
 
-	MasterSeed     int64
+	MaxSkew            float64
 
-	MaxSkew        float64
+	MaxDelay           float64
 
-	MaxDelay       float64
+	MaxInflight        int
 
-	Env            []string
+	MaxClientInflight  int
+
+	Env                []string
+
+	Defines            map[string]string
+
+	Security           Security
 }
 
 func (this *Nprimary) Run() (*Result, error) {
@@ -33,8 +51,11 @@ func (this *Nprimary) Run() (*Result, error) {
 	var endpoints map[string][]string
 	var chain BlockchainInterface
 	var builder BlockchainBuilder
+	var sampler BlockchainSampler
 	var sresult *SecondaryResult
 	var locations []location
+	var lead time.Duration
+	var startTime time.Time
 	var endpoint endpoint
 	var result *Result
 	var logger Logger
@@ -42,7 +63,7 @@ func (this *Nprimary) Run() (*Result, error) {
 	var setup setup
 	var sys *system
 	var err error
-	var ok bool
+	var ok, sampling bool
 	var i int
 
 	Debugf("use master seed: %d", this.MasterSeed)
@@ -85,6 +106,9 @@ func (this *Nprimary) Run() (*Result, error) {
 	}
 
 	sys = newSystem(this.MasterSeed, locations, setup, builder)
+	if this.Defines != nil {
+		sys.defines = this.Defines
+	}
 
 	Debugf("parse benchmark '%s'", this.BenchmarkPath)
 	err = parseBenchmarkYamlPath(this.BenchmarkPath, sys)
@@ -108,15 +132,55 @@ func (this *Nprimary) Run() (*Result, error) {
 		secondaries[i].ready()
 	}	
 
+	Debugf("estimate secondary clocks")
+	lead = 0
+	for i = range secondaries {
+		err = secondaries[i].synchronize()
+		if err != nil {
+			return nil, err
+		}
+
+		if secondaries[i].clock.roundTrip > lead {
+			lead = secondaries[i].clock.roundTrip
+		}
+	}
+
+	startTime = time.Now().Add(lead + START_MARGIN)
+
+	// Sample the blockchain with the same time origin as the interaction
+	// results.
+	sampler, ok = builder.(BlockchainSampler)
+	if ok {
+		Debugf("start sampling blockchain")
+		err = sampler.StartSampling(startTime)
+		if err != nil {
+			return nil, err
+		}
+
+		// Do not leave the sampler running if the benchmark fails.
+		sampling = true
+		defer func() {
+			if sampling {
+				Debugf("stop sampling blockchain")
+				sampler.StopSampling()
+			}
+		}()
+	}
+
 	Infof("start benchmark")
 	for i = range secondaries {
 		Tracef("send start signal to %s", secondaries[i].addr())
-		secondaries[i].start(duration)
+		secondaries[i].start(duration, startTime)
 	}
 
 	Debugf("end of benchmark")
 
 	result = newResult(this.MasterSeed)
+	result.Variables = sys.seeds
+	if len(sys.stakes) > 0 {
+		result.Stakes = sys.stakes
+	}
+	result.Phases = sys.phases
 	for i = range secondaries {
 		Tracef("collect results from %s", secondaries[i].addr())
 		sresult, err = secondaries[i].collect()
@@ -128,6 +192,17 @@ func (this *Nprimary) Run() (*Result, error) {
 		secondaries[i].Close()
 	}
 
+	result.labelPhases()
+
+	if sampling {
+		Debugf("stop sampling blockchain")
+		sampling = false
+		result.Chain, err = sampler.StopSampling()
+		if err != nil {
+			return nil, err
+		}
+	}
+
 	return result, nil
 }
 
@@ -135,11 +210,17 @@ func (this *Nprimary) acceptSecondaries(setup setup) ([]*remoteSecondary, error)
 	var laddr, raddr, tag string
 	var ret []*remoteSecondary
 	var listener net.Listener
+	var config *tls.Config
 	var conn net.Conn
 	var err error
 	var done bool
 	var i int
 
+	config, err = this.Security.serverConfig()
+	if err != nil {
+		return nil, err
+	}
+
 	laddr = fmt.Sprintf("0.0.0.0:%d", this.ListenPort)
 	ret = make([]*remoteSecondary, this.NumSecondary)
 
@@ -149,6 +230,11 @@ func (this *Nprimary) acceptSecondaries(setup setup) ([]*remoteSecondary, error)
 		return nil, err
 	}
 
+	if config != nil {
+		Debugf("use tls on %s", laddr)
+		listener = tls.NewListener(listener, config)
+	}
+
 	done = false
 
 	defer func() {
@@ -169,7 +255,7 @@ func (this *Nprimary) acceptSecondaries(setup setup) ([]*remoteSecondary, error)
 		}
 	}()
 
-	for i = range ret {
+	for i = 0; i < len(ret); {
 		Tracef("wait for connection on %s", laddr)
 		conn, err = listener.Accept()
 		if err != nil {
@@ -181,14 +267,18 @@ func (this *Nprimary) acceptSecondaries(setup setup) ([]*remoteSecondary, error)
 
 		ret[i], err = newRemoteSecondary(conn, setup, this)
 		if err != nil {
+			Warnf("reject connection from %s: %s", raddr,
+				err.Error())
 			conn.Close()
-			return nil, err
+			continue
 		}
 
 		Tracef("secondary %s tags:", raddr)
 		for _, tag = range ret[i].tags() {
 			Tracef("  %s", tag)
 		}
+
+		i += 1
 	}
 
 	done = true
@@ -201,6 +291,7 @@ type remoteSecondary struct {
 	conn     *secondaryConn
 	params   *msgSecondaryParameters
 	clients  []*remoteClient
+	clock    *clockEstimate
 }
 
 func newRemoteSecondary(conn net.Conn, setup setup, primary *Nprimary) (*remoteSecondary, error) {
@@ -210,17 +301,46 @@ func newRemoteSecondary(conn net.Conn, setup setup, primary *Nprimary) (*remoteS
 	this.conn = newSecondaryConn(conn)
 	this.clients = make([]*remoteClient, 0)
 
-	this.params, err = this.conn.init(&msgPrimaryParameters{
+	err = conn.SetDeadline(time.Now().Add(HANDSHAKE_TIMEOUT))
+	if err != nil {
+		return nil, err
+	}
+
+	this.params, err = this.conn.init()
+	if err != nil {
+		return nil, err
+	}
+
+	// The parameters of the primary include the ones of the blockchain,
+	// possibly with credentials, so only admitted secondaries get them.
+	if !primary.Security.acceptToken(this.params.token) {
+		this.conn.admit("invalid token")
+		return nil, fmt.Errorf("invalid token")
+	}
+
+	err = this.conn.admit("")
+	if err != nil {
+		return nil, err
+	}
+
+	err = this.conn.sendParameters(&msgPrimaryParameters{
 		sysname: setup.sysname(),
 		chainParams: setup.parameters(),
 		maxDelay: primary.MaxDelay,
 		maxSkew: primary.MaxSkew,
+		maxInflight: primary.MaxInflight,
+		maxClientInflight: primary.MaxClientInflight,
 	})
 
 	if err != nil {
 		return nil, err
 	}
 
+	err = conn.SetDeadline(time.Time{})
+	if err != nil {
+		return nil, err
+	}
+
 	this.params.tags = append(this.params.tags, this.addr())
 
 	return &this, nil
@@ -255,22 +375,50 @@ func (this *remoteSecondary) ready() error {
 	return this.conn.syncReady()
 }
 
-func (this *remoteSecondary) start(duration float64) error {
+func (this *remoteSecondary) synchronize() error {
+	var err error
+
+	this.clock, err = estimateClock(this.conn, CLOCK_SYNC_ROUNDS)
+	if err != nil {
+		return err
+	}
+
+	Debugf("secondary %s clock offset is %s (+/- %s)", this.addr(),
+		this.clock.offset, this.clock.uncertainty())
+
+	return nil
+}
+
+// Start the benchmark at the given time of the primary clock.
+//
+func (this *remoteSecondary) start(duration float64, at time.Time) error {
 	return this.conn.sendStart(&msgStart{
 		duration: duration,
+		startTime: this.clock.toSecondary(at).UnixNano(),
 	})
 }
 
 func (this *remoteSecondary) collect() (*SecondaryResult, error) {
 	var msgIact *msgResultInteraction
+	var msgLoop *msgResultLoop
 	var result *SecondaryResult
 	var client *remoteClient
+	var kind *interactionKind
+	var steps []*StepResult
+	var step *msgResultStep
 	var msg msgResult
 	var err error
 	var ok bool
+	var i int
 
 	result = newSecondaryResult(this.addr(), this.params.tags)
 
+	if this.clock != nil {
+		result.ClockOffset = this.clock.offset.Seconds()
+		result.ClockUncertainty = this.clock.uncertainty().Seconds()
+		result.RoundTripTime = this.clock.roundTrip.Seconds()
+	}
+
 	for {
 		Tracef("pull next result from %s", this.addr())
 		msg, err = this.conn.pullResult()
@@ -304,10 +452,60 @@ func (this *remoteSecondary) collect() (*SecondaryResult, error) {
 					msgIact.index, this.addr())
 			}
 
-			result.addResult(msgIact.index, client.kind,
-				client.kinds[msgIact.ikind],
+			kind = client.kinds[msgIact.ikind].kind
+
+			if len(msgIact.steps) != len(kind.steps) {
+				return nil, fmt.Errorf("invalid number of " +
+					"steps %d for client %d on " +
+					"secondary %s", len(msgIact.steps),
+					msgIact.index, this.addr())
+			}
+
+			steps = nil
+			if kind.steps != nil {
+				steps = make([]*StepResult, len(kind.steps))
+				for i, step = range msgIact.steps {
+					steps[i] = newStepResult(kind.steps[i],
+						step.submitTime,
+						step.commitTime,
+						step.abortTime,
+						step.hasError)
+				}
+			}
+
+			result.addResult(msgIact.index, client.kind, kind,
+				client.kinds[msgIact.ikind].properties,
+				msgIact.schedTime, msgIact.dequeueTime,
 				msgIact.submitTime, msgIact.commitTime,
-				msgIact.abortTime, msgIact.hasError)
+				msgIact.abortTime, msgIact.hasError, steps)
+
+			continue
+		}
+
+		msgLoop, ok = msg.(*msgResultLoop)
+		if ok {
+			if msgLoop.index >= len(this.clients) {
+				return nil, fmt.Errorf("invalid client id " +
+					"%d for secondary %s", msgLoop.index,
+					this.addr())
+			}
+
+			client = this.clients[msgLoop.index]
+
+			if (msgLoop.loop < 1) || (msgLoop.loop > client.loops) {
+				return nil, fmt.Errorf("invalid loop %d for " +
+					"client %d on secondary %s",
+					msgLoop.loop, msgLoop.index,
+					this.addr())
+			}
+
+			Warnf("closed loop %d of client %d on %s ran out of " +
+				"interactions at %.3f seconds", msgLoop.loop,
+				msgLoop.index, this.addr(),
+				msgLoop.exhaustTime)
+
+			result.addExhaustedLoop(msgLoop.index, client.kind,
+				msgLoop.loop, msgLoop.exhaustTime)
 
 			continue
 		}
@@ -350,48 +548,107 @@ type remoteClient struct {
 	index    int
 	kind     string
 	maxTime  float64
-	kinds    []string
+	loops    int
+	kinds    []*remoteInteractionKind
 	ikinds   map[string]int
 }
 
+// Interactions with the same kind and the same properties share the same
+// kind index so their properties are never sent to the secondary.
+//
+type remoteInteractionKind struct {
+	kind        *interactionKind
+	properties  map[string]int
+}
+
 func newRemoteClient(conn *secondaryConn, index int, kind string) *remoteClient {
 	return &remoteClient{
 		conn: conn,
 		index: index,
 		kind: kind,
 		maxTime: 0,
-		kinds: make([]string, 0),
+		loops: 0,
+		kinds: make([]*remoteInteractionKind, 0),
 		ikinds: make(map[string]int, 0),
 	}
 }
 
-func (this *remoteClient) sendInteraction(kind string, time float64, encoded []byte) error {
+func (this *remoteClient) sendInteraction(loop int, kind *interactionKind, properties map[string]int, time float64, encoded []byte) error {
+	var names []string
+	var key, name string
 	var ikind int
 	var ok bool
 
-	if time > this.maxTime {
+	if (loop == 0) && (time > this.maxTime) {
 		this.maxTime = time
 	}
 
-	ikind, ok = this.ikinds[kind]
+	key = fmt.Sprintf("%s %q %s", kind.name, kind.label, kind.itype)
+
+	if len(properties) > 0 {
+		names = make([]string, 0, len(properties))
+		for name = range properties {
+			names = append(names, name)
+		}
+
+		sort.Strings(names)
+
+		for _, name = range names {
+			key += fmt.Sprintf(" %s=%d", name, properties[name])
+		}
+	}
+
+	ikind, ok = this.ikinds[key]
 	if !ok {
 		ikind = len(this.kinds)
-		this.kinds = append(this.kinds, kind)
-		this.ikinds[kind] = ikind
+		this.kinds = append(this.kinds, &remoteInteractionKind{
+			kind: kind,
+			properties: properties,
+		})
+		this.ikinds[key] = ikind
 	}
 
 	Tracef("prepare transaction %d (%s) for time %.3f on client %d " +
-		"secondary %s", ikind, kind, time, this.index,
+		"secondary %s", ikind, kind.name, time, this.index,
 		this.conn.addr())
 
 	return this.conn.sendPrepare(&msgPrepareInteraction{
 		index: this.index,
+		loop: loop,
 		ikind: ikind,
 		time: time,
+		sequence: (kind.steps != nil),
 		payload: encoded,
 	})
 }
 
+func (this *remoteClient) createLoop(outstanding int, duration float64) (int, error) {
+	var err error
+
+	this.loops += 1
+
+	if duration > this.maxTime {
+		this.maxTime = duration
+	}
+
+	Tracef("prepare closed loop %d (%d outstanding) on client %d " +
+		"secondary %s", this.loops, outstanding, this.index,
+		this.conn.addr())
+
+	err = this.conn.sendPrepare(&msgPrepareLoop{
+		index: this.index,
+		loop: this.loops,
+		outstanding: outstanding,
+		duration: duration,
+	})
+
+	if err != nil {
+		return 0, err
+	}
+
+	return this.loops, nil
+}
+
 func (this *remoteClient) end() float64 {
 	return this.maxTime
 }
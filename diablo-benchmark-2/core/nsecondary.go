@@ -2,6 +2,7 @@ package core
 
 
 import (
+	"crypto/tls"
 	"fmt"
 	"net"
 	"sort"
@@ -16,28 +17,42 @@ const (
 
 
 type Nsecondary struct {
+	primaryAddr  string
 	connectAddr  string
 	env          []string
 	tags         []string
 	systemMap    map[string]BlockchainInterface
+	security     *Security
 }
 
-func NewNsecondary(primaryAddr string, primaryPort int, env, tags []string, systemMap map[string]BlockchainInterface) *Nsecondary {
+func NewNsecondary(primaryAddr string, primaryPort int, env, tags []string, systemMap map[string]BlockchainInterface, security *Security) *Nsecondary {
 	var addr string = fmt.Sprintf("%s:%d", primaryAddr, primaryPort)
 
+	if security == nil {
+		security = &Security{}
+	}
+
 	return &Nsecondary{
+		primaryAddr: primaryAddr,
 		connectAddr: addr,
 		env: env,
 		tags: tags,
 		systemMap: systemMap,
+		security: security,
 	}
 }
 
 func (this *Nsecondary) Run() error {
+	var config *tls.Config
 	var conn net.Conn
 	var rt *runtime
 	var err error
 
+	config, err = this.security.clientConfig(this.primaryAddr)
+	if err != nil {
+		return err
+	}
+
 	Debugf("connect to primary on tcp address: %s", this.connectAddr)
 	conn, err = net.Dial("tcp", this.connectAddr)
 	if err != nil {
@@ -48,7 +63,13 @@ func (this *Nsecondary) Run() error {
 			conn.RemoteAddr().String())
 	}
 
-	rt, err = newRuntime(conn, this.env, this.tags, this.systemMap)
+	if config != nil {
+		Debugf("use tls with primary")
+		conn = tls.Client(conn, config)
+	}
+
+	rt, err = newRuntime(conn, this.env, this.tags, this.security.Token,
+		this.systemMap)
 	if err != nil {
 		return err
 	} else {
@@ -78,12 +99,14 @@ type runtime struct {
 	start          time.Time
 	lastSkewWarn   time.Time
 	interactions   []*runtimeInteraction
+	loops          []*runtimeLoop
+	pool           *runtimePool
 
 	lock           sync.Mutex
 	lastDelayWarn  time.Time
 }
 
-func newRuntime(conn net.Conn, env, tags []string, systemMap map[string]BlockchainInterface) (*runtime, error) {
+func newRuntime(conn net.Conn, env, tags []string, token string, systemMap map[string]BlockchainInterface) (*runtime, error) {
 	var this runtime
 	var err error
 	var ok bool
@@ -93,6 +116,7 @@ func newRuntime(conn net.Conn, env, tags []string, systemMap map[string]Blockcha
 
 	this.params, err = this.conn.init(&msgSecondaryParameters{
 		tags: tags,
+		token: token,
 	})
 
 	if err != nil {
@@ -107,8 +131,21 @@ func newRuntime(conn net.Conn, env, tags []string, systemMap map[string]Blockcha
 
 	Debugf("use interface '%s'", this.params.sysname)
 
+	if this.params.maxInflight > 0 {
+		Debugf("trigger at most %d interactions at once",
+			this.params.maxInflight)
+	}
+
+	if this.params.maxClientInflight > 0 {
+		Debugf("trigger at most %d interactions at once per client",
+			this.params.maxClientInflight)
+	}
+
+	this.pool = newRuntimePool(this.params.maxInflight)
+
 	this.clients = make(map[int]*runtimeClient, 0)
 	this.interactions = make([]*runtimeInteraction, 0)
+	this.loops = make([]*runtimeLoop, 0)
 
 	return &this, nil
 }
@@ -116,6 +153,8 @@ func newRuntime(conn net.Conn, env, tags []string, systemMap map[string]Blockcha
 func (this *runtime) run() error {
 	var interaction *runtimeInteraction
 	var now, nextTime, delta float64
+	var loops sync.WaitGroup
+	var loop *runtimeLoop
 	var msg *msgStart
 	var err error
 
@@ -137,12 +176,30 @@ func (this *runtime) run() error {
 		return err
 	}
 
-	Infof("run benchmark for %.3f seconds", msg.duration)
+	// The start time is given with the wall clock of this secondary.
+	// Derive it from `time.Now()` so it keeps a monotonic clock reading
+	// and the benchmark times do not jump with wall clock adjustments.
 	this.start = time.Now()
+	this.start = this.start.Add(time.Unix(0, msg.startTime).Sub(this.start))
+
+	delta = time.Since(this.start).Seconds()
+	if delta < 0 {
+		Debugf("wait %.3f seconds for start time", -delta)
+		time.Sleep(time.Until(this.start))
+	} else if delta >= this.params.maxSkew {
+		Warnf("start %.3f seconds late", delta)
+	}
+
+	Infof("run benchmark for %.3f seconds", msg.duration)
 	this.lastSkewWarn = this.start
 	this.lastDelayWarn = this.start
 	now = time.Now().Sub(this.start).Seconds()
 
+	for _, loop = range this.loops {
+		loops.Add(1)
+		go loop.run(&loops)
+	}
+
 	for _, interaction = range this.interactions {
 		nextTime = interaction.schedTime
 		delta = nextTime - now
@@ -155,79 +212,69 @@ func (this *runtime) run() error {
 
 		now = time.Now().Sub(this.start).Seconds()
 
-		go interaction.trigger()
+		this.pool.dispatch(interaction)
 	}
 
+	Tracef("wait for closed loops")
+	loops.Wait()
+
 	Infof("stop benchmark")
 	return this.stop()
 }
 
 func (this *runtime) stop() error {
+	var interactions []*runtimeInteraction
 	var interaction *runtimeInteraction
 	var msg msgResultInteraction
-	var elapsed time.Duration
+	var loop *runtimeLoop
 	var err error
 	var i, n int
 
-	n = len(this.interactions)
+	interactions = this.interactions
+	for _, loop = range this.loops {
+		interactions = append(interactions, loop.triggered()...)
+	}
+
+	n = len(interactions)
 
 	Debugf("send %d results to primary", n)
 
-	for i, interaction = range this.interactions {
+	for i, interaction = range interactions {
 		msg.index = interaction.client.id
 		msg.ikind = interaction.ikind
 
-		interaction.lock.Lock()
-
-		if interaction.submitted {
-			elapsed = interaction.submitTime.Sub(this.start)
-			msg.submitTime = elapsed.Seconds()
-		} else {
-			msg.submitTime = -1
-		}
+		interaction.report(&msg)
 
-		if interaction.committed {
-			elapsed = interaction.commitTime.Sub(this.start)
-			msg.commitTime = elapsed.Seconds()
-		} else {
-			msg.commitTime = -1
-		}
-
-		if interaction.aborted {
-			elapsed = interaction.abortTime.Sub(this.start)
-			msg.abortTime = elapsed.Seconds()
-		} else {
-			msg.abortTime = -1
+		Tracef("push result %d/%d", i + 1, n)
+		err = this.conn.pushResult(&msg)
+		if err != nil {
+			return err
 		}
+	}
 
-		if interaction.done {
-			msg.hasError = (interaction.err != nil)
-		} else {
-			msg.hasError = false
+	for _, loop = range this.loops {
+		if loop.exhaustTime < 0 {
+			continue
 		}
 
-		interaction.lock.Unlock()
-
-		Tracef("push result %d/%d", i + 1, n)
-		err = this.conn.pushResult(&msg)
+		err = this.conn.pushResult(&msgResultLoop{
+			index: loop.client.id,
+			loop: loop.index,
+			exhaustTime: loop.exhaustTime,
+		})
 		if err != nil {
 			return err
 		}
 	}
-	
-	return this.conn.pushResult(&msgResultDone{})
-}
 
-type decodeResult struct {
-	decoded  *runtimeInteraction
-	err      error
+	return this.conn.pushResult(&msgResultDone{})
 }
 
 func (this *runtime) prepare() error {
 	var msgInteraction *msgPrepareInteraction
-	var decodeChannel chan *decodeResult
 	var msgClient *msgPrepareClient
-	var decodeRes *decodeResult
+	var msgLoop *msgPrepareLoop
+	var decodeChannel chan error
 	var numDecoded int
 	var msg msgPrepare
 	var err error
@@ -236,7 +283,7 @@ func (this *runtime) prepare() error {
 	Debugf("prepare runtime")
 
 	numDecoded = 0
-	decodeChannel = make(chan *decodeResult)
+	decodeChannel = make(chan error)
 	defer close(decodeChannel)
 
 	for {
@@ -261,6 +308,16 @@ func (this *runtime) prepare() error {
 			continue
 		}
 
+		msgLoop, ok = msg.(*msgPrepareLoop)
+		if ok {
+			err = this.prepareLoop(msgLoop)
+			if err != nil {
+				return err
+			}
+
+			continue
+		}
+
 		msgInteraction, ok = msg.(*msgPrepareInteraction)
 		if ok {
 			err = this.prepareInteraction(msgInteraction,
@@ -279,15 +336,12 @@ func (this *runtime) prepare() error {
 	}
 
 	for numDecoded > 0 {
-		decodeRes = <- decodeChannel
+		err = <- decodeChannel
 
-		if decodeRes.err != nil {
-			return decodeRes.err
+		if err != nil {
+			return err
 		}
 
-		this.interactions = append(this.interactions,
-			decodeRes.decoded)
-
 		numDecoded -= 1
 	}
 
@@ -316,9 +370,47 @@ func (this *runtime) prepareClient(msg *msgPrepareClient) error {
 	return nil
 }
 
-func (this *runtime) prepareInteraction(msg *msgPrepareInteraction, decodeChannel chan<- *decodeResult) error {
-	var decoded *runtimeInteraction
+func (this *runtime) prepareLoop(msg *msgPrepareLoop) error {
 	var client *runtimeClient
+	var loop *runtimeLoop
+	var ok bool
+
+	Tracef("create closed loop %d on client %d", msg.loop, msg.index)
+
+	client, ok = this.clients[msg.index]
+	if !ok {
+		return fmt.Errorf("invalid client index %d", msg.index)
+	}
+
+	_, ok = client.loops[msg.loop]
+	if ok || (msg.loop == 0) {
+		return fmt.Errorf("invalid loop index %d for client %d",
+			msg.loop, msg.index)
+	}
+
+	if msg.outstanding <= 0 {
+		return fmt.Errorf("invalid number of outstanding " +
+			"interactions %d for client %d", msg.outstanding,
+			msg.index)
+	}
+
+	loop = newRuntimeLoop(client, msg.loop, msg.outstanding, msg.duration)
+
+	client.loops[msg.loop] = loop
+	this.loops = append(this.loops, loop)
+
+	return nil
+}
+
+// Create the interaction described by `msg` and decode its payload in the
+// background.
+// The interaction is added to the runtime now so interactions of a same
+// closed loop keep the order in which the primary sent them.
+//
+func (this *runtime) prepareInteraction(msg *msgPrepareInteraction, decodeChannel chan<- error) error {
+	var interaction *runtimeInteraction
+	var client *runtimeClient
+	var loop *runtimeLoop
 	var err error
 	var ok bool
 
@@ -330,24 +422,81 @@ func (this *runtime) prepareInteraction(msg *msgPrepareInteraction, decodeChanne
 		return fmt.Errorf("invalid client index %d", msg.index)
 	}
 
-	go func() {
-		decoded, err = decodeInteraction(client, msg)
-		decodeChannel <- &decodeResult{ decoded, err }
-	}()
+	loop = nil
+	if msg.loop != 0 {
+		loop, ok = client.loops[msg.loop]
+		if !ok {
+			return fmt.Errorf("invalid loop index %d for " +
+				"client %d", msg.loop, msg.index)
+		}
+	}
+
+	interaction = newRuntimeInteraction(msg.time, client, msg.ikind, nil)
+
+	if msg.sequence {
+		err = this.prepareSequence(msg, interaction, decodeChannel)
+		if err != nil {
+			return err
+		}
+	} else {
+		go func() {
+			var opaque interface{}
+			var err error
+
+			opaque, err = client.decode(msg.payload)
+			interaction.opaque = opaque
+
+			decodeChannel <- err
+		}()
+	}
+
+	if loop == nil {
+		this.interactions = append(this.interactions, interaction)
+	} else {
+		loop.pool = append(loop.pool, interaction)
+	}
 
 	return nil
 }
 
-func decodeInteraction(client *runtimeClient, msg *msgPrepareInteraction) (*runtimeInteraction, error) {
-	var opaque interface{}
+// Unpack the steps of the sequence `interaction` and decode them in the
+// background.
+// The payloads of all the steps are decoded before the sequence is reported
+// on `decodeChannel`.
+//
+func (this *runtime) prepareSequence(msg *msgPrepareInteraction, interaction *runtimeInteraction, decodeChannel chan<- error) error {
+	var payloads [][]byte
 	var err error
+	var i int
 
-	opaque, err = client.decode(msg.payload)
+	payloads, err = decodeSequencePayload(msg.payload)
 	if err != nil {
-		return nil, err
+		return fmt.Errorf("invalid sequence for client %d: %s",
+			msg.index, err.Error())
 	}
 
-	return newRuntimeInteraction(msg.time, client, msg.ikind, opaque), nil
+	interaction.steps = make([]*runtimeInteraction, len(payloads))
+	for i = range payloads {
+		interaction.steps[i] = newRuntimeInteraction(msg.time,
+			interaction.client, msg.ikind, nil)
+	}
+
+	go func() {
+		var step *runtimeInteraction
+		var err error
+		var i int
+
+		for i, step = range interaction.steps {
+			step.opaque, err = interaction.client.decode(payloads[i])
+			if err != nil {
+				break
+			}
+		}
+
+		decodeChannel <- err
+	}()
+
+	return nil
 }
 
 func (this *runtime) warnDelay(iact *runtimeInteraction, delay float64) {
@@ -389,10 +538,17 @@ func (this *runtime) Close() error {
 
 
 type runtimeClient struct {
-	rt      *runtime
-	id      int
-	logger  Logger
-	inner   BlockchainClient
+	rt       *runtime
+	id       int
+	logger   Logger
+	inner    BlockchainClient
+	loops    map[int]*runtimeLoop
+
+	// Guarded by the lock of the runtime pool.
+	limit    int                    // 0 for no limit
+	running  int
+	ready    bool
+	queue    []*runtimeInteraction
 }
 
 func newRuntimeClient(runtime *runtime, id int, logger Logger, inner BlockchainClient) *runtimeClient {
@@ -401,6 +557,11 @@ func newRuntimeClient(runtime *runtime, id int, logger Logger, inner BlockchainC
 		id: id,
 		logger: logger,
 		inner: inner,
+		loops: make(map[int]*runtimeLoop),
+		limit: runtime.params.maxClientInflight,
+		running: 0,
+		ready: false,
+		queue: make([]*runtimeInteraction, 0),
 	}
 }
 
@@ -424,14 +585,19 @@ type runtimeInteraction struct {
 	opaque       interface{}
 
 	lock         sync.Mutex
+	started      bool           // triggered by a closed loop
+	dequeued     bool
 	submitted    bool
 	committed    bool
 	aborted      bool
 	done         bool
+	dequeueTime  time.Time
 	submitTime   time.Time
 	commitTime   time.Time
 	abortTime    time.Time
 	err          error
+	finished     chan struct{}  // closed once committed or aborted
+	steps        []*runtimeInteraction  // nil if not a sequence
 }
 
 func newRuntimeInteraction(schedTime float64, client *runtimeClient, ikind int, opaque interface{}) *runtimeInteraction {
@@ -441,17 +607,36 @@ func newRuntimeInteraction(schedTime float64, client *runtimeClient, ikind int,
 	this.ikind = ikind
 	this.schedTime = schedTime
 	this.opaque = opaque
+	this.dequeued = false
 	this.submitted = false
 	this.committed = false
 	this.aborted = false
 	this.done = false
+	this.finished = make(chan struct{})
 
 	return &this
 }
 
+// Record that a worker of the runtime pool starts to trigger this
+// interaction.
+//
+func (this *runtimeInteraction) dequeue() {
+	var dequeueTime time.Time = time.Now()
+
+	this.lock.Lock()
+	this.dequeueTime = dequeueTime
+	this.dequeued = true
+	this.lock.Unlock()
+}
+
 func (this *runtimeInteraction) trigger() {
 	var err error
 
+	if this.steps != nil {
+		this.triggerSequence()
+		return
+	}
+
 	err = this.client.trigger(this)
 
 	this.lock.Lock()
@@ -459,6 +644,10 @@ func (this *runtimeInteraction) trigger() {
 	this.err = err
 	this.done = true
 
+	if err != nil {
+		this.finish()
+	}
+
 	this.lock.Unlock()
 
 	if err != nil {
@@ -466,6 +655,144 @@ func (this *runtimeInteraction) trigger() {
 	}
 }
 
+// Trigger the steps of a sequence one after the other.
+// Each step is scheduled as soon as the previous one commits and the
+// sequence stops at the first step which aborts or fails.
+//
+func (this *runtimeInteraction) triggerSequence() {
+	var rt *runtime = this.runtime()
+	var step *runtimeInteraction
+	var committed bool
+	var i int
+
+	for i, step = range this.steps {
+		if i > 0 {
+			step.lock.Lock()
+			step.schedTime = time.Now().Sub(rt.start).Seconds()
+			step.lock.Unlock()
+		}
+
+		step.trigger()
+
+		<- step.finished
+
+		step.lock.Lock()
+		committed = step.committed
+		step.lock.Unlock()
+
+		if !committed {
+			break
+		}
+	}
+
+	this.lock.Lock()
+	this.done = true
+	this.finish()
+	this.lock.Unlock()
+}
+
+// Fill the times and error status of `msg` with the ones of this interaction
+// relative to the start of the benchmark.
+// A sequence is submitted when its first step is, commits when its last step
+// does and aborts or fails when any of its steps does.
+//
+func (this *runtimeInteraction) report(msg *msgResultInteraction) {
+	var start time.Time = this.runtime().start
+	var step *runtimeInteraction
+	var smsg *msgResultStep
+	var i int
+
+	msg.steps = nil
+
+	this.lock.Lock()
+	msg.schedTime = this.schedTime
+	msg.dequeueTime = -1
+	if this.dequeued {
+		msg.dequeueTime = this.dequeueTime.Sub(start).Seconds()
+	}
+	this.lock.Unlock()
+
+	if this.steps == nil {
+		this.lock.Lock()
+		msg.submitTime, msg.commitTime, msg.abortTime, msg.hasError =
+			this.times()
+		this.lock.Unlock()
+		return
+	}
+
+	msg.steps = make([]*msgResultStep, len(this.steps))
+	msg.submitTime = -1
+	msg.commitTime = -1
+	msg.abortTime = -1
+	msg.hasError = false
+
+	for i, step = range this.steps {
+		smsg = &msgResultStep{}
+
+		step.lock.Lock()
+		smsg.submitTime, smsg.commitTime, smsg.abortTime,
+			smsg.hasError = step.times()
+		step.lock.Unlock()
+
+		msg.steps[i] = smsg
+
+		if (msg.abortTime < 0) && (smsg.abortTime >= 0) {
+			msg.abortTime = smsg.abortTime
+		}
+
+		if smsg.hasError {
+			msg.hasError = true
+		}
+	}
+
+	msg.submitTime = msg.steps[0].submitTime
+	msg.commitTime = msg.steps[len(msg.steps) - 1].commitTime
+}
+
+// Return the submit, commit and abort times of this interaction, negative if
+// they did not happen, and if the interaction failed.
+// Must be called with the lock held.
+//
+func (this *runtimeInteraction) times() (float64, float64, float64, bool) {
+	var submitTime, commitTime, abortTime float64
+	var start time.Time = this.runtime().start
+	var hasError bool
+
+	submitTime = -1
+	commitTime = -1
+	abortTime = -1
+	hasError = false
+
+	if this.submitted {
+		submitTime = this.submitTime.Sub(start).Seconds()
+	}
+
+	if this.committed {
+		commitTime = this.commitTime.Sub(start).Seconds()
+	}
+
+	if this.aborted {
+		abortTime = this.abortTime.Sub(start).Seconds()
+	}
+
+	if this.done {
+		hasError = (this.err != nil)
+	}
+
+	return submitTime, commitTime, abortTime, hasError
+}
+
+// Signal the closed loop, if any, that this interaction is complete.
+// Must be called with the lock held.
+//
+func (this *runtimeInteraction) finish() {
+	select {
+	case <- this.finished:
+	default:
+		close(this.finished)
+	}
+}
+
 func (this *runtimeInteraction) runtime() *runtime {
 	return this.client.runtime()
 }
@@ -513,6 +840,7 @@ func (this *runtimeInteraction) ReportCommit() {
 
 	this.commitTime = time.Now()
 	this.committed = true
+	this.finish()
 
 	this.lock.Unlock()
 }
@@ -528,6 +856,160 @@ func (this *runtimeInteraction) ReportAbort() {
 
 	this.abortTime = time.Now()
 	this.aborted = true
+	this.finish()
 
 	this.lock.Unlock()
 }
+
+
+// Keep a fixed number of interactions in flight on a client.
+// Each worker of the loop triggers the next interaction of the pool, waits
+// for it to commit or abort, then waits for the think time of the next
+// interaction and starts again until the end of the loop.
+//
+type runtimeLoop struct {
+	client       *runtimeClient
+	index        int
+	outstanding  int
+	duration     float64
+	pool         []*runtimeInteraction
+
+	lock         sync.Mutex
+	next         int
+	exhaustTime  float64  // negative if the pool lasted the whole loop
+}
+
+func newRuntimeLoop(client *runtimeClient, index, outstanding int, duration float64) *runtimeLoop {
+	return &runtimeLoop{
+		client: client,
+		index: index,
+		outstanding: outstanding,
+		duration: duration,
+		pool: make([]*runtimeInteraction, 0),
+		next: 0,
+		exhaustTime: -1,
+	}
+}
+
+func (this *runtimeLoop) run(wg *sync.WaitGroup) {
+	var workers sync.WaitGroup
+	var i int
+
+	defer wg.Done()
+
+	for i = 0; i < this.outstanding; i++ {
+		workers.Add(1)
+		go this.work(&workers)
+	}
+
+	workers.Wait()
+}
+
+func (this *runtimeLoop) work(wg *sync.WaitGroup) {
+	var interaction *runtimeInteraction
+	var rt *runtime = this.client.runtime()
+	var deadline time.Time
+	var timer *time.Timer
+	var now float64
+
+	defer wg.Done()
+
+	deadline = rt.start.Add(time.Duration(this.duration *
+		float64(time.Second)))
+
+	timer = time.NewTimer(time.Until(deadline))
+	defer timer.Stop()
+
+	for {
+		interaction = this.take()
+		if interaction == nil {
+			return
+		}
+
+		if interaction.schedTime > 0 {
+			select {
+			case <- time.After(time.Duration(interaction.schedTime *
+				float64(time.Second))):
+			case <- timer.C:
+				return
+			}
+		}
+
+		now = time.Now().Sub(rt.start).Seconds()
+		if now >= this.duration {
+			return
+		}
+
+		interaction.lock.Lock()
+		interaction.schedTime = now
+		interaction.started = true
+		interaction.lock.Unlock()
+
+		rt.pool.dispatch(interaction)
+
+		select {
+		case <- interaction.finished:
+		case <- timer.C:
+			return
+		}
+	}
+}
+
+// Return the next interaction of the pool or nil if the pool is exhausted.
+// The first time the pool is exhausted before the end of the loop, record
+// when so the primary knows the loop stopped early.
+//
+func (this *runtimeLoop) take() *runtimeInteraction {
+	var rt *runtime = this.client.runtime()
+	var ret *runtimeInteraction
+	var now float64
+
+	this.lock.Lock()
+	defer this.lock.Unlock()
+
+	if this.next >= len(this.pool) {
+		if this.next == len(this.pool) {
+			this.next += 1
+
+			now = time.Now().Sub(rt.start).Seconds()
+			if now < this.duration {
+				Warnf("closed loop %d of client %d exhausted " +
+					"its %d interactions at %.3f seconds",
+					this.index, this.client.id,
+					len(this.pool), now)
+				this.exhaustTime = now
+			}
+		}
+
+		return nil
+	}
+
+	ret = this.pool[this.next]
+	this.next += 1
+
+	return ret
+}
+
+// Return the interactions which have been triggered.
+//
+func (this *runtimeLoop) triggered() []*runtimeInteraction {
+	var ret []*runtimeInteraction
+	var interaction *runtimeInteraction
+
+	this.lock.Lock()
+	defer this.lock.Unlock()
+
+	ret = make([]*runtimeInteraction, 0, this.next)
+
+	for _, interaction = range this.pool {
+		interaction.lock.Lock()
+
+		if interaction.started {
+			ret = append(ret, interaction)
+		}
+
+		interaction.lock.Unlock()
+	}
+
+	return ret
+}
@@ -0,0 +1,309 @@
+package core
+
+
+import (
+	"bufio"
+	"bytes"
+	"net"
+	"sync"
+	"testing"
+	"time"
+)
+
+
+// A blockchain client committing every interaction after a fixed latency and
+// recording the maximum number of interactions in flight.
+//
+type testLatencyClient struct {
+	latency  time.Duration
+	lock     sync.Mutex
+	current  int
+	max      int
+}
+
+func (this *testLatencyClient) DecodePayload(bytes []byte) (interface{}, error) {
+	return nil, nil
+}
+
+func (this *testLatencyClient) TriggerInteraction(iact Interaction) error {
+	this.lock.Lock()
+	this.current += 1
+	if this.current > this.max {
+		this.max = this.current
+	}
+	this.lock.Unlock()
+
+	iact.ReportSubmit()
+
+	time.Sleep(this.latency)
+
+	this.lock.Lock()
+	this.current -= 1
+	this.lock.Unlock()
+
+	iact.ReportCommit()
+
+	return nil
+}
+
+
+func TestClosedLoopOutstanding(t *testing.T) {
+	var inner *testLatencyClient = &testLatencyClient{
+		latency: 20 * time.Millisecond,
+	}
+	var interaction *runtimeInteraction
+	var triggered []*runtimeInteraction
+	var client *runtimeClient
+	var wg sync.WaitGroup
+	var loop *runtimeLoop
+	var rt runtime
+	var i int
+
+	rt.params = &msgPrimaryParameters{ maxDelay: 10, maxSkew: 10 }
+	rt.pool = newRuntimePool(0)
+	client = newRuntimeClient(&rt, 0, nil, inner)
+	loop = newRuntimeLoop(client, 1, 4, 0.5)
+
+	for i = 0; i < 1000; i++ {
+		loop.pool = append(loop.pool,
+			newRuntimeInteraction(0, client, 0, nil))
+	}
+
+	rt.start = time.Now()
+	wg.Add(1)
+	loop.run(&wg)
+
+	if time.Since(rt.start) > time.Second {
+		t.Fatalf("loop ran for %s", time.Since(rt.start))
+	}
+
+	if inner.max != 4 {
+		t.Fatalf("got %d interactions in flight, expected 4",
+			inner.max)
+	}
+
+	triggered = loop.triggered()
+
+	// About 4 * 0.5 / 0.02 = 100 interactions.
+	if (len(triggered) < 50) || (len(triggered) > 100) {
+		t.Fatalf("got %d triggered interactions", len(triggered))
+	}
+
+	for _, interaction = range triggered {
+		if !interaction.submitted {
+			t.Fatalf("triggered interaction not submitted")
+		}
+	}
+
+	if loop.exhaustTime >= 0 {
+		t.Fatalf("loop exhausted at %f", loop.exhaustTime)
+	}
+}
+
+func TestClosedLoopExhausted(t *testing.T) {
+	var inner *testLatencyClient = &testLatencyClient{
+		latency: time.Millisecond,
+	}
+	var client *runtimeClient
+	var wg sync.WaitGroup
+	var loop *runtimeLoop
+	var rt runtime
+	var i int
+
+	rt.params = &msgPrimaryParameters{ maxDelay: 10, maxSkew: 10 }
+	rt.pool = newRuntimePool(0)
+	client = newRuntimeClient(&rt, 0, nil, inner)
+	loop = newRuntimeLoop(client, 1, 2, 10)
+
+	for i = 0; i < 5; i++ {
+		loop.pool = append(loop.pool,
+			newRuntimeInteraction(0.01, client, 0, nil))
+	}
+
+	rt.start = time.Now()
+	wg.Add(1)
+	loop.run(&wg)
+
+	if time.Since(rt.start) > time.Second {
+		t.Fatalf("loop ran for %s", time.Since(rt.start))
+	}
+
+	if len(loop.triggered()) != 5 {
+		t.Fatalf("got %d triggered interactions, expected 5",
+			len(loop.triggered()))
+	}
+
+	if (loop.exhaustTime < 0.01) || (loop.exhaustTime > 1) {
+		t.Fatalf("loop exhausted at %f", loop.exhaustTime)
+	}
+}
+
+func TestEncodePrepareLoop(t *testing.T) {
+	var buf bytes.Buffer
+	var loop *msgPrepareLoop
+	var iact *msgPrepareInteraction
+	var msg msgPrepare
+	var err error
+	var ok bool
+
+	err = (&msgPrepareLoop{
+		index: 3, loop: 2, outstanding: 16, duration: 60.5,
+	}).encode(&buf)
+	if err != nil {
+		t.Fatalf("encode: %s", err.Error())
+	}
+
+	err = (&msgPrepareInteraction{
+		index: 3, loop: 2, ikind: 1, time: 0.25, payload: []byte("x"),
+	}).encode(&buf)
+	if err != nil {
+		t.Fatalf("encode: %s", err.Error())
+	}
+
+	msg, err = decodeMsgPrepare(&buf)
+	if err != nil {
+		t.Fatalf("decode: %s", err.Error())
+	}
+
+	loop, ok = msg.(*msgPrepareLoop)
+	if !ok || (*loop != msgPrepareLoop{ 3, 2, 16, 60.5 }) {
+		t.Fatalf("decode: got %v", msg)
+	}
+
+	msg, err = decodeMsgPrepare(&buf)
+	if err != nil {
+		t.Fatalf("decode: %s", err.Error())
+	}
+
+	iact, ok = msg.(*msgPrepareInteraction)
+	if !ok || (iact.loop != 2) || (iact.time != 0.25) ||
+		(string(iact.payload) != "x") {
+		t.Fatalf("decode: got %v", msg)
+	}
+}
+
+// Send an open loop and a closed loop sequence to a runtime through
+// `prepare()`, run them and check both are reported with their steps.
+//
+func TestPrepareSequence(t *testing.T) {
+	var inner *testLatencyClient = &testLatencyClient{
+		latency: time.Millisecond,
+	}
+	var primarySide, secondarySide net.Conn
+	var result *msgResultInteraction
+	var client *runtimeClient
+	var reader *bufio.Reader
+	var prepares []msgPrepare
+	var wg sync.WaitGroup
+	var loop *runtimeLoop
+	var step *msgResultStep
+	var payload []byte
+	var msg msgResult
+	var rt runtime
+	var err error
+	var ok bool
+	var n int
+
+	primarySide, secondarySide = net.Pipe()
+	defer primarySide.Close()
+	defer secondarySide.Close()
+
+	rt.conn = newPrimaryConn(secondarySide)
+	rt.params = &msgPrimaryParameters{ maxDelay: 10, maxSkew: 10 }
+	rt.pool = newRuntimePool(0)
+	rt.interactions = make([]*runtimeInteraction, 0)
+	rt.clients = make(map[int]*runtimeClient)
+	client = newRuntimeClient(&rt, 0, nil, inner)
+	rt.clients[0] = client
+	loop = newRuntimeLoop(client, 1, 1, 0.1)
+	client.loops[1] = loop
+	rt.loops = []*runtimeLoop{ loop }
+
+	payload, err = encodeSequencePayload([][]byte{
+		[]byte("a"), []byte("b"),
+	})
+	if err != nil {
+		t.Fatalf("encode sequence: %s", err.Error())
+	}
+
+	prepares = []msgPrepare{
+		&msgPrepareInteraction{ index: 0, loop: 0, ikind: 0,
+			time: 0, sequence: true, payload: payload },
+		&msgPrepareInteraction{ index: 0, loop: 1, ikind: 0,
+			time: 0, sequence: true, payload: payload },
+		&msgPrepareDone{},
+	}
+
+	go func() {
+		var writer *bufio.Writer = bufio.NewWriter(primarySide)
+		var prepare msgPrepare
+
+		for _, prepare = range prepares {
+			prepare.encode(writer)
+		}
+		writer.Flush()
+	}()
+
+	err = rt.prepare()
+	if err != nil {
+		t.Fatalf("prepare: %s", err.Error())
+	}
+
+	if (len(rt.interactions) != 1) || (len(loop.pool) != 1) {
+		t.Fatalf("got %d open loop and %d closed loop interactions",
+			len(rt.interactions), len(loop.pool))
+	}
+
+	rt.start = time.Now()
+
+	rt.pool.dispatch(rt.interactions[0])
+	<- rt.interactions[0].finished
+
+	wg.Add(1)
+	loop.run(&wg)
+
+	go rt.stop()
+
+	reader = bufio.NewReader(primarySide)
+	n = 0
+
+	for {
+		msg, err = decodeMsgResult(reader)
+		if err != nil {
+			t.Fatalf("decode result: %s", err.Error())
+		}
+
+		_, ok = msg.(*msgResultDone)
+		if ok {
+			break
+		}
+
+		// The closed loop runs out of interactions.
+		_, ok = msg.(*msgResultLoop)
+		if ok {
+			continue
+		}
+
+		result, ok = msg.(*msgResultInteraction)
+		if !ok {
+			t.Fatalf("unexpected result %v", msg)
+		}
+
+		if len(result.steps) != 2 {
+			t.Fatalf("sequence reported with %d steps",
+				len(result.steps))
+		}
+
+		for _, step = range result.steps {
+			if (step.submitTime < 0) || (step.commitTime < 0) {
+				t.Fatalf("step not committed")
+			}
+		}
+
+		n += 1
+	}
+
+	if n != 2 {
+		t.Fatalf("got %d sequence results, expected 2", n)
+	}
+}
@@ -0,0 +1,133 @@
+package core
+
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+
+// The names of the phases a benchmark can define, in chronological order.
+// Statistics are computed over the `measure` phase when it is defined.
+//
+var phaseNames []string = []string{ "warmup", "measure", "cooldown" }
+
+
+// Parse the `phases` of a benchmark:
+//
+//   phases:
+//     warmup: "0-30"
+//     measure: "30-270"
+//     cooldown: [ 270, 300 ]
+//
+// Each phase is a time interval in seconds given either as a `"start-end"`
+// string or as a `[ start, end ]` sequence. Phases are optional and cannot
+// overlap.
+//
+func parsePhases(expr BenchmarkExpression) ([]*PhaseResult, error) {
+	var phases []*PhaseResult = make([]*PhaseResult, 0)
+	var fields []BenchmarkExpression
+	var field BenchmarkExpression
+	var phase *PhaseResult
+	var name string
+	var err error
+	var i int
+
+	fields, err = expr.TryMap()
+	if err != nil {
+		return nil, err
+	}
+
+	for _, name = range phaseNames {
+		field, err = expr.TryField(name)
+		if err != nil {
+			continue
+		}
+
+		phase, err = parsePhase(name, field)
+		if err != nil {
+			return nil, err
+		}
+
+		for i = range phases {
+			if (phase.Start < phases[i].End) &&
+				(phases[i].Start < phase.End) {
+				return nil, fmt.Errorf("%s: phase '%s' " +
+					"overlaps phase '%s'",
+					field.FullPosition(), name,
+					phases[i].Name)
+			}
+		}
+
+		phases = append(phases, phase)
+	}
+
+	if len(phases) != len(fields) {
+		return nil, fmt.Errorf("%s: unknown phase (must be one of %s)",
+			expr.FullPosition(), strings.Join(phaseNames, ", "))
+	}
+
+	return phases, nil
+}
+
+func parsePhase(name string, expr BenchmarkExpression) (*PhaseResult, error) {
+	var items []BenchmarkExpression
+	var bounds []string
+	var start, end float64
+	var str string
+	var err error
+
+	items, err = expr.TrySlice()
+	if err == nil {
+		if len(items) != 2 {
+			return nil, fmt.Errorf("%s: must be [ start, end ]",
+				expr.FullPosition())
+		}
+
+		start, err = items[0].GetFloat()
+		if err != nil {
+			return nil, err
+		}
+
+		end, err = items[1].GetFloat()
+		if err != nil {
+			return nil, err
+		}
+	} else {
+		str, err = expr.GetString()
+		if err != nil {
+			return nil, fmt.Errorf("%s: must be \"start-end\" or " +
+				"[ start, end ]", expr.FullPosition())
+		}
+
+		bounds = strings.Split(str, "-")
+		if len(bounds) != 2 {
+			return nil, fmt.Errorf("%s: must be \"start-end\"",
+				expr.FullPosition())
+		}
+
+		start, err = strconv.ParseFloat(strings.TrimSpace(bounds[0]),64)
+		if err == nil {
+			end, err = strconv.ParseFloat(
+				strings.TrimSpace(bounds[1]), 64)
+		}
+
+		if err != nil {
+			return nil, fmt.Errorf("%s: invalid time in '%s'",
+				expr.FullPosition(), str)
+		}
+	}
+
+	if start < 0 {
+		return nil, fmt.Errorf("%s: must start at a positive time",
+			expr.FullPosition())
+	}
+
+	if end <= start {
+		return nil, fmt.Errorf("%s: must end after it starts",
+			expr.FullPosition())
+	}
+
+	return &PhaseResult{ Name: name, Start: start, End: end }, nil
+}
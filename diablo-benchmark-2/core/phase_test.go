@@ -0,0 +1,109 @@
+package core
+
+
+import (
+	"strings"
+	"testing"
+)
+
+
+func TestParsePhases(t *testing.T) {
+	var phases []*PhaseResult
+	var expr BenchmarkExpression
+	var err error
+
+	expr, err = parseTestExpression(newTestSystem(), `
+{ cooldown: [ 270, 300 ], warmup: "0-30", measure: "30 - 270" }
+`)
+	if err != nil {
+		t.Fatalf("parse: %s", err.Error())
+	}
+
+	phases, err = parsePhases(expr)
+	if err != nil {
+		t.Fatalf("phases: %s", err.Error())
+	}
+
+	if (len(phases) != 3) || (phases[0].Name != "warmup") ||
+		(phases[1].Start != 30) || (phases[1].End != 270) ||
+		(phases[2].Name != "cooldown") || (phases[2].End != 300) {
+		t.Fatalf("wrong phases %v %v %v", phases[0], phases[1],
+			phases[2])
+	}
+}
+
+func TestParsePhasesErrors(t *testing.T) {
+	var expr BenchmarkExpression
+	var src, message string
+	var err error
+
+	for src, message = range map[string]string{
+		`{ warmup: "0-30", measure: "20-60" }`: "overlaps",
+		`{ warmup: "0-30", drain: "30-60" }`: "unknown phase",
+		`{ measure: "60-30" }`: "must end after",
+		`{ measure: "a-30" }`: "invalid time",
+		`{ measure: [ 0, 10, 20 ] }`: "[ start, end ]",
+	} {
+		expr, err = parseTestExpression(newTestSystem(), src)
+		if err != nil {
+			t.Fatalf("parse: %s", err.Error())
+		}
+
+		_, err = parsePhases(expr)
+		if (err == nil) || !strings.Contains(err.Error(), message) {
+			t.Fatalf("%s: got error %v, expected '%s'", src, err,
+				message)
+		}
+	}
+}
+
+func TestLabelPhases(t *testing.T) {
+	var result *Result = newResult(0)
+	var kind *interactionKind = &interactionKind{ "test:1:1", "", "transfer",
+		nil }
+	var secondary *SecondaryResult
+	var client *ClientResult
+	var time float64
+
+	result.Phases = []*PhaseResult{
+		&PhaseResult{ Name: "warmup", Start: 0, End: 10 },
+		&PhaseResult{ Name: "measure", Start: 10, End: 20 },
+	}
+
+	secondary = newSecondaryResult("secondary", nil)
+	for _, time = range []float64{ -1, 5, 10, 19.5, 25 } {
+		secondary.addResult(0, "client", kind, nil, time, time, time,
+			-1, -1, false, nil)
+	}
+
+	// Scheduled in the warmup but submitted in the measure phase.
+	secondary.addResult(0, "client", kind, nil, 9, 11, 11, -1, -1, false,
+		nil)
+
+	// Scheduled but never dequeued nor submitted.
+	secondary.addResult(0, "client", kind, nil, 12, -1, -1, -1, -1, false,
+		nil)
+
+	result.addSecondary(secondary)
+	result.labelPhases()
+
+	client = secondary.Clients[0]
+
+	if (client.Interactions[0].Phase != "") ||
+		(client.Interactions[1].Phase != "warmup") ||
+		(client.Interactions[2].Phase != "measure") ||
+		(client.Interactions[3].Phase != "measure") ||
+		(client.Interactions[4].Phase != "") ||
+		(client.Interactions[5].Phase != "warmup") ||
+		(client.Interactions[6].Phase != "measure") {
+		t.Fatalf("wrong phase labels")
+	}
+
+	if result.Phase("measure") != result.Phases[1] {
+		t.Fatalf("wrong measure phase")
+	}
+
+	if result.Phase("cooldown") != nil {
+		t.Fatalf("undefined phase found")
+	}
+}
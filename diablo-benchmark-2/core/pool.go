@@ -0,0 +1,110 @@
+package core
+
+
+import (
+	"sync"
+)
+
+
+// Trigger the interactions of a secondary with a bounded number of workers.
+// An interaction waits in the queue of its client until both its client and
+// the secondary run less interactions than their limit, then a new worker
+// triggers it. A limit of 0 means no limit.
+// The clients with queued interactions are served in turn so a saturated
+// client does not delay the others.
+//
+// A worker is busy as long as the blockchain client triggers the interaction,
+// which for a sequence lasts until its last step commits or aborts.
+//
+type runtimePool struct {
+	lock     sync.Mutex
+	limit    int
+	running  int
+	ready    []*runtimeClient  // can run their next queued interaction
+}
+
+func newRuntimePool(limit int) *runtimePool {
+	return &runtimePool{
+		limit: limit,
+		running: 0,
+		ready: make([]*runtimeClient, 0),
+	}
+}
+
+// Queue the given interaction for its client.
+// Its dequeue time is set when a worker starts to trigger it.
+//
+func (this *runtimePool) dispatch(interaction *runtimeInteraction) {
+	var client *runtimeClient = interaction.client
+
+	this.lock.Lock()
+
+	client.queue = append(client.queue, interaction)
+	this.markReady(client)
+	this.schedule()
+
+	this.lock.Unlock()
+}
+
+// Add `client` to the ready clients if it can run its next interaction.
+// Must be called with `this.lock` held.
+//
+func (this *runtimePool) markReady(client *runtimeClient) {
+	if client.ready || (len(client.queue) == 0) {
+		return
+	}
+
+	if (client.limit > 0) && (client.running >= client.limit) {
+		return
+	}
+
+	client.ready = true
+	this.ready = append(this.ready, client)
+}
+
+// Start a worker for each interaction which can run.
+// Must be called with `this.lock` held.
+//
+func (this *runtimePool) schedule() {
+	var interaction *runtimeInteraction
+	var client *runtimeClient
+
+	for len(this.ready) > 0 {
+		if (this.limit > 0) && (this.running >= this.limit) {
+			return
+		}
+
+		client = this.ready[0]
+		this.ready[0] = nil
+		this.ready = this.ready[1:]
+		client.ready = false
+
+		interaction = client.queue[0]
+		client.queue[0] = nil
+		client.queue = client.queue[1:]
+
+		client.running += 1
+		this.running += 1
+
+		this.markReady(client)
+
+		go this.work(interaction)
+	}
+}
+
+func (this *runtimePool) work(interaction *runtimeInteraction) {
+	var client *runtimeClient = interaction.client
+
+	interaction.dequeue()
+	interaction.trigger()
+
+	this.lock.Lock()
+
+	client.running -= 1
+	this.running -= 1
+
+	this.markReady(client)
+	this.schedule()
+
+	this.lock.Unlock()
+}
@@ -0,0 +1,132 @@
+package core
+
+
+import (
+	"testing"
+	"time"
+)
+
+
+func newTestPoolRuntime(maxInflight, maxClientInflight int) *runtime {
+	var rt runtime
+
+	rt.params = &msgPrimaryParameters{
+		maxDelay: 10,
+		maxSkew: 10,
+		maxInflight: maxInflight,
+		maxClientInflight: maxClientInflight,
+	}
+	rt.pool = newRuntimePool(maxInflight)
+	rt.start = time.Now()
+
+	return &rt
+}
+
+// Dispatch `n` interactions on `client` and return them.
+//
+func dispatchTestPool(client *runtimeClient, n int) []*runtimeInteraction {
+	var ret []*runtimeInteraction = make([]*runtimeInteraction, n)
+	var i int
+
+	for i = range ret {
+		ret[i] = newRuntimeInteraction(0, client, 0, nil)
+		client.rt.pool.dispatch(ret[i])
+	}
+
+	return ret
+}
+
+func waitTestPool(t *testing.T, interactions []*runtimeInteraction) {
+	var interaction *runtimeInteraction
+
+	for _, interaction = range interactions {
+		select {
+		case <- interaction.finished:
+		case <- time.After(5 * time.Second):
+			t.Fatalf("interaction not finished")
+		}
+	}
+}
+
+func TestPoolLimit(t *testing.T) {
+	var inner *testLatencyClient = &testLatencyClient{
+		latency: 10 * time.Millisecond,
+	}
+	var interactions []*runtimeInteraction
+	var msg msgResultInteraction
+	var rt *runtime
+	var i int
+
+	rt = newTestPoolRuntime(3, 0)
+
+	interactions = append(
+		dispatchTestPool(newRuntimeClient(rt, 0, nil, inner), 15),
+		dispatchTestPool(newRuntimeClient(rt, 1, nil, inner), 15)...)
+
+	waitTestPool(t, interactions)
+
+	if inner.max != 3 {
+		t.Fatalf("got %d interactions at once, expected 3", inner.max)
+	}
+
+	for i = range interactions {
+		interactions[i].report(&msg)
+
+		if (msg.dequeueTime < msg.schedTime) ||
+			(msg.submitTime < msg.dequeueTime) {
+			t.Fatalf("interaction %d scheduled at %f, dequeued " +
+				"at %f and submitted at %f", i, msg.schedTime,
+				msg.dequeueTime, msg.submitTime)
+		}
+	}
+
+	// The last interactions waited for 4 rounds of 3 interactions.
+	if msg.dequeueTime < 0.04 {
+		t.Fatalf("last interaction dequeued at %f", msg.dequeueTime)
+	}
+}
+
+func TestPoolClientLimit(t *testing.T) {
+	var inners []*testLatencyClient = []*testLatencyClient{
+		&testLatencyClient{ latency: 10 * time.Millisecond },
+		&testLatencyClient{ latency: 10 * time.Millisecond },
+	}
+	var interactions []*runtimeInteraction
+	var rt *runtime
+	var i int
+
+	rt = newTestPoolRuntime(0, 2)
+
+	for i = range inners {
+		interactions = append(interactions, dispatchTestPool(
+			newRuntimeClient(rt, i, nil, inners[i]), 10)...)
+	}
+
+	waitTestPool(t, interactions)
+
+	for i = range inners {
+		if inners[i].max != 2 {
+			t.Fatalf("client %d got %d interactions at once, " +
+				"expected 2", i, inners[i].max)
+		}
+	}
+}
+
+func TestPoolFairness(t *testing.T) {
+	var busy, idle []*runtimeInteraction
+	var inner *testLatencyClient = &testLatencyClient{
+		latency: 10 * time.Millisecond,
+	}
+	var rt *runtime
+
+	rt = newTestPoolRuntime(1, 0)
+
+	busy = dispatchTestPool(newRuntimeClient(rt, 0, nil, inner), 5)
+	idle = dispatchTestPool(newRuntimeClient(rt, 1, nil, inner), 1)
+
+	waitTestPool(t, append(busy, idle...))
+
+	if !idle[0].dequeueTime.Before(busy[2].dequeueTime) {
+		t.Fatalf("idle client waited for the busy client queue")
+	}
+}
@@ -3,24 +3,102 @@ package core
 
 type Result struct {
 	Seed       int64
+	Variables  []*VariableResult  `json:",omitempty"`
+	Stakes     []*StakeResult     `json:",omitempty"`
+	Phases     []*PhaseResult     `json:",omitempty"`
 	Locations  []*SecondaryResult
+	Chain      interface{}        `json:",omitempty"`
 }
 
+// The seed used by a variable of the benchmark.
+// Variables defined in a client are defined again for every client so the
+// same position appears once per client.
+//
+type VariableResult struct {
+	Name      string
+	Position  string
+	Seed      int64
+}
+
+// The stakes of the accounts created by an `!account` sample with a stake
+// distribution, in the order of creation.
+//
+type StakeResult struct {
+	Position      string
+	Distribution  string
+	Stakes        []int
+}
+
+// A time interval of the benchmark.
+// Interactions scheduled during a phase are labelled with the phase name,
+// whether or not they are eventually submitted.
+//
+type PhaseResult struct {
+	Name   string
+	Start  float64
+	End    float64
+}
+
+// The results of a secondary.
+// The times of its interactions are relative to a start time common to all
+// secondaries: the clock of each secondary is corrected by its estimated
+// offset to the primary clock, which is exact within `ClockUncertainty`.
+//
 type SecondaryResult struct {
-	Address  string
-	Tags     []string
-	ids      map[int]int
-	Clients  []*ClientResult
+	Address           string
+	Tags              []string
+	ClockOffset       float64  // secondary clock minus primary clock
+	ClockUncertainty  float64
+	RoundTripTime     float64
+	ids               map[int]int
+	Clients           []*ClientResult
 }
 
 type ClientResult struct {
-	Index         int
-	Kind          string
-	Interactions  []*InteractionResult
+	Index           int
+	Kind            string
+	Interactions    []*InteractionResult
+	ExhaustedLoops  []*LoopResult  `json:",omitempty"`
 }
 
+// A closed loop which ran out of interactions before its end.
+// From `ExhaustTime` on, the client keeps less interactions in flight than
+// the loop should, so the load measured after this time is not the
+// saturation load.
+//
+type LoopResult struct {
+	Loop         int
+	ExhaustTime  float64
+}
+
+// The result of an interaction.
+// An interaction waits in the queue of its client from its schedule time to
+// its dequeue time, when a worker of the secondary starts to trigger it, so
+// the gap between the two shows how saturated the client is.
+//
 type InteractionResult struct {
+	Kind          string
+	Label         string          `json:",omitempty"`
+	Type          string
+	ScheduleTime  float64
+	DequeueTime   float64  // negative if not dequeued
+	SubmitTime    float64  // negative if not submitted
+	CommitTime    float64  // negative if not committed
+	AbortTime     float64  // negative if not aborted
+	HasError      bool
+	Phase         string          `json:",omitempty"`
+	Properties    map[string]int  `json:",omitempty"`
+	Steps         []*StepResult   `json:",omitempty"`
+}
+
+// The result of a step of a sequence.
+// The times of the sequence itself are the submit time of its first step and
+// the commit time of its last step.
+//
+type StepResult struct {
 	Kind        string
+	Label       string   `json:",omitempty"`
+	Type        string
 	SubmitTime  float64  // negative if not submitted
 	CommitTime  float64  // negative if not committed
 	AbortTime   float64  // negative if not aborted
@@ -39,6 +117,50 @@ func (this *Result) addSecondary(sresult *SecondaryResult) {
 	this.Locations = append(this.Locations, sresult)
 }
 
+// Return the phase with the given name or nil if there is none.
+//
+func (this *Result) Phase(name string) *PhaseResult {
+	var phase *PhaseResult
+
+	for _, phase = range this.Phases {
+		if phase.Name == name {
+			return phase
+		}
+	}
+
+	return nil
+}
+
+// Label each interaction with the phase it is scheduled in.
+// Interactions are labelled by schedule time rather than submit time so an
+// interaction which is late or never submitted still counts in the phase it
+// was meant to load.
+//
+func (this *Result) labelPhases() {
+	var secondary *SecondaryResult
+	var iact *InteractionResult
+	var client *ClientResult
+	var phase *PhaseResult
+
+	for _, secondary = range this.Locations {
+		for _, client = range secondary.Clients {
+			for _, iact = range client.Interactions {
+				for _, phase = range this.Phases {
+					if phase.Contains(iact.ScheduleTime) {
+						iact.Phase = phase.Name
+						break
+					}
+				}
+			}
+		}
+	}
+}
+
+
+func (this *PhaseResult) Contains(time float64) bool {
+	return (time >= this.Start) && (time < this.End)
+}
+
 
 func newSecondaryResult(addr string, tags []string) *SecondaryResult {
 	return &SecondaryResult{
@@ -67,14 +189,43 @@ func (this *SecondaryResult) getClientResult(id int, kind string) *ClientResult
 	return this.Clients[offset]
 }
 
-func (this *SecondaryResult) addResult(clientId int, clientKind, interactionKind string, submitTime, commitTime, abortTime float64, hasError bool) {
+func (this *SecondaryResult) addResult(clientId int, clientKind string, kind *interactionKind, properties map[string]int, scheduleTime, dequeueTime, submitTime, commitTime, abortTime float64, hasError bool, steps []*StepResult) {
 	var client *ClientResult = this.getClientResult(clientId, clientKind)
 
 	client.Interactions = append(client.Interactions, &InteractionResult{
-		Kind: interactionKind,
+		Kind: kind.name,
+		Label: kind.label,
+		Type: kind.itype,
+		ScheduleTime: scheduleTime,
+		DequeueTime: dequeueTime,
 		SubmitTime: submitTime,
 		CommitTime: commitTime,
 		AbortTime: abortTime,
 		HasError: hasError,
+		Properties: properties,
+		Steps: steps,
 	})
 }
+
+
+func (this *SecondaryResult) addExhaustedLoop(clientId int, clientKind string, loop int, exhaustTime float64) {
+	var client *ClientResult = this.getClientResult(clientId, clientKind)
+
+	client.ExhaustedLoops = append(client.ExhaustedLoops, &LoopResult{
+		Loop: loop,
+		ExhaustTime: exhaustTime,
+	})
+}
+
+
+func newStepResult(kind *interactionKind, submitTime, commitTime, abortTime float64, hasError bool) *StepResult {
+	return &StepResult{
+		Kind: kind.name,
+		Label: kind.label,
+		Type: kind.itype,
+		SubmitTime: submitTime,
+		CommitTime: commitTime,
+		AbortTime: abortTime,
+		HasError: hasError,
+	}
+}
@@ -0,0 +1,144 @@
+package core
+
+
+import (
+	"crypto/subtle"
+	"crypto/tls"
+	"crypto/x509"
+	"fmt"
+	"io/ioutil"
+)
+
+
+// How the connections between the primary and the secondaries are secured.
+// The zero value gives plaintext connections accepted from anyone.
+//
+type Security struct {
+	// Use TLS on the connections.
+	// The primary needs a certificate to use TLS. A secondary verifies the
+	// certificate of the primary with `CaPath` if any or with the system
+	// certificate authorities otherwise.
+	TLS       bool
+
+	// Path of the PEM certificate and private key this node presents.
+	CertPath  string
+	KeyPath   string
+
+	// Path of the PEM certificate authorities to verify the peer with.
+	// When given to the primary, secondaries must present a certificate
+	// signed by one of them (mutual TLS).
+	CaPath    string
+
+	// Shared secret a secondary must send to be accepted by the primary.
+	// Empty to accept secondaries without token.
+	Token     string
+}
+
+// Return the TLS configuration of the primary or `nil` for plaintext.
+//
+func (this *Security) serverConfig() (*tls.Config, error) {
+	var config *tls.Config
+	var err error
+
+	if !this.TLS {
+		return nil, nil
+	}
+
+	if (this.CertPath == "") || (this.KeyPath == "") {
+		return nil, fmt.Errorf("tls needs a certificate and a key")
+	}
+
+	config = &tls.Config{ MinVersion: tls.VersionTLS12 }
+
+	config.Certificates, err = this.loadCertificates()
+	if err != nil {
+		return nil, err
+	}
+
+	if this.CaPath != "" {
+		config.ClientCAs, err = this.loadCaPool()
+		if err != nil {
+			return nil, err
+		}
+
+		config.ClientAuth = tls.RequireAndVerifyClientCert
+	}
+
+	return config, nil
+}
+
+// Return the TLS configuration of a secondary connecting to the primary on
+// the given host or `nil` for plaintext.
+//
+func (this *Security) clientConfig(host string) (*tls.Config, error) {
+	var config *tls.Config
+	var err error
+
+	if !this.TLS {
+		return nil, nil
+	}
+
+	config = &tls.Config{
+		MinVersion: tls.VersionTLS12,
+		ServerName: host,
+	}
+
+	if (this.CertPath != "") || (this.KeyPath != "") {
+		config.Certificates, err = this.loadCertificates()
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	if this.CaPath != "" {
+		config.RootCAs, err = this.loadCaPool()
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	return config, nil
+}
+
+// Return if the token sent by a secondary grants access to the primary.
+//
+func (this *Security) acceptToken(token string) bool {
+	if this.Token == "" {
+		return true
+	}
+
+	return (subtle.ConstantTimeCompare([]byte(this.Token),
+		[]byte(token)) == 1)
+}
+
+func (this *Security) loadCertificates() ([]tls.Certificate, error) {
+	var cert tls.Certificate
+	var err error
+
+	cert, err = tls.LoadX509KeyPair(this.CertPath, this.KeyPath)
+	if err != nil {
+		return nil, fmt.Errorf("cannot load certificate '%s': %s",
+			this.CertPath, err.Error())
+	}
+
+	return []tls.Certificate{ cert }, nil
+}
+
+func (this *Security) loadCaPool() (*x509.CertPool, error) {
+	var pool *x509.CertPool
+	var pem []byte
+	var err error
+
+	pem, err = ioutil.ReadFile(this.CaPath)
+	if err != nil {
+		return nil, err
+	}
+
+	pool = x509.NewCertPool()
+	if !pool.AppendCertsFromPEM(pem) {
+		return nil, fmt.Errorf("no certificate found in '%s'",
+			this.CaPath)
+	}
+
+	return pool, nil
+}
@@ -0,0 +1,344 @@
+package core
+
+
+import (
+	"bytes"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"io/ioutil"
+	"math/big"
+	"net"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+)
+
+
+// Write a certificate authority in "ca.pem" and two certificates it signs in
+// "server.pem" (for 127.0.0.1) and "client.pem" with their keys in "*.key".
+//
+func writeTestCertificates(t *testing.T, dir string) {
+	var caTemplate, template *x509.Certificate
+	var caKey, key *ecdsa.PrivateKey
+	var name string
+	var der []byte
+	var err error
+	var i int
+
+	caKey, err = ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatalf("generate key: %s", err.Error())
+	}
+
+	caTemplate = &x509.Certificate{
+		SerialNumber: big.NewInt(1),
+		Subject: pkix.Name{ CommonName: "diablo test ca" },
+		NotBefore: time.Now().Add(-time.Hour),
+		NotAfter: time.Now().Add(time.Hour),
+		IsCA: true,
+		KeyUsage: x509.KeyUsageCertSign,
+		BasicConstraintsValid: true,
+	}
+
+	der, err = x509.CreateCertificate(rand.Reader, caTemplate, caTemplate,
+		&caKey.PublicKey, caKey)
+	if err != nil {
+		t.Fatalf("create certificate: %s", err.Error())
+	}
+
+	writeTestFile(t, filepath.Join(dir, "ca.pem"),
+		string(pem.EncodeToMemory(&pem.Block{
+			Type: "CERTIFICATE", Bytes: der,
+		})))
+
+	for i, name = range []string{ "server", "client" } {
+		key, err = ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+		if err != nil {
+			t.Fatalf("generate key: %s", err.Error())
+		}
+
+		template = &x509.Certificate{
+			SerialNumber: big.NewInt(int64(i + 2)),
+			Subject: pkix.Name{ CommonName: name },
+			NotBefore: time.Now().Add(-time.Hour),
+			NotAfter: time.Now().Add(time.Hour),
+			KeyUsage: x509.KeyUsageDigitalSignature,
+			ExtKeyUsage: []x509.ExtKeyUsage{
+				x509.ExtKeyUsageServerAuth,
+				x509.ExtKeyUsageClientAuth,
+			},
+			IPAddresses: []net.IP{ net.ParseIP("127.0.0.1") },
+		}
+
+		der, err = x509.CreateCertificate(rand.Reader, template,
+			caTemplate, &key.PublicKey, caKey)
+		if err != nil {
+			t.Fatalf("create certificate: %s", err.Error())
+		}
+
+		writeTestFile(t, filepath.Join(dir, name + ".pem"),
+			string(pem.EncodeToMemory(&pem.Block{
+				Type: "CERTIFICATE", Bytes: der,
+			})))
+
+		der, err = x509.MarshalECPrivateKey(key)
+		if err != nil {
+			t.Fatalf("marshal key: %s", err.Error())
+		}
+
+		writeTestFile(t, filepath.Join(dir, name + ".key"),
+			string(pem.EncodeToMemory(&pem.Block{
+				Type: "EC PRIVATE KEY", Bytes: der,
+			})))
+	}
+}
+
+func connectTestSecondary(t *testing.T, port int, security *Security) error {
+	var config *tls.Config
+	var conn net.Conn
+	var err error
+	var i int
+
+	config, err = security.clientConfig("127.0.0.1")
+	if err != nil {
+		t.Fatalf("client config: %s", err.Error())
+	}
+
+	for i = 0; i < 100; i++ {
+		conn, err = net.Dial("tcp", net.JoinHostPort("127.0.0.1",
+			strconv.Itoa(port)))
+		if err == nil {
+			break
+		}
+
+		time.Sleep(10 * time.Millisecond)
+	}
+
+	if err != nil {
+		t.Fatalf("connect: %s", err.Error())
+	}
+
+	if config != nil {
+		conn = tls.Client(conn, config)
+	}
+
+	defer conn.Close()
+
+	_, err = newPrimaryConn(conn).init(&msgSecondaryParameters{
+		tags: []string{ "eu" },
+		token: security.Token,
+	})
+
+	return err
+}
+
+// Run a primary waiting for one secondary and connect each of the given
+// secondaries in order, the last one being expected to be accepted.
+// Return the error each secondary gets.
+//
+func runTestAccept(t *testing.T, security Security, secondaries ...*Security) []error {
+	var errs []error = make([]error, len(secondaries))
+	var accepted []*remoteSecondary
+	var listener net.Listener
+	var primary *Nprimary
+	var done chan error
+	var err error
+	var i int
+
+	listener, err = net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("listen: %s", err.Error())
+	}
+
+	primary = &Nprimary{
+		NumSecondary: 1,
+		ListenPort: listener.Addr().(*net.TCPAddr).Port,
+		Security: security,
+	}
+
+	listener.Close()
+
+	done = make(chan error)
+	go func() {
+		var err error
+
+		accepted, err = primary.acceptSecondaries(newParsedSetup("test",
+			map[string]string{}, nil))
+		done <- err
+	}()
+
+	for i = range secondaries {
+		errs[i] = connectTestSecondary(t, primary.ListenPort,
+			secondaries[i])
+	}
+
+	select {
+	case err = <- done:
+	case <- time.After(5 * time.Second):
+		t.Fatalf("primary did not accept any secondary")
+	}
+
+	if err != nil {
+		t.Fatalf("accept: %s", err.Error())
+	}
+
+	if (len(accepted) != 1) || (accepted[0].tags()[0] != "eu") {
+		t.Fatalf("accepted %v", accepted)
+	}
+
+	accepted[0].Close()
+
+	return errs
+}
+
+func TestAcceptToken(t *testing.T) {
+	var errs []error
+
+	errs = runTestAccept(t, Security{ Token: "secret" },
+		&Security{}, &Security{ Token: "wrong" },
+		&Security{ Token: "secret" })
+
+	if (errs[0] == nil) || !strings.Contains(errs[0].Error(), "token") {
+		t.Fatalf("secondary without token: got %v", errs[0])
+	}
+
+	if (errs[1] == nil) || !strings.Contains(errs[1].Error(), "token") {
+		t.Fatalf("secondary with wrong token: got %v", errs[1])
+	}
+
+	if errs[2] != nil {
+		t.Fatalf("secondary with token: %s", errs[2].Error())
+	}
+}
+
+func TestAcceptTLS(t *testing.T) {
+	var dir string = t.TempDir()
+	var errs []error
+
+	writeTestCertificates(t, dir)
+
+	errs = runTestAccept(t, Security{
+		TLS: true,
+		CertPath: filepath.Join(dir, "server.pem"),
+		KeyPath: filepath.Join(dir, "server.key"),
+	}, &Security{ TLS: true }, &Security{
+		TLS: true,
+		CaPath: filepath.Join(dir, "ca.pem"),
+	})
+
+	if errs[0] == nil {
+		t.Fatalf("secondary trusting an unknown authority accepted")
+	}
+
+	if errs[1] != nil {
+		t.Fatalf("tls secondary: %s", errs[1].Error())
+	}
+}
+
+func TestAcceptMutualTLS(t *testing.T) {
+	var dir string = t.TempDir()
+	var errs []error
+
+	writeTestCertificates(t, dir)
+
+	errs = runTestAccept(t, Security{
+		TLS: true,
+		CertPath: filepath.Join(dir, "server.pem"),
+		KeyPath: filepath.Join(dir, "server.key"),
+		CaPath: filepath.Join(dir, "ca.pem"),
+		Token: "secret",
+	}, &Security{
+		TLS: true,
+		CaPath: filepath.Join(dir, "ca.pem"),
+		Token: "secret",
+	}, &Security{
+		TLS: true,
+		CertPath: filepath.Join(dir, "client.pem"),
+		KeyPath: filepath.Join(dir, "client.key"),
+		CaPath: filepath.Join(dir, "ca.pem"),
+		Token: "secret",
+	})
+
+	if errs[0] == nil {
+		t.Fatalf("secondary without certificate accepted")
+	}
+
+	if errs[1] != nil {
+		t.Fatalf("secondary with certificate: %s", errs[1].Error())
+	}
+}
+
+
+// Connect a secondary with the given token to a primary whose setup has a
+// secret parameter and return everything the primary sends after the
+// protocol versions.
+//
+func runTestHandshakeToken(t *testing.T, token string) []byte {
+	var primarySide, secondarySide net.Conn
+	var received chan []byte
+	var primary *Nprimary
+
+	primarySide, secondarySide = net.Pipe()
+	received = make(chan []byte)
+
+	go func() {
+		var pconn *primaryConn = newPrimaryConn(secondarySide)
+		var data []byte
+		var err error
+
+		defer secondarySide.Close()
+
+		_, err = decodeMsgHello(pconn.reader)
+		if err == nil {
+			(&msgHello{ version: protocolVersion }).
+				encode(pconn.writer)
+			(&msgSecondaryParameters{
+				tags: []string{ "eu" },
+				token: token,
+			}).encode(pconn.writer)
+			pconn.writer.Flush()
+		}
+
+		data, _ = ioutil.ReadAll(pconn.reader)
+		received <- data
+	}()
+
+	primary = &Nprimary{ Security: Security{ Token: "secret" } }
+
+	newRemoteSecondary(primarySide, newParsedSetup("test",
+		map[string]string{ "password": "hunter2" }, nil), primary)
+
+	primarySide.Close()
+
+	return <- received
+}
+
+func TestHandshakeTokenBeforeParameters(t *testing.T) {
+	var admission *msgAdmission
+	var data []byte
+	var err error
+
+	data = runTestHandshakeToken(t, "wrong")
+
+	admission, err = decodeMsgAdmission(bytes.NewReader(data))
+	if (err != nil) || (admission.reason == "") {
+		t.Fatalf("secondary with wrong token admitted: %v", err)
+	}
+
+	if bytes.Contains(data, []byte("hunter2")) {
+		t.Fatalf("secondary with wrong token got chain parameters")
+	}
+
+	data = runTestHandshakeToken(t, "secret")
+
+	if !bytes.Contains(data, []byte("hunter2")) {
+		t.Fatalf("secondary with token got no chain parameters")
+	}
+}
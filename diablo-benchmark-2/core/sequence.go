@@ -0,0 +1,165 @@
+package core
+
+
+import (
+	"bytes"
+	"fmt"
+)
+
+
+// An interaction made of steps triggered one after the other:
+//
+//   interaction: !sequence
+//     - !invoke { from: *a, contract: *token, function: "approve()" }
+//     - !invoke { from: *b, contract: *token, function: "transferFrom()" }
+//
+// Each step is encoded by the blockchain builder like any other interaction
+// and the encoded steps are packed in a single payload.
+// A secondary triggers a step only once the previous one commits and aborts
+// the sequence as soon as a step aborts or fails.
+//
+type sequenceInteractionFactory struct {
+}
+
+func newSequenceInteractionFactory() *sequenceInteractionFactory {
+	return &sequenceInteractionFactory{}
+}
+
+func (this *sequenceInteractionFactory) Instance(expr BenchmarkExpression, info InteractionInfo) ([]byte, error) {
+	var factory InteractionFactory
+	var steps []BenchmarkExpression
+	var step BenchmarkExpression
+	var payloads [][]byte
+	var itype string
+	var err error
+	var i int
+
+	steps, err = expr.TrySlice()
+	if err != nil {
+		return nil, err
+	}
+
+	payloads = make([][]byte, len(steps))
+
+	for i, step = range steps {
+		itype, err = step.etype()
+		if err != nil {
+			return nil, err
+		}
+
+		factory, _ = expr.system().interactionFactory(itype)
+
+		payloads[i], err = factory.Instance(step, info)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	return encodeSequencePayload(payloads)
+}
+
+// Return the kinds of the steps of a sequence.
+//
+func parseSequenceSteps(expr BenchmarkExpression) ([]*interactionKind, error) {
+	var steps []BenchmarkExpression
+	var kinds []*interactionKind
+	var step, field BenchmarkExpression
+	var itype, label string
+	var err error
+	var i int
+
+	steps, err = expr.TrySlice()
+	if err != nil {
+		return nil, err
+	}
+
+	if len(steps) == 0 {
+		return nil, fmt.Errorf("%s: sequence must have steps",
+			expr.FullPosition())
+	}
+
+	kinds = make([]*interactionKind, len(steps))
+
+	for i, step = range steps {
+		itype, err = step.etype()
+		if err != nil {
+			return nil, err
+		}
+
+		if itype == "sequence" {
+			return nil, fmt.Errorf("%s: sequences cannot be nested",
+				step.FullPosition())
+		}
+
+		label = ""
+		field, err = step.TryField("label")
+		if err == nil {
+			label, err = field.GetString()
+			if err != nil {
+				return nil, err
+			}
+		}
+
+		kinds[i] = &interactionKind{
+			name: step.FullPosition(),
+			label: label,
+			itype: itype,
+		}
+	}
+
+	return kinds, nil
+}
+
+// Pack the encoded steps of a sequence as a varint number of steps followed
+// by the varint length and the content of each step.
+//
+func encodeSequencePayload(payloads [][]byte) ([]byte, error) {
+	var buf bytes.Buffer
+	var payload []byte
+	var err error
+
+	err = writeLength(&buf, "step count", len(payloads))
+	if err != nil {
+		return nil, err
+	}
+
+	for _, payload = range payloads {
+		err = writeBytes(&buf, "step payload", payload)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	return buf.Bytes(), nil
+}
+
+func decodeSequencePayload(payload []byte) ([][]byte, error) {
+	var src *bytes.Reader = bytes.NewReader(payload)
+	var payloads [][]byte
+	var step []byte
+	var err error
+	var i, n int
+
+	n, err = readLength(src, "step count")
+	if err != nil {
+		return nil, err
+	}
+
+	payloads = make([][]byte, 0)
+
+	for i = 0; i < n; i++ {
+		step, err = readBytes(src, "step payload")
+		if err != nil {
+			return nil, err
+		}
+
+		payloads = append(payloads, step)
+	}
+
+	if src.Len() > 0 {
+		return nil, fmt.Errorf("trailing %d bytes after sequence",
+			src.Len())
+	}
+
+	return payloads, nil
+}
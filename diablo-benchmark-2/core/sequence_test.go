@@ -0,0 +1,239 @@
+package core
+
+
+import (
+	"bytes"
+	"sync"
+	"testing"
+	"time"
+)
+
+
+// A blockchain client recording the payloads it triggers and aborting the
+// ones named "abort".
+//
+type testSequenceClient struct {
+	lock       sync.Mutex
+	triggered  []string
+}
+
+func (this *testSequenceClient) DecodePayload(bytes []byte) (interface{}, error) {
+	return string(bytes), nil
+}
+
+func (this *testSequenceClient) TriggerInteraction(iact Interaction) error {
+	var name string = iact.Payload().(string)
+
+	this.lock.Lock()
+	this.triggered = append(this.triggered, name)
+	this.lock.Unlock()
+
+	iact.ReportSubmit()
+
+	go func() {
+		time.Sleep(time.Millisecond)
+
+		if name == "abort" {
+			iact.ReportAbort()
+		} else {
+			iact.ReportCommit()
+		}
+	}()
+
+	return nil
+}
+
+
+func runTestSequence(t *testing.T, names ...string) (*testSequenceClient, *msgResultInteraction) {
+	var inner *testSequenceClient = &testSequenceClient{}
+	var interaction *runtimeInteraction
+	var msg msgResultInteraction
+	var client *runtimeClient
+	var rt runtime
+	var i int
+
+	rt.params = &msgPrimaryParameters{ maxDelay: 10, maxSkew: 10 }
+	client = newRuntimeClient(&rt, 0, nil, inner)
+
+	interaction = newRuntimeInteraction(0, client, 0, nil)
+	interaction.steps = make([]*runtimeInteraction, len(names))
+	for i = range names {
+		interaction.steps[i] = newRuntimeInteraction(0, client, 0,
+			names[i])
+	}
+
+	rt.start = time.Now()
+	interaction.trigger()
+
+	select {
+	case <- interaction.finished:
+	case <- time.After(time.Second):
+		t.Fatalf("sequence did not finish")
+	}
+
+	interaction.report(&msg)
+
+	return inner, &msg
+}
+
+func TestSequenceOrder(t *testing.T) {
+	var msg *msgResultInteraction
+	var inner *testSequenceClient
+	var i int
+
+	inner, msg = runTestSequence(t, "a", "b", "c")
+
+	if (len(inner.triggered) != 3) || (inner.triggered[0] != "a") ||
+		(inner.triggered[1] != "b") || (inner.triggered[2] != "c") {
+		t.Fatalf("triggered %v", inner.triggered)
+	}
+
+	if len(msg.steps) != 3 {
+		t.Fatalf("got %d step results", len(msg.steps))
+	}
+
+	for i = 1; i < len(msg.steps); i++ {
+		if msg.steps[i].submitTime < msg.steps[i-1].commitTime {
+			t.Fatalf("step %d submitted at %f before step %d " +
+				"committed at %f", i, msg.steps[i].submitTime,
+				i - 1, msg.steps[i-1].commitTime)
+		}
+	}
+
+	if (msg.submitTime != msg.steps[0].submitTime) ||
+		(msg.commitTime != msg.steps[2].commitTime) ||
+		(msg.abortTime >= 0) || msg.hasError {
+		t.Fatalf("got sequence result %v", msg)
+	}
+}
+
+func TestSequenceAbort(t *testing.T) {
+	var msg *msgResultInteraction
+	var inner *testSequenceClient
+
+	inner, msg = runTestSequence(t, "a", "abort", "c")
+
+	if len(inner.triggered) != 2 {
+		t.Fatalf("triggered %v", inner.triggered)
+	}
+
+	if (msg.commitTime >= 0) || (msg.abortTime < 0) ||
+		(msg.abortTime != msg.steps[1].abortTime) {
+		t.Fatalf("got sequence result %v", msg)
+	}
+
+	if msg.steps[2].submitTime >= 0 {
+		t.Fatalf("step after abort submitted")
+	}
+}
+
+func TestSequencePayload(t *testing.T) {
+	var payloads [][]byte
+	var encoded []byte
+	var err error
+
+	encoded, err = encodeSequencePayload([][]byte{
+		[]byte("first"), []byte{}, []byte("third"),
+	})
+	if err != nil {
+		t.Fatalf("encode: %s", err.Error())
+	}
+
+	payloads, err = decodeSequencePayload(encoded)
+	if err != nil {
+		t.Fatalf("decode: %s", err.Error())
+	}
+
+	if (len(payloads) != 3) || (string(payloads[0]) != "first") ||
+		(len(payloads[1]) != 0) || (string(payloads[2]) != "third") {
+		t.Fatalf("decode: got %q", payloads)
+	}
+
+	_, err = decodeSequencePayload(append(encoded, 0))
+	if err == nil {
+		t.Fatalf("decode: trailing bytes accepted")
+	}
+
+	_, err = decodeSequencePayload(encoded[:len(encoded) - 1])
+	if err == nil {
+		t.Fatalf("decode: truncated payload accepted")
+	}
+}
+
+func TestEncodeResultSequence(t *testing.T) {
+	var iact *msgResultInteraction
+	var buf bytes.Buffer
+	var msg msgResult
+	var err error
+	var ok bool
+
+	err = (&msgResultInteraction{
+		index: 1, ikind: 2, submitTime: 0.5, commitTime: -1,
+		abortTime: 1.5, hasError: false, steps: []*msgResultStep{
+			&msgResultStep{ 0.5, 1, -1, false },
+			&msgResultStep{ 1.25, -1, 1.5, true },
+		},
+	}).encode(&buf)
+	if err != nil {
+		t.Fatalf("encode: %s", err.Error())
+	}
+
+	msg, err = decodeMsgResult(&buf)
+	if err != nil {
+		t.Fatalf("decode: %s", err.Error())
+	}
+
+	iact, ok = msg.(*msgResultInteraction)
+	if !ok || (iact.index != 1) || (iact.ikind != 2) ||
+		(iact.abortTime != 1.5) || (len(iact.steps) != 2) {
+		t.Fatalf("decode: got %v", msg)
+	}
+
+	if (*iact.steps[0] != msgResultStep{ 0.5, 1, -1, false }) ||
+		(*iact.steps[1] != msgResultStep{ 1.25, -1, 1.5, true }) {
+		t.Fatalf("decode: got steps %v %v", iact.steps[0],
+			iact.steps[1])
+	}
+}
+
+func TestPlanSequence(t *testing.T) {
+	var iact *PlanInteraction
+	var plan *Plan
+
+	plan = runTestPlan(t, `
+let:
+  - &loc { sample: !location [ "eu" ] }
+  - &endpoint { sample: !endpoint [ ".*" ] }
+  - &account { sample: !account { number: 2, stake: 100 } }
+  - &token { sample: !contract { name: "token" } }
+workloads:
+  - number: 1
+    client:
+      location: *loc
+      view: *endpoint
+      behavior:
+        - interaction: !sequence
+            - !transfer { from: *account, to: *account }
+            - !invoke
+                from: *account
+                contract: *token
+                function: "f()"
+                label: "second"
+          load: { 0: 1, 2: 0 }
+`, [][]string{ []string{ "eu" } })
+
+	if len(plan.Clients) != 1 {
+		t.Fatalf("got %d clients, expected 1", len(plan.Clients))
+	}
+
+	if len(plan.Clients[0].Interactions) != 2 {
+		t.Fatalf("got %d interactions, expected 2",
+			len(plan.Clients[0].Interactions))
+	}
+
+	for _, iact = range plan.Clients[0].Interactions {
+		if iact.Type != "sequence" {
+			t.Fatalf("got interaction type '%s'", iact.Type)
+		}
+	}
+}
@@ -0,0 +1,174 @@
+package core
+
+
+import (
+	"fmt"
+	"math"
+	"math/rand"
+	"sort"
+)
+
+
+// Parse the stake distribution described by `expr` and return the stake of
+// each of the `number` accounts:
+//
+//   stake:
+//     distribution: "pareto"   # or "lognormal" or "uniform"
+//     total: 1000000           # sum of the stakes
+//     min: 10                  # minimum stake of each account (default 0)
+//     shape: 1.16              # pareto alpha or lognormal sigma (optional)
+//     seed: 42                 # optional
+//
+// The `total - number * min` stakes left once every account has its minimum
+// are shared in proportion to a weight drawn for each account.
+// The same seed always gives the same stakes.
+//
+func parseStakeDistribution(expr BenchmarkExpression, number int) ([]int, error) {
+	var weight func(*rand.Rand) float64
+	var field BenchmarkExpression
+	var distribution string
+	var total, min int
+	var stakes []int
+	var shape float64
+	var seed int64
+	var err error
+
+	distribution, err = expr.Field("distribution").GetString()
+	if err != nil {
+		return nil, err
+	}
+
+	total, err = expr.Field("total").GetInt()
+	if err != nil {
+		return nil, err
+	}
+
+	field, err = expr.TryField("min")
+	if err == nil {
+		min, err = field.GetInt()
+		if err != nil {
+			return nil, err
+		}
+	} else {
+		min = 0
+	}
+
+	if min < 0 {
+		return nil, fmt.Errorf("%s: min must be positive",
+			expr.FullPosition())
+	}
+
+	if total < (min * number) {
+		return nil, fmt.Errorf("%s: total %d is less than %d accounts " +
+			"with %d each", expr.FullPosition(), total, number, min)
+	}
+
+	switch distribution {
+	case "pareto":
+		shape, err = parseRandomParameter(expr, "shape", 1.16)
+		if (err == nil) && (shape <= 0) {
+			err = fmt.Errorf("%s: shape must be strictly positive",
+				expr.FullPosition())
+		}
+
+		weight = func (r *rand.Rand) float64 {
+			return math.Pow(1 - r.Float64(), -1 / shape)
+		}
+	case "lognormal":
+		shape, err = parseRandomParameter(expr, "shape", 1.0)
+		if (err == nil) && (shape <= 0) {
+			err = fmt.Errorf("%s: shape must be strictly positive",
+				expr.FullPosition())
+		}
+
+		weight = func (r *rand.Rand) float64 {
+			return math.Exp(shape * r.NormFloat64())
+		}
+	case "uniform":
+		weight = func (r *rand.Rand) float64 {
+			return r.Float64()
+		}
+	default:
+		return nil, fmt.Errorf("%s: unknown stake distribution '%s'",
+			expr.Field("distribution").FullPosition(), distribution)
+	}
+
+	if err != nil {
+		return nil, err
+	}
+
+	field, err = expr.TryField("seed")
+	if err == nil {
+		seed, err = parseSeed(field)
+		if err != nil {
+			return nil, err
+		}
+	} else {
+		seed = expr.system().seed()
+	}
+
+	expr.system().recordSeed(expr.FullPosition(), "stake", seed)
+
+	stakes = distributeStakes(rand.New(rand.NewSource(seed)), weight,
+		number, total, min)
+
+	expr.system().recordStakes(expr.FullPosition(), distribution, stakes)
+
+	return stakes, nil
+}
+
+// Share `total` between `number` accounts so each account has at least `min`
+// and the rest is shared in proportion to the weights drawn with `weight`.
+// The stakes always sum to `total`: what the rounding leaves goes to the
+// accounts with the largest remainders.
+//
+func distributeStakes(r *rand.Rand, weight func(*rand.Rand) float64, number, total, min int) []int {
+	var weights, remainders []float64
+	var stakes, order []int
+	var sum, share float64
+	var left, i int
+
+	stakes = make([]int, number)
+	if number == 0 {
+		return stakes
+	}
+
+	weights = make([]float64, number)
+	sum = 0
+	for i = range weights {
+		weights[i] = weight(r)
+		sum += weights[i]
+	}
+
+	left = total - (min * number)
+	remainders = make([]float64, number)
+	order = make([]int, number)
+
+	for i = range stakes {
+		if sum > 0 {
+			share = float64(left) * weights[i] / sum
+		} else {
+			share = float64(left) / float64(number)
+		}
+
+		stakes[i] = int(math.Floor(share))
+		remainders[i] = share - float64(stakes[i])
+		order[i] = i
+	}
+
+	for i = range stakes {
+		left -= stakes[i]
+		stakes[i] += min
+	}
+
+	sort.SliceStable(order, func (a, b int) bool {
+		return remainders[order[a]] > remainders[order[b]]
+	})
+
+	for i = 0; left > 0; i = (i + 1) % number {
+		stakes[order[i]] += 1
+		left -= 1
+	}
+
+	return stakes
+}
@@ -0,0 +1,126 @@
+package core
+
+
+import (
+	"math/rand"
+	"sort"
+	"testing"
+)
+
+
+func TestDistributeStakes(t *testing.T) {
+	var weight func(*rand.Rand) float64
+	var stakes, again []int
+	var name string
+	var sum, i int
+
+	for name, weight = range map[string]func(*rand.Rand) float64{
+		"pareto": func (r *rand.Rand) float64 {
+			return 1 / (1 - r.Float64())
+		},
+		"constant": func (r *rand.Rand) float64 {
+			return 1
+		},
+		"zero": func (r *rand.Rand) float64 {
+			return 0
+		},
+	} {
+		stakes = distributeStakes(rand.New(rand.NewSource(3)), weight,
+			7, 1000, 10)
+		again = distributeStakes(rand.New(rand.NewSource(3)), weight,
+			7, 1000, 10)
+
+		sum = 0
+		for i = range stakes {
+			if stakes[i] < 10 {
+				t.Fatalf("%s: stake %d below min", name,
+					stakes[i])
+			}
+
+			if stakes[i] != again[i] {
+				t.Fatalf("%s: stakes %v then %v", name, stakes,
+					again)
+			}
+
+			sum += stakes[i]
+		}
+
+		if sum != 1000 {
+			t.Fatalf("%s: stakes %v sum to %d", name, stakes, sum)
+		}
+	}
+}
+
+func TestPlanStakes(t *testing.T) {
+	var stakes []int
+	var plan *Plan
+	var top, sum, i int
+
+	plan = runTestPlan(t, `
+let:
+  - &loc { sample: !location [ ".*" ] }
+  - &endpoint { sample: !endpoint [ ".*" ] }
+  - &account
+    sample: !account
+      number: 100
+      stake:
+        distribution: "pareto"
+        shape: 1.05
+        total: 1000000
+        min: 1
+        seed: 7
+workloads:
+  - client:
+      location: *loc
+      view: *endpoint
+      behavior:
+        - interaction: !transfer { from: *account, to: *account }
+          load: { 0: 1, 1: 0 }
+`, [][]string{ []string{} })
+
+	if (len(plan.Stakes) != 1) || (len(plan.Stakes[0].Stakes) != 100) ||
+		(plan.Stakes[0].Distribution != "pareto") {
+		t.Fatalf("got stakes %v", plan.Stakes)
+	}
+
+	stakes = make([]int, 100)
+	copy(stakes, plan.Stakes[0].Stakes)
+	sort.Sort(sort.Reverse(sort.IntSlice(stakes)))
+
+	sum = 0
+	top = 0
+	for i = range stakes {
+		sum += stakes[i]
+		if i < 10 {
+			top += stakes[i]
+		}
+	}
+
+	if sum != 1000000 {
+		t.Fatalf("stakes sum to %d", sum)
+	}
+
+	// With a pareto shape close to 1, the richest 10% of the accounts
+	// hold far more than 10% of the funds.
+	if top < (sum / 4) {
+		t.Fatalf("top 10%% of accounts hold %d out of %d", top, sum)
+	}
+}
+
+func TestStakeDistributionErrors(t *testing.T) {
+	var stake string
+	var err error
+
+	for _, stake = range []string{
+		`{ distribution: "pareto", total: 10, min: 2 }`,
+		`{ distribution: "gaussian", total: 10 }`,
+		`{ distribution: "pareto", total: 10, shape: 0 }`,
+		`{ distribution: "uniform" }`,
+	} {
+		_, err = parseStakeDistribution(parseTestExpr(t,
+			newTestSystem(), stake), 10)
+		if err == nil {
+			t.Fatalf("stake %s accepted", stake)
+		}
+	}
+}
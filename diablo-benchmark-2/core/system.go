@@ -2,7 +2,10 @@ package core
 
 
 import (
+	"hash"
+	"hash/fnv"
 	"math/rand"
+	"strconv"
 )
 
 
@@ -23,6 +26,13 @@ type randomFactory interface {
 
 type system struct {
 	seedGenerator  *rand.Rand
+	seeds          []*VariableResult
+	stakes         []*StakeResult
+	phases         []*PhaseResult
+	defines        map[string]string    // from the command line
+	includes       map[string]bool      // files being included
+	checking       bool                 // report errors and keep parsing
+	problems       []string             // errors reported while checking
 	builder        BlockchainBuilder
 	samples        map[string]SampleFactory
 	randoms        map[string]randomFactory
@@ -33,6 +43,13 @@ func newSystem(masterSeed int64, locations []location, setup setup, builder Bloc
 	var this system
 
 	this.seedGenerator = rand.New(rand.NewSource(masterSeed))
+	this.seeds = make([]*VariableResult, 0)
+	this.stakes = make([]*StakeResult, 0)
+	this.phases = make([]*PhaseResult, 0)
+	this.defines = make(map[string]string)
+	this.includes = make(map[string]bool)
+	this.checking = false
+	this.problems = make([]string, 0)
 	this.builder = builder
 
 	this.samples = map[string]SampleFactory{
@@ -47,11 +64,15 @@ func newSystem(masterSeed int64, locations []location, setup setup, builder Bloc
 	this.randoms = map[string]randomFactory{
 		"uniform": newUniformRandomFactory(),
 		"normal": newNormalRandomFactory(),
+		"exponential": newExponentialRandomFactory(),
+		"zipf": newZipfRandomFactory(),
+		"hotspot": newHotspotRandomFactory(),
 	}
 
 	this.interactions = map[string]InteractionFactory{
 		"transfer": newTransferInteractionFactory(builder),
 		"invoke": newInvokeInteractionFactory(builder),
+		"sequence": newSequenceInteractionFactory(),
 	}
 
 	return &this
@@ -61,6 +82,50 @@ func (this *system) seed() int64 {
 	return this.seedGenerator.Int63()
 }
 
+// Record the seed used by the variable `name` defined at `position` so the
+// results tell how to reproduce it.
+//
+func (this *system) recordSeed(position, name string, seed int64) {
+	this.seeds = append(this.seeds, &VariableResult{
+		Name: name,
+		Position: position,
+		Seed: seed,
+	})
+}
+
+// Report an error found while parsing the benchmark.
+// When checking a benchmark, record the error and return nil so the parsing
+// goes on and finds the other errors. Otherwise return the error.
+//
+func (this *system) report(err error) error {
+	var problem string
+
+	if !this.checking {
+		return err
+	}
+
+	for _, problem = range this.problems {
+		if problem == err.Error() {
+			return nil
+		}
+	}
+
+	this.problems = append(this.problems, err.Error())
+
+	return nil
+}
+
+// Record the stakes given to the accounts defined at `position` so the
+// results tell how the funds are distributed.
+//
+func (this *system) recordStakes(position, distribution string, stakes []int) {
+	this.stakes = append(this.stakes, &StakeResult{
+		Position: position,
+		Distribution: distribution,
+		Stakes: stakes,
+	})
+}
+
 func (this *system) sampleFactory(domain string) (SampleFactory, bool) {
 	var ret SampleFactory
 	var ok bool
@@ -93,3 +158,24 @@ func (this *system) interactionFactory(itype string) (InteractionFactory, bool)
 
 	return newProxyInteractionFactory(this.builder, itype), true
 }
+
+
+// Return the seed for the given string.
+// A string representing an integer is this integer, any other string is
+// hashed so the same string always gives the same seed.
+//
+func ParseSeed(value string) int64 {
+	var hash hash.Hash64
+	var ivalue int64
+	var err error
+
+	ivalue, err = strconv.ParseInt(value, 10, 64)
+	if err == nil {
+		return ivalue
+	}
+
+	hash = fnv.New64()
+	hash.Write([]byte(value))
+
+	return int64(hash.Sum64())
+}
@@ -0,0 +1,645 @@
+package core
+
+
+import (
+	"bufio"
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+)
+
+
+// Replay the arrival times of a trace file:
+//
+//   !trace
+//     path: "arrivals.csv"
+//     format: "csv"            # csv or json, default from the extension
+//     time-column: "timestamp" # default "time"
+//     scale: 10                # replay 10 times faster, default 1
+//     offset: 1650000000       # trace time of the benchmark start
+//     columns:
+//       - &amount { column: "value" }
+//       - &sender { column: "from", sample: *accounts }
+//     interaction: !transfer { from: *sender, to: *local, stake: *amount }
+//
+// An interaction is triggered at `(time - offset) / scale` for each row of the
+// trace. Rows before the offset are skipped. The offset defaults to the time
+// of the first row.
+// Times are either numbers of seconds or RFC 3339 dates and must not
+// decrease.
+// Each anchored entry of `columns` defines a variable for the interaction of
+// every row. The variable is the number in the given column or, if a
+// `sample` variable is specified, the element of this sample at the index in
+// the given column.
+// CSV traces have a header row naming the columns. JSON traces are either an
+// array of objects or a stream of objects (JSON lines).
+// The trace is read once when parsed to check it and once more when the
+// interactions are generated so it is never loaded in memory.
+//
+type traceGenerator struct {
+	behaviorInteraction
+	path        string
+	format      string
+	timeColumn  string
+	scale       float64
+	offset      float64
+	bindings    []*traceBinding
+	sender      client
+}
+
+type traceBinding struct {
+	name      string
+	column    string
+	variable  Variable  // nil for a number
+	domain    string
+}
+
+func parseTrace(expr BenchmarkExpression, sender client) (*traceGenerator, error) {
+	var this traceGenerator
+	var field BenchmarkExpression
+	var hasOffset bool
+	var err error
+
+	this.sender = sender
+
+	err = this.behaviorInteraction.parse(expr)
+	if err != nil {
+		return nil, err
+	}
+
+	this.path, err = expr.Field("path").GetString()
+	if err != nil {
+		return nil, err
+	}
+
+	this.format, err = parseTraceFormat(expr, this.path)
+	if err != nil {
+		return nil, err
+	}
+
+	this.timeColumn = "time"
+	field, err = expr.TryField("time-column")
+	if err == nil {
+		this.timeColumn, err = field.GetString()
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	this.scale = 1
+	field, err = expr.TryField("scale")
+	if err == nil {
+		this.scale, err = field.GetFloat()
+		if err != nil {
+			return nil, err
+		}
+
+		if this.scale <= 0 {
+			return nil, fmt.Errorf("%s: must be strictly positive",
+				field.FullPosition())
+		}
+	}
+
+	field, err = expr.TryField("offset")
+	if err == nil {
+		this.offset, err = field.GetFloat()
+		if err != nil {
+			return nil, err
+		}
+
+		hasOffset = true
+	}
+
+	this.bindings = make([]*traceBinding, 0)
+	field, err = expr.TryField("columns")
+	if err == nil {
+		this.bindings, err = parseTraceBindings(field)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	err = this.check(hasOffset)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %s",
+			expr.Field("path").FullPosition(), err.Error())
+	}
+
+	return &this, nil
+}
+
+func parseTraceFormat(expr BenchmarkExpression, path string) (string, error) {
+	var field BenchmarkExpression
+	var format string
+	var err error
+
+	field, err = expr.TryField("format")
+	if err == nil {
+		format, err = field.GetString()
+		if err != nil {
+			return "", err
+		}
+	} else if strings.HasSuffix(path, ".csv") {
+		format = "csv"
+	} else if strings.HasSuffix(path, ".json") ||
+		strings.HasSuffix(path, ".jsonl") {
+		format = "json"
+	} else {
+		return "", fmt.Errorf("%s: cannot infer trace format",
+			expr.FullPosition())
+	}
+
+	if (format != "csv") && (format != "json") {
+		return "", fmt.Errorf("%s: unknown trace format '%s'",
+			field.FullPosition(), format)
+	}
+
+	return format, nil
+}
+
+func parseTraceBindings(expr BenchmarkExpression) ([]*traceBinding, error) {
+	var names map[string]bool = make(map[string]bool)
+	var binding *traceBinding
+	var ret []*traceBinding
+	var child, field BenchmarkExpression
+	var err error
+
+	ret = make([]*traceBinding, 0)
+
+	for _, child = range expr.Slice() {
+		binding = &traceBinding{ domain: "" }
+
+		binding.name, err = child.name()
+		if err != nil {
+			return nil, err
+		}
+
+		if names[binding.name] {
+			return nil, fmt.Errorf("%s: column variable '%s' " +
+				"redefined", child.FullPosition(),
+				binding.name)
+		}
+
+		names[binding.name] = true
+
+		binding.column, err = child.Field("column").GetString()
+		if err != nil {
+			return nil, err
+		}
+
+		field, err = child.TryField("sample")
+		if err == nil {
+			binding.variable, binding.domain, err =
+				parseComposeOperand(field)
+			if err != nil {
+				return nil, err
+			}
+		}
+
+		ret = append(ret, binding)
+	}
+
+	return ret, nil
+}
+
+// Read the whole trace to check it can be replayed and set the offset if it
+// is not specified.
+//
+func (this *traceGenerator) check(hasOffset bool) error {
+	var reader traceReader
+	var binding *traceBinding
+	var value, last float64
+	var row traceRow
+	var err error
+
+	reader, err = openTraceReader(this.path, this.format)
+	if err != nil {
+		return err
+	}
+
+	defer reader.Close()
+
+	for {
+		row, err = reader.read()
+		if err == io.EOF {
+			break
+		} else if err != nil {
+			return err
+		}
+
+		value, err = this.rowTime(reader, row)
+		if err != nil {
+			return err
+		}
+
+		if reader.line() == 1 {
+			if !hasOffset {
+				this.offset = value
+			}
+		} else if value < last {
+			return fmt.Errorf("row %d: time %f before previous " +
+				"row", reader.line(), value)
+		}
+
+		last = value
+
+		for _, binding = range this.bindings {
+			if binding.variable == nil {
+				_, err = this.rowNumber(reader, row,
+					binding.column)
+				if err != nil {
+					return err
+				}
+
+				continue
+			}
+
+			_, err = this.rowIndex(reader, row, binding)
+			if err != nil {
+				return err
+			}
+		}
+	}
+
+	return nil
+}
+
+func (this *traceGenerator) rowTime(reader traceReader, row traceRow) (float64, error) {
+	var date time.Time
+	var value string
+	var ret float64
+	var err error
+	var ok bool
+
+	value, ok = row[this.timeColumn]
+	if !ok {
+		return 0, fmt.Errorf("row %d: no column '%s'", reader.line(),
+			this.timeColumn)
+	}
+
+	ret, err = strconv.ParseFloat(value, 64)
+	if err == nil {
+		return ret, nil
+	}
+
+	date, err = time.Parse(time.RFC3339Nano, value)
+	if err != nil {
+		return 0, fmt.Errorf("row %d: invalid time '%s'",
+			reader.line(), value)
+	}
+
+	return float64(date.UnixNano()) / float64(time.Second), nil
+}
+
+func (this *traceGenerator) rowNumber(reader traceReader, row traceRow, column string) (float64, error) {
+	var value string
+	var ret float64
+	var err error
+	var ok bool
+
+	value, ok = row[column]
+	if !ok {
+		return 0, fmt.Errorf("row %d: no column '%s'", reader.line(),
+			column)
+	}
+
+	ret, err = strconv.ParseFloat(value, 64)
+	if err != nil {
+		return 0, fmt.Errorf("row %d: invalid number '%s' in " +
+			"column '%s'", reader.line(), value, column)
+	}
+
+	return ret, nil
+}
+
+func (this *traceGenerator) rowIndex(reader traceReader, row traceRow, binding *traceBinding) (int, error) {
+	var value float64
+	var err error
+
+	value, err = this.rowNumber(reader, row, binding.column)
+	if err != nil {
+		return 0, err
+	}
+
+	if (value < 0) || (value != float64(int(value))) ||
+		(int(value) >= binding.variable.Sample().Size()) {
+		return 0, fmt.Errorf("row %d: invalid index %f in column " +
+			"'%s' for a sample of %d elements", reader.line(),
+			value, binding.column,
+			binding.variable.Sample().Size())
+	}
+
+	return int(value), nil
+}
+
+// Return the scope of the interaction for the given row.
+//
+func (this *traceGenerator) rowScope(reader traceReader, row traceRow) (scope, error) {
+	var binding *traceBinding
+	var variable Variable
+	var element interface{}
+	var value float64
+	var ret basicScope
+	var index int
+	var err error
+
+	ret.init(this.current)
+
+	for _, binding = range this.bindings {
+		if binding.variable != nil {
+			index, err = this.rowIndex(reader, row, binding)
+			if err != nil {
+				return nil, err
+			}
+
+			element = binding.variable.Sample().Get(index)
+			variable = newVariable(binding.domain,
+				newElementSample([]interface{}{ element }),
+				newUniformDistribution(1, 0, TypeRegular))
+
+			ret.add(binding.name, binding.domain, variable)
+
+			continue
+		}
+
+		value, err = this.rowNumber(reader, row, binding.column)
+		if err != nil {
+			return nil, err
+		}
+
+		if value == float64(int(value)) {
+			variable = newVariable("integer",
+				newIntSample(int(value), int(value)),
+				newUniformDistribution(1, 0, TypeRegular))
+			ret.add(binding.name, "integer", variable)
+		} else {
+			ret.add(binding.name, "float", newFloatImmediate(value))
+		}
+	}
+
+	return &ret, nil
+}
+
+func (this *traceGenerator) generate() <-chan *benchmarkInteraction {
+	var ret chan *benchmarkInteraction = make(chan *benchmarkInteraction)
+
+	go this.replay(ret)
+
+	return ret
+}
+
+func (this *traceGenerator) replay(out chan<- *benchmarkInteraction) {
+	var reader traceReader
+	var value, clock float64
+	var current scope
+	var row traceRow
+	var err error
+
+	defer close(out)
+
+	clock = 0
+
+	reader, err = openTraceReader(this.path, this.format)
+	if err != nil {
+		out <- &benchmarkInteraction{ source: this.source, err: err }
+		return
+	}
+
+	defer reader.Close()
+
+	for {
+		row, err = reader.read()
+		if err == io.EOF {
+			return
+		}
+
+		if err == nil {
+			value, err = this.rowTime(reader, row)
+		}
+
+		if err == nil {
+			current, err = this.rowScope(reader, row)
+		}
+
+		if err != nil {
+			out <- &benchmarkInteraction{
+				scheduleTime: clock,
+				source: this.source,
+				err: fmt.Errorf("%s: %s", this.path,
+					err.Error()),
+			}
+			return
+		}
+
+		value = (value - this.offset) / this.scale
+		if value < 0 {
+			continue
+		}
+
+		clock = value
+
+		out <- &benchmarkInteraction{
+			scheduleTime: clock,
+			sendingClient: this.sender,
+			factory: this.factory,
+			source: this.source,
+			current: current,
+			kind: this.kind,
+		}
+	}
+}
+
+
+// A row of a trace as a map from column name to value.
+//
+type traceRow map[string]string
+
+type traceReader interface {
+	// Return the next row of the trace or io.EOF.
+	//
+	read() (traceRow, error)
+
+	// Return the number of the last row read, starting at 1.
+	//
+	line() int
+
+	Close() error
+}
+
+func openTraceReader(path, format string) (traceReader, error) {
+	var file *os.File
+	var err error
+
+	file, err = os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+
+	if format == "csv" {
+		return newCsvTraceReader(file)
+	} else {
+		return newJsonTraceReader(file)
+	}
+}
+
+
+type csvTraceReader struct {
+	file    *os.File
+	reader  *csv.Reader
+	header  []string
+	count   int
+}
+
+func newCsvTraceReader(file *os.File) (*csvTraceReader, error) {
+	var this csvTraceReader
+	var err error
+
+	this.file = file
+	this.reader = csv.NewReader(bufio.NewReader(file))
+	this.reader.ReuseRecord = true
+	this.count = 0
+
+	this.header, err = this.reader.Read()
+	if err == io.EOF {
+		file.Close()
+		return nil, fmt.Errorf("no header row")
+	} else if err != nil {
+		file.Close()
+		return nil, err
+	}
+
+	this.header = append([]string{}, this.header...)
+
+	return &this, nil
+}
+
+func (this *csvTraceReader) read() (traceRow, error) {
+	var record []string
+	var ret traceRow
+	var err error
+	var i int
+
+	record, err = this.reader.Read()
+	if err != nil {
+		return nil, err
+	}
+
+	this.count += 1
+	ret = make(traceRow, len(this.header))
+
+	for i = range this.header {
+		if i < len(record) {
+			ret[this.header[i]] = strings.TrimSpace(record[i])
+		}
+	}
+
+	return ret, nil
+}
+
+func (this *csvTraceReader) line() int {
+	return this.count
+}
+
+func (this *csvTraceReader) Close() error {
+	return this.file.Close()
+}
+
+
+type jsonTraceReader struct {
+	file     *os.File
+	decoder  *json.Decoder
+	array    bool
+	count    int
+}
+
+func newJsonTraceReader(file *os.File) (*jsonTraceReader, error) {
+	var this jsonTraceReader
+	var reader *bufio.Reader
+	var first []byte
+	var err error
+
+	this.file = file
+	this.count = 0
+
+	reader = bufio.NewReader(file)
+
+	for {
+		first, err = reader.Peek(1)
+		if err != nil {
+			break
+		}
+
+		if (first[0] != ' ') && (first[0] != '\t') &&
+			(first[0] != '\n') && (first[0] != '\r') {
+			break
+		}
+
+		reader.ReadByte()
+	}
+
+	this.decoder = json.NewDecoder(reader)
+	this.decoder.UseNumber()
+
+	if (err == nil) && (first[0] == '[') {
+		_, err = this.decoder.Token()
+		if err != nil {
+			file.Close()
+			return nil, err
+		}
+
+		this.array = true
+	}
+
+	return &this, nil
+}
+
+func (this *jsonTraceReader) read() (traceRow, error) {
+	var object map[string]interface{}
+	var value interface{}
+	var ret traceRow
+	var key string
+	var err error
+
+	if this.array && !this.decoder.More() {
+		return nil, io.EOF
+	}
+
+	err = this.decoder.Decode(&object)
+	if err != nil {
+		if err != io.EOF {
+			err = fmt.Errorf("row %d: %s", this.count + 1,
+				err.Error())
+		}
+
+		return nil, err
+	}
+
+	this.count += 1
+	ret = make(traceRow, len(object))
+
+	for key, value = range object {
+		switch value.(type) {
+		case json.Number:
+			ret[key] = value.(json.Number).String()
+		case string:
+			ret[key] = value.(string)
+		default:
+			ret[key] = fmt.Sprintf("%v", value)
+		}
+	}
+
+	return ret, nil
+}
+
+func (this *jsonTraceReader) line() int {
+	return this.count
+}
+
+func (this *jsonTraceReader) Close() error {
+	return this.file.Close()
+}
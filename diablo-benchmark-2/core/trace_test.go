@@ -0,0 +1,160 @@
+package core
+
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+
+func writeTestTrace(t *testing.T, name, content string) string {
+	var path string = filepath.Join(t.TempDir(), name)
+	var err error
+
+	err = os.WriteFile(path, []byte(content), 0644)
+	if err != nil {
+		t.Fatalf("write trace: %s", err.Error())
+	}
+
+	return path
+}
+
+func parseTestTrace(t *testing.T, path, options string) (*traceGenerator, error) {
+	var expr BenchmarkExpression
+	var local scope
+	var err error
+
+	expr, err = parseTestExpression(newTestSystem(), fmt.Sprintf(`
+let:
+  - &accounts { sample: !integer { from: 100, to: 104 } }
+behavior: !trace
+  path: %q
+  columns:
+    - &amount { column: "value" }
+    - &sender { column: "from", sample: *accounts }
+  %s
+  interaction: !transfer { from: *sender, stake: *amount }
+`, path, options))
+	if err != nil {
+		t.Fatalf("parse: %s", err.Error())
+	}
+
+	local, err = expr.Field("let").scope()
+	if err != nil {
+		t.Fatalf("scope: %s", err.Error())
+	}
+
+	expr.specialize(local)
+
+	return parseTrace(expr.Field("behavior"), nil)
+}
+
+
+func TestTraceReplay(t *testing.T) {
+	var expected []float64 = []float64{ 0, 0.5, 0.5, 2 }
+	var amounts []int = []int{ 10, 20, 30, 40 }
+	var senders []int = []int{ 100, 102, 104, 101 }
+	var generator *traceGenerator
+	var iact *benchmarkInteraction
+	var variable Variable
+	var path string
+	var err error
+	var ok bool
+	var i int
+
+	for _, path = range []string{
+		writeTestTrace(t, "trace.csv", "ts,value,from\n" +
+			"1000,10,0\n1001,20,2\n1001,30,4\n1004,40,1\n"),
+		writeTestTrace(t, "trace.json", `[
+  { "ts": 1000, "value": 10, "from": 0 },
+  { "ts": 1001, "value": 20, "from": 2 },
+  { "ts": "1001", "value": 30, "from": 4 },
+  { "ts": 1004, "value": 40, "from": 1 }
+]`),
+		writeTestTrace(t, "trace.jsonl",
+			`{ "ts": 1000, "value": 10, "from": 0 }` + "\n" +
+			`{ "ts": 1001, "value": 20, "from": 2 }` + "\n" +
+			`{ "ts": 1001, "value": 30, "from": 4 }` + "\n" +
+			`{ "ts": 1004, "value": 40, "from": 1 }` + "\n"),
+	} {
+		generator, err = parseTestTrace(t, path, `time-column: "ts"
+  scale: 2`)
+		if err != nil {
+			t.Fatalf("%s: %s", path, err.Error())
+		}
+
+		i = 0
+
+		for iact = range generator.generate() {
+			if iact.err != nil {
+				t.Fatalf("%s: %s", path, iact.err.Error())
+			}
+
+			if iact.scheduleTime != expected[i] {
+				t.Fatalf("%s: row %d at %f, expected %f", path,
+					i, iact.scheduleTime, expected[i])
+			}
+
+			variable, _, ok = iact.current.get("amount")
+			if !ok || (variable.Get().(int) != amounts[i]) {
+				t.Fatalf("%s: row %d: wrong amount", path, i)
+			}
+
+			variable, _, ok = iact.current.get("sender")
+			if !ok || (variable.Get().(int) != senders[i]) {
+				t.Fatalf("%s: row %d: wrong sender", path, i)
+			}
+
+			i += 1
+		}
+
+		if i != len(expected) {
+			t.Fatalf("%s: got %d rows, expected %d", path, i,
+				len(expected))
+		}
+	}
+}
+
+func TestTraceOffset(t *testing.T) {
+	var generator *traceGenerator
+	var times []float64
+	var path string
+	var err error
+
+	path = writeTestTrace(t, "trace.csv", "time,value,from\n" +
+		"2022-01-01T00:00:00Z,1,0\n2022-01-01T00:00:10Z,1,0\n" +
+		"2022-01-01T00:00:20Z,1,0\n")
+
+	generator, err = parseTestTrace(t, path, "offset: 1640995205")
+	if err != nil {
+		t.Fatalf("parse: %s", err.Error())
+	}
+
+	times = getTestSchedule(generator)
+	if (len(times) != 2) || (times[0] != 5) || (times[1] != 15) {
+		t.Fatalf("got schedule %v", times)
+	}
+}
+
+func TestTraceErrors(t *testing.T) {
+	var content string
+	var err error
+
+	for _, content = range []string{
+		"time,value,from\n2,1,0\n1,1,0\n",
+		"time,value,from\n1,1,0\n2,x,0\n",
+		"time,value,from\n1,1,5\n",
+		"time,value,from\n1,1,1.5\n",
+		"time,value\n1,1\n",
+		"value,from\n1,0\n",
+		"",
+	} {
+		_, err = parseTestTrace(t, writeTestTrace(t, "trace.csv",
+			content), "")
+		if err == nil {
+			t.Errorf("expected error for: %q", content)
+		}
+	}
+}
@@ -2,7 +2,9 @@ package core
 
 
 import (
+	"errors"
 	"fmt"
+	"reflect"
 )
 
 
@@ -68,6 +70,11 @@ type Distribution interface {
 	Copy(int64, VariableType) Distribution
 }
 
+// The error returned when a value is read from a variable whose `Get()`
+// returns nil.
+//
+var errVariableExhausted error = errors.New("variable exhausted")
+
 // A random variable.
 //
 type Variable interface {
@@ -404,6 +411,8 @@ func parseVariable(expr BenchmarkExpression) (Variable, string, string, error) {
 		def.seed = expr.system().seed()
 	}
 
+	expr.system().recordSeed(expr.FullPosition(), def.name, def.seed)
+
 	def.expr = expr
 
 	_, err = expr.TryField("sample")
@@ -425,9 +434,12 @@ func parseVariable(expr BenchmarkExpression) (Variable, string, string, error) {
 		"'copy' or 'compose'", expr.FullPosition())
 }
 
+// Parse a seed given either as an int or as a string.
+// Strings are hashed with ParseSeed().
+//
 func parseSeed(expr BenchmarkExpression) (int64, error) {
-	// var svar StringVariable
 	var ivar IntVariable
+	var sval string
 	var err error
 	var ival int
 	var ok bool
@@ -443,82 +455,95 @@ func parseSeed(expr BenchmarkExpression) (int64, error) {
 		return int64(ival), nil
 	}
 
-	// svar, err = expr.String(nil)
-	// if err == nil {
-	// 	sval, err = svar.TryGetString()
-	// 	if err != nil {
-	// 		return 0, err
-	// 	}
+	sval, err = expr.GetString()
+	if err == nil {
+		return ParseSeed(sval), nil
+	}
 
-	// 	// hash it
-	// }
-	
 	return 0, fmt.Errorf("%s: must be an int or a string",
 		expr.FullPosition())
 }
 
 
-func parseSampleVariable(def *variableBaseDefinition) (Variable, string, string, error) {
-	var sampleFactory SampleFactory
+// Parse the random space specified by the `random` field of a variable
+// definition or return the uniform random space if there is no such field.
+//
+func parseRandom(def *variableBaseDefinition) (Random, error) {
 	var randomFactory randomFactory
 	var field BenchmarkExpression
-	var domain, rtype string
-	var distrib Distribution
-	var sample Sample
 	var random Random
+	var rtype string
 	var err error
 	var ok bool
 
-	field = def.expr.Field("sample")
-
-	domain, err = field.etype()
-	if err != nil {
-		return nil, "", "", err
-	}
-
-	sampleFactory, ok = def.expr.system().sampleFactory(domain)
-	if !ok {
-		return nil, "", "", fmt.Errorf("%s: unknown domain '%s'",
-			def.expr.FullPosition(), domain)
-	}
-
-	sample, err = sampleFactory.Instance(field)
-	if err != nil {
-		return nil, "", "", err
-	}
-
 	field, err = def.expr.TryField("random")
 	if err == nil {
 		rtype, err = field.etype()
 		if err != nil {
-			return nil, "", "", err
+			return nil, err
 		}
 
 		randomFactory, ok = def.expr.system().randomFactory(rtype)
 		if !ok {
-			return nil, "", "", fmt.Errorf("%s: unknown random " +
-				"type '%s'", def.expr.FullPosition(), rtype)
+			return nil, fmt.Errorf("%s: unknown random type '%s'",
+				def.expr.FullPosition(), rtype)
 		}
 
 		random, err = randomFactory.instance(field)
 		if err != nil {
-			return nil, "", "", fmt.Errorf("%s: %s",
+			return nil, fmt.Errorf("%s: %s",
 				def.expr.FullPosition(), err.Error())
 		}
 	} else {
 		randomFactory, ok = def.expr.system().randomFactory("uniform")
 		if !ok {
-			return nil, "", "", fmt.Errorf("%s: unknown random " +
-				"type '%s'", def.expr.FullPosition(), rtype)
+			return nil, fmt.Errorf("%s: unknown random type " +
+				"'uniform'", def.expr.FullPosition())
 		}
 
 		random, err = randomFactory.instance(nil)
 		if err != nil {
-			return nil, "", "", fmt.Errorf("%s: %s",
+			return nil, fmt.Errorf("%s: %s",
 				def.expr.FullPosition(), err.Error())
 		}
 	}
 
+	return random, nil
+}
+
+func parseSampleVariable(def *variableBaseDefinition) (Variable, string, string, error) {
+	var sampleFactory SampleFactory
+	var field BenchmarkExpression
+	var distrib Distribution
+	var domain string
+	var sample Sample
+	var random Random
+	var err error
+	var ok bool
+
+	field = def.expr.Field("sample")
+
+	domain, err = field.etype()
+	if err != nil {
+		return nil, "", "", err
+	}
+
+	sampleFactory, ok = def.expr.system().sampleFactory(domain)
+	if !ok {
+		return nil, "", "", fmt.Errorf("%s: unknown domain '%s'",
+			def.expr.FullPosition(), domain)
+	}
+
+	sample, err = sampleFactory.Instance(field)
+	if err != nil {
+		return nil, "", "", err
+	}
+
+	random, err = parseRandom(def)
+	if err != nil {
+		return nil, "", "", err
+	}
+
 	distrib = random.Instance(sample.Size(), def.seed, def.vtype)
 
 	Tracef("create variable '%s' (%d elements)", def.name, sample.Size())
@@ -549,7 +574,326 @@ func parseCopyVariable(def *variableBaseDefinition) (Variable, string, string, e
 	return newvar, def.name, domain, nil
 }
 
+// Parse a variable composed from other variables:
+//
+//   compose: !union [ *a, *b ]           # events of a or b
+//   compose: !intersect [ *a, *b ]       # events of a and b
+//   compose: !exclude { base: *a, diff: *b }   # events of a but not b
+//   compose: !pick { from: *a, number: 2 }     # events drawn from a
+//
+// The `diff` field of `!exclude` can also be a list of variables.
+// The composition is computed when the variable is defined, so a variable
+// composed in the `let` of a client is computed again for each client.
+// In particular, `!pick` draws its events from the distribution of its
+// operand which is consumed if it is an `!iter` or a `!loop`.
+// The composed variable then selects its events with its own type, seed and
+// `random` field, like a sample variable.
+//
 func parseComposeVariable(def *variableBaseDefinition) (Variable, string, string, error) {
-	return nil, "", "", fmt.Errorf("%s: compose variable not yet " +
-		"implemented", def.expr.FullPosition())
+	var field BenchmarkExpression
+	var distrib Distribution
+	var domain, ctype string
+	var random Random
+	var sample Sample
+	var err error
+
+	field = def.expr.Field("compose")
+
+	ctype, err = field.etype()
+	if err != nil {
+		return nil, "", "", err
+	}
+
+	if ctype == "union" {
+		sample, domain, err = parseUnionSample(field)
+	} else if ctype == "intersect" {
+		sample, domain, err = parseIntersectSample(field)
+	} else if ctype == "exclude" {
+		sample, domain, err = parseExcludeSample(field)
+	} else if ctype == "pick" {
+		sample, domain, err = parsePickSample(field)
+	} else {
+		return nil, "", "", fmt.Errorf("%s: unknown compose operator " +
+			"'%s'", field.FullPosition(), ctype)
+	}
+
+	if err != nil {
+		return nil, "", "", err
+	}
+
+	random, err = parseRandom(def)
+	if err != nil {
+		return nil, "", "", err
+	}
+
+	distrib = random.Instance(sample.Size(), def.seed, def.vtype)
+
+	Tracef("create variable '%s' (%d elements)", def.name, sample.Size())
+
+	return newVariable(domain, sample, distrib), def.name, domain, nil
+}
+
+func parseComposeOperand(expr BenchmarkExpression) (Variable, string, error) {
+	var variable Variable
+	var domain, name string
+	var err error
+	var ok bool
+
+	name, err = expr.target()
+	if err != nil {
+		return nil, "", err
+	}
+
+	variable, domain, ok = expr.current().get(name)
+	if !ok {
+		return nil, "", fmt.Errorf("%s: unknown variable '%s'",
+			expr.FullPosition(), name)
+	}
+
+	return variable, domain, nil
+}
+
+// Parse either a single variable or a list of variables of the same domain.
+//
+func parseComposeOperands(expr BenchmarkExpression) ([]Variable, string, error) {
+	var items []BenchmarkExpression
+	var item BenchmarkExpression
+	var ret []Variable
+	var variable Variable
+	var domain, idomain string
+	var err error
+
+	items, err = expr.TrySlice()
+	if err != nil {
+		items = []BenchmarkExpression{ expr }
+	}
+
+	if len(items) == 0 {
+		return nil, "", fmt.Errorf("%s: must have at least one " +
+			"variable", expr.FullPosition())
+	}
+
+	ret = make([]Variable, 0, len(items))
+
+	for _, item = range items {
+		variable, idomain, err = parseComposeOperand(item)
+		if err != nil {
+			return nil, "", err
+		}
+
+		if len(ret) == 0 {
+			domain = idomain
+		} else if idomain != domain {
+			return nil, "", fmt.Errorf("%s: cannot convert '%s' " +
+				"to '%s'", item.FullPosition(), idomain,
+				domain)
+		}
+
+		ret = append(ret, variable)
+	}
+
+	return ret, domain, nil
+}
+
+func parseUnionSample(expr BenchmarkExpression) (Sample, string, error) {
+	var elements []interface{} = make([]interface{}, 0)
+	var seen *elementSet = newElementSet()
+	var operands []Variable
+	var operand Variable
+	var element interface{}
+	var domain string
+	var err error
+
+	operands, domain, err = parseComposeOperands(expr)
+	if err != nil {
+		return nil, "", err
+	}
+
+	for _, operand = range operands {
+		for _, element = range sampleElements(operand.Sample()) {
+			if seen.contains(element) {
+				continue
+			}
+
+			seen.add(element)
+			elements = append(elements, element)
+		}
+	}
+
+	return newElementSample(elements), domain, nil
+}
+
+func parseIntersectSample(expr BenchmarkExpression) (Sample, string, error) {
+	var elements []interface{} = make([]interface{}, 0)
+	var seen *elementSet = newElementSet()
+	var others []*elementSet
+	var operands []Variable
+	var element interface{}
+	var domain string
+	var other *elementSet
+	var err error
+	var i int
+	var ok bool
+
+	operands, domain, err = parseComposeOperands(expr)
+	if err != nil {
+		return nil, "", err
+	}
+
+	others = make([]*elementSet, len(operands) - 1)
+	for i = range others {
+		others[i] = newElementSet()
+		others[i].addSample(operands[i + 1].Sample())
+	}
+
+	for _, element = range sampleElements(operands[0].Sample()) {
+		if seen.contains(element) {
+			continue
+		}
+
+		ok = true
+
+		for _, other = range others {
+			if !other.contains(element) {
+				ok = false
+				break
+			}
+		}
+
+		if ok {
+			seen.add(element)
+			elements = append(elements, element)
+		}
+	}
+
+	return newElementSample(elements), domain, nil
+}
+
+func parseExcludeSample(expr BenchmarkExpression) (Sample, string, error) {
+	var elements []interface{} = make([]interface{}, 0)
+	var diff *elementSet = newElementSet()
+	var base, variable Variable
+	var domain, ddomain string
+	var element interface{}
+	var diffs []Variable
+	var err error
+
+	base, domain, err = parseComposeOperand(expr.Field("base"))
+	if err != nil {
+		return nil, "", err
+	}
+
+	diffs, ddomain, err = parseComposeOperands(expr.Field("diff"))
+	if err != nil {
+		return nil, "", err
+	}
+
+	if ddomain != domain {
+		return nil, "", fmt.Errorf("%s: cannot convert '%s' to '%s'",
+			expr.Field("diff").FullPosition(), ddomain, domain)
+	}
+
+	for _, variable = range diffs {
+		diff.addSample(variable.Sample())
+	}
+
+	for _, element = range sampleElements(base.Sample()) {
+		if !diff.contains(element) {
+			elements = append(elements, element)
+		}
+	}
+
+	return newElementSample(elements), domain, nil
+}
+
+func parsePickSample(expr BenchmarkExpression) (Sample, string, error) {
+	var field BenchmarkExpression
+	var elements []interface{}
+	var variable Variable
+	var number, i int
+	var domain string
+	var err error
+
+	variable, domain, err = parseComposeOperand(expr.Field("from"))
+	if err != nil {
+		return nil, "", err
+	}
+
+	field, err = expr.TryField("number")
+	if err == nil {
+		number, err = field.GetInt()
+		if err != nil {
+			return nil, "", err
+		}
+
+		if number < 0 {
+			return nil, "", fmt.Errorf("%s: must be positive or " +
+				"zero", field.FullPosition())
+		}
+	} else {
+		number = 1
+	}
+
+	elements = make([]interface{}, number)
+
+	for i = range elements {
+		elements[i] = variable.Get()
+		if elements[i] == nil {
+			return nil, "", fmt.Errorf("%s: %w",
+				expr.Field("from").FullPosition(),
+				errVariableExhausted)
+		}
+	}
+
+	return newElementSample(elements), domain, nil
+}
+
+
+func sampleElements(sample Sample) []interface{} {
+	var ret []interface{} = make([]interface{}, sample.Size())
+	var i int
+
+	for i = range ret {
+		ret[i] = sample.Get(i)
+	}
+
+	return ret
+}
+
+// A set of sample elements.
+// Elements are compared by value when their type is comparable (e.g. ints or
+// pointers to accounts) and by their printed value otherwise.
+//
+type elementSet struct {
+	elements  map[interface{}]bool
+}
+
+func newElementSet() *elementSet {
+	return &elementSet{
+		elements: make(map[interface{}]bool),
+	}
+}
+
+func elementKey(element interface{}) interface{} {
+	if (element == nil) || reflect.TypeOf(element).Comparable() {
+		return element
+	}
+
+	return fmt.Sprintf("%T:%v", element, element)
+}
+
+func (this *elementSet) add(element interface{}) {
+	this.elements[elementKey(element)] = true
+}
+
+func (this *elementSet) addSample(sample Sample) {
+	var i int
+
+	for i = 0; i < sample.Size(); i++ {
+		this.add(sample.Get(i))
+	}
+}
+
+func (this *elementSet) contains(element interface{}) bool {
+	return this.elements[elementKey(element)]
 }
@@ -0,0 +1,433 @@
+package core
+
+
+import (
+	"gopkg.in/yaml.v3"
+	"sort"
+	"testing"
+)
+
+
+func newTestSystem() *system {
+	var config setupConfig = setupConfig{
+		Sysname: "test",
+		Endpoints: []setupGroupConfig{
+			setupGroupConfig{
+				Addresses: []string{ "ap-0", "ap-1", "ap-2" },
+				Tags: []string{ "ap" },
+			},
+			setupGroupConfig{
+				Addresses: []string{ "eu-0", "eu-1" },
+				Tags: []string{ "eu" },
+			},
+		},
+	}
+
+	return newSystem(42, nil, buildParsedSetup(&config), nil)
+}
+
+func parseTestExpression(sys *system, src string) (BenchmarkExpression, error) {
+	var context parsingContext
+	var implicit basicScope
+	var node yaml.Node
+	var err error
+
+	err = yaml.Unmarshal([]byte(src), &node)
+	if err != nil {
+		return nil, err
+	}
+
+	implicit.init(nil)
+	context.init("test", sys, &implicit)
+
+	return parseBenchmarkYaml(&context, node.Content[0])
+}
+
+// Parse the given `let` sequence in a new scope.
+//
+func parseTestScope(t *testing.T, sys *system, src string) scope {
+	var expr BenchmarkExpression
+	var ret scope
+	var err error
+
+	expr, err = parseTestExpression(sys, src)
+	if err != nil {
+		t.Fatalf("parse: %s", err.Error())
+	}
+
+	ret, err = expr.scope()
+	if err != nil {
+		t.Fatalf("scope: %s", err.Error())
+	}
+
+	return ret
+}
+
+// Parse the given `let` sequence and return the parsing error if any.
+//
+func parseTestScopeError(sys *system, src string) error {
+	var expr BenchmarkExpression
+	var err error
+
+	expr, err = parseTestExpression(sys, src)
+	if err != nil {
+		return err
+	}
+
+	_, err = expr.scope()
+
+	return err
+}
+
+func getTestVariable(t *testing.T, s scope, name string) Variable {
+	var variable Variable
+	var ok bool
+
+	variable, _, ok = s.get(name)
+	if !ok {
+		t.Fatalf("unknown variable '%s'", name)
+	}
+
+	return variable
+}
+
+// Return the sorted elements of the sample of the given variable.
+//
+func getTestInts(t *testing.T, s scope, name string) []int {
+	var variable Variable = getTestVariable(t, s, name)
+	var element interface{}
+	var ret []int
+
+	ret = make([]int, 0)
+
+	for _, element = range sampleElements(variable.Sample()) {
+		ret = append(ret, element.(int))
+	}
+
+	sort.Ints(ret)
+
+	return ret
+}
+
+func assertInts(t *testing.T, name string, got, expected []int) {
+	var i int
+
+	if len(got) != len(expected) {
+		t.Fatalf("%s: got %v, expected %v", name, got, expected)
+	}
+
+	for i = range got {
+		if got[i] != expected[i] {
+			t.Fatalf("%s: got %v, expected %v", name, got,
+				expected)
+		}
+	}
+}
+
+
+func TestComposeUnion(t *testing.T) {
+	var s scope
+
+	s = parseTestScope(t, newTestSystem(), `
+- &a { sample: !integer { from: 0, to: 3 } }
+- &b { sample: !integer { from: 2, to: 5 } }
+- &c { compose: !union [ *a, *b ] }
+`)
+
+	assertInts(t, "union", getTestInts(t, s, "c"),
+		[]int{ 0, 1, 2, 3, 4, 5 })
+}
+
+func TestComposeIntersect(t *testing.T) {
+	var s scope
+
+	s = parseTestScope(t, newTestSystem(), `
+- &a { sample: !integer { from: 0, to: 5 } }
+- &b { sample: !integer { from: 3, to: 9 } }
+- &c { sample: !integer { from: 4, to: 4 } }
+- &ab { compose: !intersect [ *a, *b ] }
+- &abc { compose: !intersect [ *a, *b, *c ] }
+`)
+
+	assertInts(t, "intersect", getTestInts(t, s, "ab"),
+		[]int{ 3, 4, 5 })
+	assertInts(t, "intersect", getTestInts(t, s, "abc"), []int{ 4 })
+}
+
+func TestComposeExclude(t *testing.T) {
+	var s scope
+
+	s = parseTestScope(t, newTestSystem(), `
+- &a { sample: !integer { from: 0, to: 5 } }
+- &b { sample: !integer { from: 1, to: 2 } }
+- &c { sample: !integer { from: 5, to: 5 } }
+- &x { compose: !exclude { base: *a, diff: *b } }
+- &y { compose: !exclude { base: *a, diff: [ *b, *c ] } }
+`)
+
+	assertInts(t, "exclude", getTestInts(t, s, "x"),
+		[]int{ 0, 3, 4, 5 })
+	assertInts(t, "exclude", getTestInts(t, s, "y"),
+		[]int{ 0, 3, 4 })
+}
+
+func TestComposeEndpoints(t *testing.T) {
+	var variable Variable
+	var element interface{}
+	var s scope
+
+	s = parseTestScope(t, newTestSystem(), `
+- &all { sample: !endpoint [ ".*" ] }
+- &eu { sample: !endpoint [ "eu" ] }
+- &ap { compose: !exclude { base: *all, diff: *eu } }
+`)
+
+	variable = getTestVariable(t, s, "ap")
+
+	if variable.Domain() != "endpoint" {
+		t.Fatalf("domain: got %s", variable.Domain())
+	}
+
+	if variable.Sample().Size() != 3 {
+		t.Fatalf("size: got %d, expected 3", variable.Sample().Size())
+	}
+
+	for _, element = range sampleElements(variable.Sample()) {
+		if element.(endpoint).tags()[0] != "ap" {
+			t.Fatalf("unexpected endpoint %s",
+				element.(endpoint).address())
+		}
+	}
+}
+
+// The example from `example.yaml`: each client picks a distinct account from
+// an iterator and sends to the others but not to itself.
+// The `let` of the client is parsed again for each client like parseClient()
+// does.
+//
+func TestComposePickPerScope(t *testing.T) {
+	var expr BenchmarkExpression
+	var froms, local []int
+	var workload, client scope
+	var i, j, from int
+	var seen map[int]bool
+	var err error
+
+	expr, err = parseTestExpression(newTestSystem(), `
+workload:
+  - &accounts { sample: !integer { from: 0, to: 4 } }
+  - !iter &froms { copy: *accounts }
+client:
+  - &from { compose: !pick { from: *froms } }
+  - &local { compose: !exclude { base: *accounts, diff: *from } }
+`)
+	if err != nil {
+		t.Fatalf("parse: %s", err.Error())
+	}
+
+	workload, err = expr.Field("workload").scope()
+	if err != nil {
+		t.Fatalf("scope: %s", err.Error())
+	}
+
+	expr.specialize(workload)
+	seen = make(map[int]bool)
+
+	for i = 0; i < 5; i++ {
+		client, err = expr.Field("client").scope()
+		if err != nil {
+			t.Fatalf("scope: %s", err.Error())
+		}
+
+		froms = getTestInts(t, client, "from")
+		if len(froms) != 1 {
+			t.Fatalf("pick: got %v", froms)
+		}
+
+		from = froms[0]
+
+		if seen[from] {
+			t.Fatalf("pick: %d picked twice", from)
+		}
+
+		seen[from] = true
+
+		local = getTestInts(t, client, "local")
+		if len(local) != 4 {
+			t.Fatalf("exclude: got %v", local)
+		}
+
+		for _, j = range local {
+			if j == from {
+				t.Fatalf("exclude: %d not excluded", from)
+			}
+		}
+	}
+
+	// The iterator is exhausted after 5 clients.
+	_, err = expr.Field("client").scope()
+	if err == nil {
+		t.Fatalf("pick: expected exhausted variable error")
+	}
+}
+
+func TestComposePickNumber(t *testing.T) {
+	var s scope
+
+	s = parseTestScope(t, newTestSystem(), `
+- !iter &a { sample: !integer { from: 0, to: 9 } }
+- &p { compose: !pick { from: *a, number: 10 } }
+`)
+
+	assertInts(t, "pick", getTestInts(t, s, "p"),
+		[]int{ 0, 1, 2, 3, 4, 5, 6, 7, 8, 9 })
+}
+
+func TestComposeVariableType(t *testing.T) {
+	var variable Variable
+	var seen map[int]bool
+	var element interface{}
+	var s scope
+	var i int
+
+	s = parseTestScope(t, newTestSystem(), `
+- &a { sample: !integer { from: 0, to: 1 } }
+- &b { sample: !integer { from: 2, to: 3 } }
+- !iter &once { compose: !union [ *a, *b ] }
+- !loop &loop { compose: !union [ *a, *b ] }
+`)
+
+	variable = getTestVariable(t, s, "once")
+	seen = make(map[int]bool)
+
+	for i = 0; i < 4; i++ {
+		element = variable.Get()
+		if element == nil {
+			t.Fatalf("once: exhausted after %d draws", i)
+		}
+
+		if seen[element.(int)] {
+			t.Fatalf("once: %d drawn twice", element.(int))
+		}
+
+		seen[element.(int)] = true
+	}
+
+	if variable.Get() != nil {
+		t.Fatalf("once: not exhausted after 4 draws")
+	}
+
+	variable = getTestVariable(t, s, "loop")
+
+	for i = 0; i < 12; i++ {
+		if variable.Get() == nil {
+			t.Fatalf("loop: exhausted after %d draws", i)
+		}
+	}
+}
+
+func TestComposeErrors(t *testing.T) {
+	var sys *system = newTestSystem()
+	var src string
+
+	for _, src = range []string{
+		`
+- &a { sample: !integer { from: 0, to: 1 } }
+- &b { compose: !merge [ *a ] }
+`,
+		`
+- &a { sample: !integer { from: 0, to: 1 } }
+- &b { sample: !endpoint [ ".*" ] }
+- &c { compose: !union [ *a, *b ] }
+`,
+		`
+- &a { sample: !integer { from: 0, to: 1 } }
+- &b { sample: !endpoint [ ".*" ] }
+- &c { compose: !exclude { base: *a, diff: *b } }
+`,
+		`
+- &a { sample: !integer { from: 0, to: 1 } }
+- &c { compose: !union [] }
+`,
+	} {
+		if parseTestScopeError(sys, src) == nil {
+			t.Errorf("expected error for:%s", src)
+		}
+	}
+}
+
+func TestStringSeed(t *testing.T) {
+	var sys *system = newTestSystem()
+	var a, b Variable
+	var s scope
+	var i int
+
+	s = parseTestScope(t, sys, `
+- &a { sample: !integer { from: 0, to: 999 }, seed: "europe-run-3" }
+- &b { sample: !integer { from: 0, to: 999 }, seed: "europe-run-3" }
+- &c { sample: !integer { from: 0, to: 999 }, seed: "europe-run-4" }
+- &d { sample: !integer { from: 0, to: 999 }, seed: "42" }
+- &e { sample: !integer { from: 0, to: 999 } }
+`)
+
+	a = getTestVariable(t, s, "a")
+	b = getTestVariable(t, s, "b")
+
+	for i = 0; i < 10; i++ {
+		if a.Get().(int) != b.Get().(int) {
+			t.Fatalf("same string seed gives different values")
+		}
+	}
+
+	if len(sys.seeds) != 5 {
+		t.Fatalf("got %d recorded seeds, expected 5", len(sys.seeds))
+	}
+
+	if (sys.seeds[0].Name != "a") ||
+		(sys.seeds[0].Seed != ParseSeed("europe-run-3")) ||
+		(sys.seeds[0].Seed != sys.seeds[1].Seed) ||
+		(sys.seeds[0].Seed == sys.seeds[2].Seed) {
+		t.Fatalf("wrong recorded string seeds")
+	}
+
+	if sys.seeds[3].Seed != 42 {
+		t.Fatalf("got seed %d, expected 42", sys.seeds[3].Seed)
+	}
+}
+
+func TestExpressionSeed(t *testing.T) {
+	var sys *system = newTestSystem()
+	var other *system = newTestSystem()
+	var seed int64
+	var err error
+
+	seed, err = parseTestExpr(t, sys, `{ seed: "run-1" }`).Seed("m")
+	if (err != nil) || (seed != ParseSeed("run-1")) {
+		t.Fatalf("got seed %d (%v), expected string seed", seed, err)
+	}
+
+	seed, err = parseTestExpr(t, sys, `{ seed: 7 }`).Seed("m")
+	if (err != nil) || (seed != 7) {
+		t.Fatalf("got seed %d (%v), expected 7", seed, err)
+	}
+
+	seed, err = parseTestExpr(t, sys, `{ size: 3 }`).Seed("n")
+	if (err != nil) || (seed != other.seed()) {
+		t.Fatalf("got seed %d (%v), expected master seed", seed, err)
+	}
+
+	if (len(sys.seeds) != 3) || (sys.seeds[2].Name != "n") ||
+		(sys.seeds[2].Seed != seed) {
+		t.Fatalf("wrong recorded seeds")
+	}
+
+	_, err = parseTestExpr(t, sys, `{ seed: 1.5 }`).Seed("m")
+	if err == nil {
+		t.Fatalf("float seed accepted")
+	}
+
+	_, err = parseTestExpr(t, sys, `12`).Seed("m")
+	if err == nil {
+		t.Fatalf("scalar accepted as seeded mapping")
+	}
+}
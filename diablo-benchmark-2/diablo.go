@@ -7,11 +7,11 @@ import (
 	"diablo-benchmark/blockchains/nalgorand"
 	"diablo-benchmark/blockchains/ndiem"
 	"diablo-benchmark/blockchains/nethereum"
+	"diablo-benchmark/blockchains/nzcash"
 	"compress/gzip"
+	"encoding/csv"
 	"fmt"
 	"encoding/json"
-	"hash"
-	"hash/fnv"
 	"io"
 	"os"
 	"sort"
@@ -43,6 +43,7 @@ func buildSystemMap() map[string]core.BlockchainInterface {
 		"diem": &ndiem.BlockchainInterface{},
 		"ethereum": &nethereum.BlockchainInterface{},
 		"mock": &mock.BlockchainInterface{},
+		"zcash": &nzcash.BlockchainInterface{},
 	}
 }
 
@@ -56,22 +57,60 @@ func printResult(dest io.Writer, result *core.Result) {
 	}
 }
 
-func printStat(result *core.Result) {
+// Print statistics over the interactions of the given phase or over all
+// interactions if the phase is not defined.
+// The interactions of a phase are the ones scheduled in it, so the ones which
+// are still queued or not submitted at the end of the benchmark are counted
+// too.
+//
+func printStat(result *core.Result, phaseName string) {
 	var latencies []float64 = make([]float64, 0)
 	var latency, sumLatencies, lastTime float64
+	var queueing, sumQueueing, maxQueueing float64
+	var numDequeued, numExhausted, numScheduled int
+	var firstExhausted float64
 	var secondary *core.SecondaryResult
+	var loop *core.LoopResult
 	var iact *core.InteractionResult
 	var numSubmitted, numAborted int
 	var client *core.ClientResult
+	var phase *core.PhaseResult
 
+	numScheduled = 0
 	numSubmitted = 0
 	numAborted = 0
+	numDequeued = 0
+	numExhausted = 0
+	firstExhausted = -1
 	sumLatencies = 0
+	sumQueueing = 0
+	maxQueueing = 0
 	lastTime = 0
 
+	phase = result.Phase(phaseName)
+	if phase != nil {
+		fmt.Printf("phase: %s (%.1f-%.1f s)\n", phase.Name,
+			phase.Start, phase.End)
+	}
+
 	for _, secondary = range result.Locations {
 		for _, client = range secondary.Clients {
+			for _, loop = range client.ExhaustedLoops {
+				numExhausted += 1
+				if (firstExhausted < 0) ||
+					(loop.ExhaustTime < firstExhausted) {
+					firstExhausted = loop.ExhaustTime
+				}
+			}
+
 			for _, iact = range client.Interactions {
+				if (phase != nil) &&
+					(iact.Phase != phase.Name) {
+					continue
+				}
+
+				numScheduled += 1
+
 				if iact.SubmitTime > lastTime {
 					lastTime = iact.SubmitTime
 				}
@@ -82,6 +121,16 @@ func printStat(result *core.Result) {
 					lastTime = iact.AbortTime
 				}
 
+				if iact.DequeueTime >= 0 {
+					queueing = iact.DequeueTime -
+						iact.ScheduleTime
+					numDequeued += 1
+					sumQueueing += queueing
+					if queueing > maxQueueing {
+						maxQueueing = queueing
+					}
+				}
+
 				if iact.SubmitTime < 0 {
 					continue
 				}
@@ -104,10 +153,32 @@ func printStat(result *core.Result) {
 		}
 	}
 
+	if phase != nil {
+		lastTime = phase.End - phase.Start
+	}
+
+	if numExhausted > 0 {
+		fmt.Printf("warning: %d closed loops ran out of interactions " +
+			"(first at %.1f s)\n", numExhausted, firstExhausted)
+	}
+
+	fmt.Printf("schedule number: %d tx\n", numScheduled)
+	fmt.Printf("queued number: %d tx\n", numScheduled - numDequeued)
+	fmt.Printf("unsubmitted number: %d tx\n",
+		numScheduled - numSubmitted)
 	fmt.Printf("submit number: %d tx\n", numSubmitted)
 	fmt.Printf("commit number: %d tx\n", len(latencies))
 	fmt.Printf("abort number: %d tx\n", numAborted)
 
+	if numDequeued == 0 {
+		fmt.Printf("average queueing delay: -\n")
+		fmt.Printf("max queueing delay: -\n")
+	} else {
+		fmt.Printf("average queueing delay: %.3f s\n",
+			sumQueueing / float64(numDequeued))
+		fmt.Printf("max queueing delay: %.3f s\n", maxQueueing)
+	}
+
 	if lastTime <= 0 {
 		fmt.Printf("average load: -\n")
 	} else {
@@ -171,6 +242,10 @@ func handleHelp(string) error {
 		"<benchmark>  (2)\n", os.Args[0])
 	fmt.Printf("       %s secondary [<options...>] <primary>          " +
 		"             (3)\n", os.Args[0])
+	fmt.Printf("       %s plan [<options...>] <setup> <benchmark>     " +
+		"             (4)\n", os.Args[0])
+	fmt.Printf("       %s check [<options...>] <setup> <benchmark>    " +
+		"             (5)\n", os.Args[0])
 	fmt.Printf(`
 (1) Print program information either help message or version information.
 
@@ -181,6 +256,14 @@ func handleHelp(string) error {
 (3) Launch a Diablo secondary node to run the benchmark following the
     directives of the Diablo primary node at the specified <primary> address.
 
+(4) Print the schedule of the benchmark specified by the given <benchmark>
+    configuration file on the setup specified by the <setup> file without
+    Diablo secondary node and without contacting the blockchain.
+
+(5) Check the benchmark specified by the given <benchmark> configuration file
+    on the setup specified by the <setup> file and print every problem found
+    without running it. Exit with a non zero status if there are problems.
+
 
 General Options:
 
@@ -200,22 +283,85 @@ Primary Options:
   --compress                  Compress output with gzip. Add a '.gz' suffix to
                               the output path is not already present.
 
+  -D <name>=<value>, --define=<name>=<value>
+                              Give <value> to the benchmark parameter <name>
+                              referenced with '!param <name>'. Can be
+                              specified many times.
+
   -d <sec>, --max-delay=<sec> Warn if secondaries submit interactions more than
                               <sec> seconds (and milliseconds) after schedule.
 
+  --max-client-inflight=<int>
+                              Let each client of the Diablo secondary nodes
+                              trigger at most <int> interactions at once. The
+                              other interactions wait in a queue. Default is
+                              0 for no limit.
+
+  --max-inflight=<int>        Let each Diablo secondary node trigger at most
+                              <int> interactions at once. The other
+                              interactions wait in a queue. Default is 0 for
+                              no limit.
+
   -o <path>, --output=<path>  Write results in <path> instead of printing on
                               standard output.
 
   -p <int>, --port=<int>      Listen for Diablo secondary nodes on port <int>.
 
   -s <str>, --seed=<str>      Use <str> as the master random seed instead of
-                              current time.
+                              current time. Strings which are not integers
+                              are hashed.
 
   -S <sec>, --max-skew=<sec>  Warn if secondaries schedule interactions more
                               than <sec> seconds (and milliseconds) late.
 
   --stat                      Print result statistics on standard output.
 
+  --stat-phase=<name>         Compute statistics over the interactions
+                              scheduled in phase <name> only. Default is
+                              'measure'. Use statistics over all interactions
+                              if the benchmark does not define this phase.
+
+  --tls-ca=<path>             Only accept Diablo secondary nodes presenting a
+                              certificate signed by one of the PEM certificate
+                              authorities in <path> (mutual TLS).
+
+  --tls-cert=<path>           Use TLS with Diablo secondary nodes and present
+                              the PEM certificate in <path>.
+
+  --tls-key=<path>            Use the PEM private key in <path> for the
+                              certificate given with '--tls-cert'.
+
+  --token=<str>               Only accept Diablo secondary nodes giving the
+                              same <str> token. Other nodes are logged and
+                              ignored.
+
+
+Plan Options:
+
+  -D <name>=<value>, --define=<name>=<value>
+                              Same as for the primary.
+
+  -l <tags>, --location=<tags>
+                              Add a fake secondary node with the given comma
+                              separated <tags>. Can be specified many times.
+                              Default is one secondary without tag.
+
+  -s <str>, --seed=<str>      Same as for the primary.
+
+  --schedule=<path>           Write the schedule of every interaction in CSV
+                              format in <path>.
+
+
+Check Options:
+
+  -D <name>=<value>, --define=<name>=<value>
+                              Same as for the primary.
+
+  -l <tags>, --location=<tags>
+                              Same as for plan. Default is one secondary for
+                              each endpoint of the setup with the tags of
+                              this endpoint.
+
 
 Secondary Options:
 
@@ -223,6 +369,22 @@ Secondary Options:
 
   -t <str>, --tag=<str>       Attach the given <tag> to this node.
 
+  --tls                       Use TLS with the Diablo primary node and verify
+                              its certificate with the system certificate
+                              authorities.
+
+  --tls-ca=<path>             Use TLS with the Diablo primary node and verify
+                              its certificate with the PEM certificate
+                              authorities in <path>.
+
+  --tls-cert=<path>           Use TLS with the Diablo primary node and present
+                              the PEM certificate in <path> (mutual TLS).
+
+  --tls-key=<path>            Use the PEM private key in <path> for the
+                              certificate given with '--tls-cert'.
+
+  --token=<str>               Give the <str> token to the Diablo primary node.
+
 `)
 
 	os.Exit(0)
@@ -295,21 +457,39 @@ func handlePort(port *int, value string) error {
 	return nil
 }
 
-func handleSeed(seed *int64, value string) error {
-	var hash hash.Hash64
+func handleLimit(limit *int, value string) error {
 	var intValue int
 	var err error
 
 	intValue, err = strconv.Atoi(value)
-	if err == nil {
-		*seed = int64(intValue)
-		return nil
+	if err != nil {
+		return fmt.Errorf("invalid limit '%s'", value)
 	}
 
-	hash = fnv.New64()
-	hash.Write([]byte(value))
+	if intValue < 0 {
+		return fmt.Errorf("invalid limit %d", intValue)
+	}
+
+	*limit = intValue
 
-	*seed = int64(hash.Sum64())
+	return nil
+}
+
+func handleDefine(defines map[string]string, value string) error {
+	var index int
+
+	index = strings.Index(value, "=")
+	if index <= 0 {
+		return fmt.Errorf("invalid definition '%s'", value)
+	}
+
+	defines[value[:index]] = value[index+1:]
+
+	return nil
+}
+
+func handleSeed(seed *int64, value string) error {
+	*seed = core.ParseSeed(value)
 	return nil
 }
 
@@ -326,6 +506,34 @@ func handleSeconds(seconds *float64, value string) error {
 	return nil
 }
 
+// Add the options filling `security` to `longs`.
+// The TLS options are given to both primary and secondaries.
+//
+func appendSecurityOptions(longs []longOption, security *core.Security) []longOption {
+	var defined map[string]bool = make(map[string]bool)
+	var option func(string, *string) longOption
+
+	option = func(name string, dest *string) longOption {
+		return longOption{name, true, func(l string) error {
+			if defined[name] {
+				return fmt.Errorf("option specified twice")
+			}
+
+			defined[name] = true
+			*dest = l
+
+			return nil
+		}}
+	}
+
+	longs = append(longs, option("tls-ca", &security.CaPath))
+	longs = append(longs, option("tls-cert", &security.CertPath))
+	longs = append(longs, option("tls-key", &security.KeyPath))
+	longs = append(longs, option("token", &security.Token))
+
+	return longs
+}
+
 func main() {
 	var shorts []shortOption = make([]shortOption, 0)
 	var longs []longOption = make([]longOption, 0)
@@ -363,7 +571,7 @@ func main() {
 	index += 1
 
 	if index >= len(os.Args) {
-		fatal("missing either 'primary' or 'secondary'")
+		fatal("missing either 'primary', 'secondary' or 'plan'")
 	}
 
 	if os.Args[index] == "primary" {
@@ -376,21 +584,34 @@ func main() {
 		return
 	}
 
+	if os.Args[index] == "plan" {
+		mainPlan(verbosity, env, os.Args[(index+1):])
+		return
+	}
+
+	if os.Args[index] == "check" {
+		mainCheck(verbosity, env, os.Args[(index+1):])
+		return
+	}
+
 	fatal("unknown role '%s'", os.Args[index])
 }
 
 func mainPrimary(verbosity int, env []string, args []string) {
 	var maxDelayClosure, portClosure, seedClosure func(string) error
-	var maxSkewClosure, outputPathClosure func(string) error
+	var maxSkewClosure, outputPathClosure, defineClosure func(string) error
+	var maxInflightClosure, maxClientInflightClosure func(string) error
 	var maxDelayDefined, portDefined, seedDefined, maxSkewDefined bool
 	var outputPathDefined, statDefined, compressDefined bool
+	var statPhaseDefined, maxInflightDefined bool
+	var maxClientInflightDefined bool
 	var shorts []shortOption = make([]shortOption, 0)
 	var longs []longOption = make([]longOption, 0)
 	var output io.WriteCloser
 	var primary core.Nprimary
 	var nsecondaryStr string
 	var result *core.Result
-	var outputPath string
+	var outputPath, statPhase string
 	var index int
 	var err error
 
@@ -404,6 +625,13 @@ func mainPrimary(verbosity int, env []string, args []string) {
 		return nil
 	}})
 
+	primary.Defines = make(map[string]string)
+	defineClosure = func(l string) error {
+		return handleDefine(primary.Defines, l)
+	}
+	shorts = append(shorts, shortOption{'D', true, defineClosure})
+	longs = append(longs, longOption{"define", true, defineClosure})
+
 	primary.MaxDelay = MAX_DELAY_DEFAULT
 	maxDelayDefined = false
 	maxDelayClosure = func(l string) error {
@@ -472,6 +700,34 @@ func mainPrimary(verbosity int, env []string, args []string) {
 	shorts = append(shorts, shortOption{'s', true, seedClosure})
 	longs = append(longs, longOption{"seed", true, seedClosure})
 
+	primary.MaxInflight = 0
+	maxInflightDefined = false
+	maxInflightClosure = func(l string) error {
+		if maxInflightDefined {
+			return fmt.Errorf("option specified twice")
+		}
+
+		maxInflightDefined = true
+
+		return handleLimit(&primary.MaxInflight, l)
+	}
+	longs = append(longs, longOption{"max-inflight", true,
+		maxInflightClosure})
+
+	primary.MaxClientInflight = 0
+	maxClientInflightDefined = false
+	maxClientInflightClosure = func(l string) error {
+		if maxClientInflightDefined {
+			return fmt.Errorf("option specified twice")
+		}
+
+		maxClientInflightDefined = true
+
+		return handleLimit(&primary.MaxClientInflight, l)
+	}
+	longs = append(longs, longOption{"max-client-inflight", true,
+		maxClientInflightClosure})
+
 	primary.MaxSkew = MAX_SKEW_DEFAULT
 	maxSkewDefined = false
 	maxSkewClosure = func(l string) error {
@@ -486,6 +742,19 @@ func mainPrimary(verbosity int, env []string, args []string) {
 	shorts = append(shorts, shortOption{'S', true, maxSkewClosure})
 	longs = append(longs, longOption{"max-skew", true, maxSkewClosure})
 
+	statPhase = "measure"
+	statPhaseDefined = false
+	longs = append(longs, longOption{"stat-phase", true, func(l string)error{
+		if statPhaseDefined {
+			return fmt.Errorf("option specified twice")
+		}
+
+		statPhaseDefined = true
+		statPhase = l
+
+		return nil
+	}})
+
 	statDefined = false
 	longs = append(longs, longOption{"stat", false, func(string) error {
 		if statDefined {
@@ -496,6 +765,8 @@ func mainPrimary(verbosity int, env []string, args []string) {
 		return nil
 	}})
 
+	longs = appendSecurityOptions(longs, &primary.Security)
+
 	shorts = append(shorts, shortOption{'v', false, func(string) error {
 		handleVerbose(&verbosity) ; return nil
 	}})
@@ -508,6 +779,16 @@ func mainPrimary(verbosity int, env []string, args []string) {
 		fatal("%s", err.Error())
 	}
 
+	primary.Security.TLS = (primary.Security.CertPath != "") ||
+		(primary.Security.KeyPath != "")
+
+	if primary.Security.TLS && ((primary.Security.CertPath == "") ||
+		(primary.Security.KeyPath == "")) {
+		fatal("'--tls-cert' and '--tls-key' must be given together")
+	} else if !primary.Security.TLS && (primary.Security.CaPath != "") {
+		fatal("'--tls-ca' needs '--tls-cert' and '--tls-key'")
+	}
+
 	if index >= len(args) {
 		fatal("missing nsecondary operand")
 	} else if (index + 1) >= len(args) {
@@ -563,7 +844,7 @@ func mainPrimary(verbosity int, env []string, args []string) {
 	printResult(output, result)
 
 	if statDefined {
-		printStat(result)
+		printStat(result, statPhase)
 	}
 }
 
@@ -573,7 +854,8 @@ func mainSecondary(verbosity int, env []string, args []string) {
 	var portClosure, tagClosure func(string) error
 	var tags []string = make([]string, 0)
 	var secondary *core.Nsecondary
-	var portDefined bool
+	var security core.Security
+	var portDefined, tlsDefined bool
 	var index, port int
 	var primary string
 	var err error
@@ -611,6 +893,18 @@ func mainSecondary(verbosity int, env []string, args []string) {
 	shorts = append(shorts, shortOption{'t', true, tagClosure})
 	longs = append(longs, longOption{"tag", true, tagClosure})
 
+	tlsDefined = false
+	longs = append(longs, longOption{"tls", false, func(string) error {
+		if tlsDefined {
+			return fmt.Errorf("option specified twice")
+		}
+
+		tlsDefined = true
+		return nil
+	}})
+
+	longs = appendSecurityOptions(longs, &security)
+
 	shorts = append(shorts, shortOption{'v', false, func(string) error {
 		handleVerbose(&verbosity) ; return nil
 	}})
@@ -631,13 +925,346 @@ func mainSecondary(verbosity int, env []string, args []string) {
 
 	primary = args[index]
 
+	if (security.CertPath == "") != (security.KeyPath == "") {
+		fatal("'--tls-cert' and '--tls-key' must be given together")
+	}
+
+	security.TLS = tlsDefined || (security.CaPath != "") ||
+		(security.CertPath != "")
+
 	setVerbosity(verbosity)
 
 	secondary = core.NewNsecondary(primary, port, env, tags,
-		buildSystemMap())
+		buildSystemMap(), &security)
 
 	err = secondary.Run()
 	if err != nil {
 		fatal("%s", err.Error())
 	}
 }
+
+func printPlan(dest io.Writer, plan *core.Plan) {
+	var stakes *core.StakeResult
+	var client *core.PlanClient
+	var iact *core.PlanInteraction
+	var counts []int
+	var warning string
+	var open, pooled int
+	var min, max, stake int
+	var second, i int
+
+	fmt.Fprintf(dest, "duration: %.3f seconds\n", plan.Duration)
+
+	fmt.Fprintf(dest, "\nclients:\n")
+	for _, client = range plan.Clients {
+		open = 0
+		pooled = 0
+
+		for _, iact = range client.Interactions {
+			if iact.Loop == 0 {
+				open += 1
+			} else {
+				pooled += 1
+			}
+		}
+
+		fmt.Fprintf(dest, "  %s/%d %s: %d interactions", client.Location,
+			client.Index, client.Kind, open)
+
+		if len(client.Loops) > 0 {
+			fmt.Fprintf(dest, ", %d closed loops (%d pooled)",
+				len(client.Loops), pooled)
+		}
+
+		fmt.Fprintf(dest, "\n")
+	}
+
+	if len(plan.Stakes) > 0 {
+		fmt.Fprintf(dest, "\nstakes:\n")
+	}
+
+	for _, stakes = range plan.Stakes {
+		min = 0
+		max = 0
+		for i, stake = range stakes.Stakes {
+			if (i == 0) || (stake < min) {
+				min = stake
+			}
+
+			if (i == 0) || (stake > max) {
+				max = stake
+			}
+		}
+
+		fmt.Fprintf(dest, "  %s %s: %d accounts, min %d, max %d\n",
+			stakes.Position, stakes.Distribution,
+			len(stakes.Stakes), min, max)
+	}
+
+	counts = plan.PerSecond()
+
+	fmt.Fprintf(dest, "\nper second:\n")
+	for second = range counts {
+		fmt.Fprintf(dest, "  %d: %d\n", second, counts[second])
+	}
+
+	if len(plan.Warnings) > 0 {
+		fmt.Fprintf(dest, "\nwarnings:\n")
+		for _, warning = range plan.Warnings {
+			fmt.Fprintf(dest, "  %s\n", warning)
+		}
+	}
+}
+
+func writeSchedule(path string, plan *core.Plan) error {
+	var client *core.PlanClient
+	var iact *core.PlanInteraction
+	var writer *csv.Writer
+	var file *os.File
+	var err error
+
+	file, err = os.Create(path)
+	if err != nil {
+		return err
+	}
+
+	defer file.Close()
+
+	writer = csv.NewWriter(file)
+
+	writer.Write([]string{
+		"location", "client", "kind", "label", "type", "loop", "time",
+	})
+
+	for _, client = range plan.Clients {
+		for _, iact = range client.Interactions {
+			writer.Write([]string{
+				client.Location,
+				strconv.Itoa(client.Index),
+				iact.Kind,
+				iact.Label,
+				iact.Type,
+				strconv.Itoa(iact.Loop),
+				strconv.FormatFloat(iact.Time, 'f', -1, 64),
+			})
+		}
+	}
+
+	writer.Flush()
+
+	return writer.Error()
+}
+
+func mainPlan(verbosity int, env []string, args []string) {
+	var scheduleClosure, seedClosure, defineClosure func(string) error
+	var shorts []shortOption = make([]shortOption, 0)
+	var longs []longOption = make([]longOption, 0)
+	var scheduleDefined, seedDefined bool
+	var plan *core.Plan
+	var nplan core.Nplan
+	var schedule string
+	var index int
+	var err error
+
+	nplan.Defines = make(map[string]string)
+	defineClosure = func(l string) error {
+		return handleDefine(nplan.Defines, l)
+	}
+	shorts = append(shorts, shortOption{'D', true, defineClosure})
+	longs = append(longs, longOption{"define", true, defineClosure})
+
+	shorts = append(shorts, shortOption{'e', true, func(l string) error {
+		env = append(env, l) ; return nil
+	}})
+	longs = append(longs, longOption{"env", true, func(l string) error{
+		env = append(env, l) ; return nil
+	}})
+
+	shorts = append(shorts, shortOption{'h', false, handleHelp})
+	longs = append(longs, longOption{"help", false, handleHelp})
+
+	nplan.Locations = make([][]string, 0)
+	shorts = append(shorts, shortOption{'l', true, func(l string) error {
+		nplan.Locations = append(nplan.Locations, splitTags(l))
+		return nil
+	}})
+	longs = append(longs, longOption{"location", true, func(l string)error{
+		nplan.Locations = append(nplan.Locations, splitTags(l))
+		return nil
+	}})
+
+	nplan.MasterSeed = int64(time.Now().Nanosecond())
+	seedDefined = false
+	seedClosure = func(l string) error {
+		if seedDefined {
+			return fmt.Errorf("option specified twice")
+		}
+
+		seedDefined = true
+
+		return handleSeed(&nplan.MasterSeed, l)
+	}
+	shorts = append(shorts, shortOption{'s', true, seedClosure})
+	longs = append(longs, longOption{"seed", true, seedClosure})
+
+	scheduleDefined = false
+	scheduleClosure = func(l string) error {
+		if scheduleDefined {
+			return fmt.Errorf("option specified twice")
+		}
+
+		scheduleDefined = true
+		schedule = l
+
+		return nil
+	}
+	longs = append(longs, longOption{"schedule", true, scheduleClosure})
+
+	shorts = append(shorts, shortOption{'v', false, func(string) error {
+		handleVerbose(&verbosity) ; return nil
+	}})
+	longs = append(longs, longOption{"verbose", true, func(v string)error{
+		return handleVerboseLevel(&verbosity, v)
+	}})
+
+	index, err = parseOptions(args, shorts, longs)
+	if err != nil {
+		fatal("%s", err.Error())
+	}
+
+	if index >= len(args) {
+		fatal("missing setup operand")
+	} else if (index + 1) >= len(args) {
+		fatal("missing benchmark operand")
+	} else if (index + 2) < len(args) {
+		fatal("unexpected operand '%s'", args[index + 2])
+	}
+
+	nplan.SetupPath = args[index]
+	nplan.BenchmarkPath = args[index + 1]
+
+	if len(nplan.Locations) == 0 {
+		nplan.Locations = append(nplan.Locations, []string{})
+	}
+
+	// Never contact the blockchain of the setup: use the offline builder
+	// of its interface or a mock builder if it has none.
+	//
+	nplan.SystemMap = buildSystemMap()
+	nplan.Chain = &mock.BlockchainInterface{}
+	nplan.Env = env
+
+	setVerbosity(verbosity)
+
+	plan, err = nplan.Run()
+	if err != nil {
+		fatal("%s", err.Error())
+	}
+
+	printPlan(os.Stdout, plan)
+
+	if scheduleDefined {
+		err = writeSchedule(schedule, plan)
+		if err != nil {
+			fatal("cannot write schedule '%s': %s", schedule,
+				err.Error())
+		}
+	}
+}
+
+func mainCheck(verbosity int, env []string, args []string) {
+	var shorts []shortOption = make([]shortOption, 0)
+	var longs []longOption = make([]longOption, 0)
+	var defineClosure func(string) error
+	var ncheck core.Ncheck
+	var problems []string
+	var problem string
+	var index int
+	var err error
+
+	ncheck.Defines = make(map[string]string)
+	defineClosure = func(l string) error {
+		return handleDefine(ncheck.Defines, l)
+	}
+	shorts = append(shorts, shortOption{'D', true, defineClosure})
+	longs = append(longs, longOption{"define", true, defineClosure})
+
+	shorts = append(shorts, shortOption{'e', true, func(l string) error {
+		env = append(env, l) ; return nil
+	}})
+	longs = append(longs, longOption{"env", true, func(l string) error{
+		env = append(env, l) ; return nil
+	}})
+
+	shorts = append(shorts, shortOption{'h', false, handleHelp})
+	longs = append(longs, longOption{"help", false, handleHelp})
+
+	ncheck.Locations = make([][]string, 0)
+	shorts = append(shorts, shortOption{'l', true, func(l string) error {
+		ncheck.Locations = append(ncheck.Locations, splitTags(l))
+		return nil
+	}})
+	longs = append(longs, longOption{"location", true, func(l string)error{
+		ncheck.Locations = append(ncheck.Locations, splitTags(l))
+		return nil
+	}})
+
+	shorts = append(shorts, shortOption{'v', false, func(string) error {
+		handleVerbose(&verbosity) ; return nil
+	}})
+	longs = append(longs, longOption{"verbose", true, func(v string)error{
+		return handleVerboseLevel(&verbosity, v)
+	}})
+
+	index, err = parseOptions(args, shorts, longs)
+	if err != nil {
+		fatal("%s", err.Error())
+	}
+
+	if index >= len(args) {
+		fatal("missing setup operand")
+	} else if (index + 1) >= len(args) {
+		fatal("missing benchmark operand")
+	} else if (index + 2) < len(args) {
+		fatal("unexpected operand '%s'", args[index + 2])
+	}
+
+	ncheck.SetupPath = args[index]
+	ncheck.BenchmarkPath = args[index + 1]
+
+	// Never contact the blockchain of the setup: use the offline builder
+	// of its interface or a mock builder if it has none.
+	//
+	ncheck.SystemMap = buildSystemMap()
+	ncheck.Chain = &mock.BlockchainInterface{}
+	ncheck.Env = env
+
+	setVerbosity(verbosity)
+
+	problems, err = ncheck.Run()
+	if err != nil {
+		fatal("%s", err.Error())
+	}
+
+	for _, problem = range problems {
+		fmt.Printf("%s\n", problem)
+	}
+
+	if len(problems) > 0 {
+		os.Exit(1)
+	}
+}
+
+func splitTags(value string) []string {
+	var tags []string = make([]string, 0)
+	var tag string
+
+	for _, tag = range strings.Split(value, ",") {
+		tag = strings.TrimSpace(tag)
+		if tag != "" {
+			tags = append(tags, tag)
+		}
+	}
+
+	return tags
+}